@@ -31,7 +31,19 @@ func main() {
 
 	transactionRepo := repository.NewTransactionRepository(gormDB, sqlDB)
 	lockRepo := repository.NewLockRepository(sqlDB)
-	transactionService := service.NewOrderCheckerService(transactionRepo, lockRepo, sqlDB)
+	balanceRepo := repository.NewBalanceRepository(sqlDB)
+	assetRepo := repository.NewAssetRepository(sqlDB)
+	symbolRepo := repository.NewSymbolRepository(sqlDB)
+	auctionRepo := repository.NewAuctionRepository(sqlDB)
+	heartbeatRepo := repository.NewHeartbeatRepository(sqlDB)
+	feeRepo := repository.NewFeeRepository(sqlDB)
+	haltRepo := repository.NewTradingHaltRepository(sqlDB)
+	ledgerRepo := repository.NewLedgerRepository(sqlDB)
+	transactionService := service.NewOrderCheckerService(transactionRepo, lockRepo, balanceRepo, assetRepo, symbolRepo, auctionRepo,
+		heartbeatRepo, feeRepo, haltRepo, ledgerRepo, sqlDB, time.Now)
+	if err := transactionService.LoadOrderBook(); err != nil {
+		log.Fatalf("could not load order book: %v", err)
+	}
 
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
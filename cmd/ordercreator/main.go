@@ -6,10 +6,16 @@ import (
 	"bitcoinOrder/internal/domain/entity"
 	"bitcoinOrder/internal/repository"
 	"bitcoinOrder/pkg/database"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
 	"github.com/labstack/echo/v4"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"strings"
 )
 
 func main() {
@@ -36,17 +42,124 @@ func main() {
 		log.Println(http.ListenAndServe("localhost:6060", nil))
 	}()
 
-	err = gormDB.AutoMigrate(&entity.Order{}, &entity.OrderMatch{}, &entity.Users{}, &entity.Lock{})
+	// amounts kept as double precision before are altered to numeric here
+	err = gormDB.AutoMigrate(&entity.Order{}, &entity.OrderMatch{}, &entity.Users{}, &entity.Lock{}, &entity.SelfTradeEvent{},
+		&entity.Symbol{}, &entity.Auction{}, &entity.Heartbeat{}, &entity.FeeTier{}, &entity.TradingHalt{},
+		&entity.SymbolStatusChange{}, &entity.LedgerEntry{}, &entity.Balance{}, &entity.Asset{})
 	if err != nil {
 		log.Fatalf("An error occurred while creating tables: %v", err)
 	}
 
+	d := decimal.RequireFromString
+	assetRepo := repository.NewAssetRepository(db)
+	err = assetRepo.CreateAssets(context.Background(), []entity.Asset{
+		{Code: "BTC", Name: "Bitcoin", Precision: 8, MinDeposit: d("0.0001"), MinWithdrawal: d("0.0005"),
+			DepositEnabled: true, WithdrawEnabled: true, TradeEnabled: true},
+		// ETH has 18 places on chain but is held to entity.MaxAssetPrecision
+		{Code: "ETH", Name: "Ether", Precision: entity.MaxAssetPrecision, MinDeposit: d("0.001"), MinWithdrawal: d("0.005"),
+			DepositEnabled: true, WithdrawEnabled: true, TradeEnabled: true},
+		{Code: "USDT", Name: "Tether USD", Precision: 6, MinDeposit: d("1"), MinWithdrawal: d("10"),
+			DepositEnabled: true, WithdrawEnabled: true, TradeEnabled: true},
+	})
+	if err != nil {
+		log.Fatalf("An error occurred while creating assets: %v", err)
+	}
+	symbolRepo := repository.NewSymbolRepository(db)
+	err = symbolRepo.CreateSymbols(context.Background(), []entity.Symbol{
+		{Name: "BTCUSDT", BaseAsset: "BTC", QuoteAsset: "USDT",
+			TickSize: d("0.01"), StepSize: d("0.00001"), MinQuantity: d("0.00001"), MaxQuantity: d("9000"), MinNotional: d("5"),
+			PriceBand: d("0.1"), BreakerMove: d("0.05"), BreakerWindowSeconds: 300, BreakerCooldownSeconds: 300, ReopenAuctionSeconds: 60},
+		{Name: "ETHUSDT", BaseAsset: "ETH", QuoteAsset: "USDT",
+			TickSize: d("0.01"), StepSize: d("0.0001"), MinQuantity: d("0.0001"), MaxQuantity: d("10000"), MinNotional: d("5"),
+			PriceBand: d("0.1"), BreakerMove: d("0.05"), BreakerWindowSeconds: 300, BreakerCooldownSeconds: 300, ReopenAuctionSeconds: 60},
+		{Name: "ETHBTC", BaseAsset: "ETH", QuoteAsset: "BTC",
+			TickSize: d("0.00001"), StepSize: d("0.0001"), MinQuantity: d("0.0001"), MaxQuantity: d("10000"), MinNotional: d("0.0001"),
+			PriceBand: d("0.15"), BreakerMove: d("0.08"), BreakerWindowSeconds: 300, BreakerCooldownSeconds: 300},
+	})
+	if err != nil {
+		log.Fatalf("An error occurred while creating symbols: %v", err)
+	}
+	// orders placed before the symbol registry all traded BTC against USDT
+	err = gormDB.Exec("UPDATE orders SET asset = ? WHERE asset IS NULL OR asset = ''", utils.DefaultSymbol).Error
+	if err != nil {
+		log.Fatalf("An error occurred while migrating order symbols: %v", err)
+	}
+	err = gormDB.Exec("UPDATE order_matches SET symbol = ? WHERE symbol IS NULL", utils.DefaultSymbol).Error
+	if err != nil {
+		log.Fatalf("An error occurred while migrating match symbols: %v", err)
+	}
+
+	feeRepo := repository.NewFeeRepository(db)
+	err = feeRepo.CreateFeeTiers(context.Background(), []entity.FeeTier{
+		{Name: "VIP0", MinVolume: d("0"), MakerRate: d("0.001"), TakerRate: d("0.001")},
+		{Name: "VIP1", MinVolume: d("1000000"), MakerRate: d("0.0009"), TakerRate: d("0.001")},
+		{Name: "VIP2", MinVolume: d("5000000"), MakerRate: d("0.0008"), TakerRate: d("0.0009")},
+		{Name: "VIP3", MinVolume: d("20000000"), MakerRate: d("0.0006"), TakerRate: d("0.0008")},
+	})
+	if err != nil {
+		log.Fatalf("An error occurred while creating fee tiers: %v", err)
+	}
+	err = gormDB.Exec(`INSERT INTO users (id, email, created_at)
+		VALUES (?, 'fees@exchange.local', NOW()) ON CONFLICT (id) DO NOTHING`, utils.FeeAccountID).Error
+	if err != nil {
+		log.Fatalf("An error occurred while creating the fee account: %v", err)
+	}
+	balanceRepo := repository.NewBalanceRepository(db)
+	if err = inTx(db, balanceRepo.MigrateBalanceColumns); err != nil {
+		log.Fatalf("An error occurred while migrating balances: %v", err)
+	}
+	// the ledger opens with the balances held before it existed
+	ledgerRepo := repository.NewLedgerRepository(db)
+	if err = inTx(db, ledgerRepo.OpenLedger); err != nil {
+		log.Fatalf("An error occurred while opening the ledger: %v", err)
+	}
+
+	auctionRepo := repository.NewAuctionRepository(db)
 	orderRepo := repository.NewOrderRepository(gormDB, db)
 	userRepo := repository.NewUserRepository(gormDB, db)
 	lockRepo := repository.NewLockRepository(db)
-	orderService := service.NewOrderCreatorService(orderRepo, userRepo, lockRepo, gormDB, db)
-	orderHandler := controller.NewOrderCreatorHandler(orderService)
+	heartbeatRepo := repository.NewHeartbeatRepository(db)
+	orderService := service.NewOrderCreatorService(orderRepo, userRepo, lockRepo, balanceRepo, assetRepo, symbolRepo, auctionRepo,
+		heartbeatRepo, ledgerRepo, gormDB, db)
+	if err = orderService.MigrateLegacyLocks(context.Background()); err != nil {
+		log.Fatalf("An error occurred while migrating locks: %v", err)
+	}
+	orderHandler := controller.NewOrderCreatorHandler(orderService, adminTokens())
 	orderHandler.RegisterRoutes(e)
 	log.Fatal(e.Start(":8080"))
 
 }
+
+// adminTokens reads the admins allowed to use the admin routes from
+// ADMIN_TOKENS, a comma separated list of name:token pairs.
+func adminTokens() map[string]string {
+	admins := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("ADMIN_TOKENS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || name == "" || token == "" {
+			log.Fatalf("ADMIN_TOKENS needs name:token pairs, got %q", pair)
+		}
+		admins[name] = token
+	}
+	if len(admins) == 0 {
+		log.Println("ADMIN_TOKENS is empty, the admin routes refuse every request")
+	}
+	return admins
+}
+
+// inTx runs a startup migration in a transaction of its own.
+func inTx(db *sql.DB, migrate func(ctx context.Context) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = migrate(context.WithValue(context.Background(), "tx", tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// loadAuctions reads the running auctions. Their symbols only collect
+// orders and are not matched continuously.
+func (s *OrderCheckerService) loadAuctions(ctx context.Context) error {
+	auctions, err := s.auctionRepo.FindOpenAuctions(ctx)
+	if err != nil {
+		return fmt.Errorf("open auctions could not be retrieved: %w", err)
+	}
+	s.auctions = make(map[string]*entity.Auction, len(auctions))
+	for i := range auctions {
+		s.auctions[auctions[i].Symbol] = &auctions[i]
+	}
+	return nil
+}
+
+func (s *OrderCheckerService) inAuction(symbol string) bool {
+	_, ok := s.auctions[symbol]
+	return ok
+}
+
+// RunAuctions publishes the indicative price and volume of every running
+// auction and uncrosses the ones that have ended, filling every crossing
+// order at the clearing price. An ended auction of a symbol that is not open
+// waits for it to reopen. It returns the auction trades.
+func (s *OrderCheckerService) RunAuctions(ctx context.Context, now time.Time) ([]entity.OrderMatch, error) {
+	symbols := make([]string, 0, len(s.auctions))
+	for symbol := range s.auctions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	var orderMatches []entity.OrderMatch
+	for _, symbol := range symbols {
+		auction := s.auctions[symbol]
+		price, volume := s.engine.Book(symbol).Equilibrium(s.lastPrices[symbol])
+
+		if now.Before(auction.EndsAt) || !s.tradingOpen(symbol) {
+			auction.IndicativePrice, auction.IndicativeVolume = price, volume
+			if err := s.auctionRepo.UpdateAuction(ctx, auction); err != nil {
+				return nil, fmt.Errorf("failed to publish indicative price of %s: %w", symbol, err)
+			}
+			continue
+		}
+
+		result := s.engine.Uncross(symbol, price, volume)
+		s.apply(result)
+		if err := s.persistMatches(ctx, result.Orders, result.Matches); err != nil {
+			return nil, err
+		}
+		auction.IndicativePrice, auction.IndicativeVolume = price, volume
+		auction.ClearingPrice = price
+		for _, match := range result.Matches {
+			auction.ClearedVolume = auction.ClearedVolume.Add(match.OrderQuantity)
+		}
+		auction.CompletedAt = &now
+		if err := s.auctionRepo.UpdateAuction(ctx, auction); err != nil {
+			return nil, fmt.Errorf("failed to complete auction of %s: %w", symbol, err)
+		}
+		delete(s.auctions, symbol)
+		orderMatches = append(orderMatches, result.Matches...)
+	}
+	return orderMatches, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/matching"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"fmt"
+)
+
+// cancelResting takes a waiting or resting order off the market and closes
+// it, releasing amount of its lock once the cancellations are settled.
+func (s *OrderCheckerService) cancelResting(order *entity.Order, amount decimal.Decimal) {
+	s.release(s.engine.Cancel(order, amount))
+}
+
+// apply takes on what the engine cancelled and prevented while matching, to
+// be settled and saved with the rest of the pass.
+func (s *OrderCheckerService) apply(result matching.Result) {
+	for _, release := range result.Releases {
+		s.release(release)
+	}
+	s.selfTradeEvents = append(s.selfTradeEvents, result.SelfTrades...)
+}
+
+// release stops tracking a closed order and queues what it no longer needs
+// of its lock.
+func (s *OrderCheckerService) release(release matching.Release) {
+	if order := release.Order; !order.OrderStatus {
+		delete(s.immediateOrders, order.ID)
+		delete(s.expiringOrders, order.ID)
+		delete(s.postOnlyOrders, order.ID)
+		delete(s.stopOrders, order.ID)
+	}
+	s.released = append(s.released, release)
+}
+
+// SettleCancellations persists the orders cancelled or reduced while
+// matching, such as OCO legs and self-trade prevention, and releases the
+// locks they no longer need.
+func (s *OrderCheckerService) SettleCancellations(ctx context.Context) error {
+	if len(s.released) == 0 {
+		return nil
+	}
+	orders := make([]*entity.Order, 0, len(s.released))
+	for _, release := range s.released {
+		orders = append(orders, release.Order)
+	}
+	if err := s.transactionRepo.UpdateOrders(ctx, orders); err != nil {
+		return fmt.Errorf("failed to update cancelled orders: %w", err)
+	}
+
+	for _, release := range s.released {
+		if !release.Amount.IsPositive() {
+			continue
+		}
+		if err := s.locks.Release(ctx, utils.LockID(release.Order), release.Amount, release.Order.ID); err != nil {
+			return fmt.Errorf("failed to release lock of order %s: %w", release.Order.ID, err)
+		}
+	}
+	s.released = nil
+	return nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// pricePoint is one trade price of a symbol, kept while it is inside the
+// symbol's circuit breaker window.
+type pricePoint struct {
+	at    time.Time
+	price decimal.Decimal
+}
+
+// loadHalts reads the trading halts that have not resumed yet.
+func (s *OrderCheckerService) loadHalts(ctx context.Context) error {
+	halts, err := s.haltRepo.FindActiveHalts(ctx)
+	if err != nil {
+		return fmt.Errorf("trading halts could not be retrieved: %w", err)
+	}
+	s.halts = make(map[string]*entity.TradingHalt, len(halts))
+	for i := range halts {
+		s.halts[halts[i].Symbol] = &halts[i]
+	}
+	return nil
+}
+
+func (s *OrderCheckerService) halted(symbol string) bool {
+	_, ok := s.halts[symbol]
+	return ok
+}
+
+// matchable reports whether the symbol trades continuously right now, which
+// it does not while its status is other than open, while it is in an auction
+// or while its circuit breaker has it halted.
+func (s *OrderCheckerService) matchable(symbol string) bool {
+	return s.tradingOpen(symbol) && !s.inAuction(symbol) && !s.halted(symbol)
+}
+
+// tradingOpen reports whether operations left the symbol open. Post-only
+// symbols only take resting orders, so they are not matched either.
+func (s *OrderCheckerService) tradingOpen(symbol string) bool {
+	return s.symbols[symbol].Status == utils.SymbolOpen
+}
+
+// breaker is the guard the engine consults before every continuous trade.
+type breaker struct {
+	s *OrderCheckerService
+}
+
+func (b breaker) Allow(symbol string, price decimal.Decimal, at time.Time) bool {
+	return !b.s.tripBreaker(symbol, price, at)
+}
+
+func (b breaker) Check(symbol string, price decimal.Decimal, at time.Time) bool {
+	_, breached := b.s.breach(symbol, b.s.recentPrices(symbol, at), price)
+	return !breached
+}
+
+// tripBreaker is called before every continuous trade. If the price would
+// move further from any trade in the symbol's window than its breaker
+// allows, the symbol is halted and true is returned so the trade is not
+// made. Otherwise the price joins the window.
+func (s *OrderCheckerService) tripBreaker(symbol string, price decimal.Decimal, now time.Time) bool {
+	window := s.recentPrices(symbol, now)
+	if reference, ok := s.breach(symbol, window, price); ok {
+		s.halt(symbol, reference, price, now)
+		s.priceWindows[symbol] = nil
+		return true
+	}
+	if s.symbols[symbol].BreakerMove.IsPositive() {
+		s.priceWindows[symbol] = append(window, pricePoint{at: now, price: price})
+	}
+	return false
+}
+
+// recentPrices drops the trades that have left the symbol's window and
+// returns the rest.
+func (s *OrderCheckerService) recentPrices(symbol string, now time.Time) []pricePoint {
+	window := s.priceWindows[symbol]
+	since := now.Add(-time.Duration(s.symbols[symbol].BreakerWindowSeconds) * time.Second)
+	for len(window) > 0 && window[0].at.Before(since) {
+		window = window[1:]
+	}
+	s.priceWindows[symbol] = window
+	return window
+}
+
+// breach returns the reference a trade at price would move too far from.
+// Before the first trade of a window the last trade price is the reference.
+func (s *OrderCheckerService) breach(symbol string, window []pricePoint, price decimal.Decimal) (decimal.Decimal, bool) {
+	move := s.symbols[symbol].BreakerMove
+	if !move.IsPositive() {
+		return decimal.Zero, false
+	}
+	references := make([]decimal.Decimal, 0, len(window)+1)
+	for _, point := range window {
+		references = append(references, point.price)
+	}
+	if last, ok := s.lastPrices[symbol]; ok && len(references) == 0 {
+		references = append(references, last)
+	}
+	for _, reference := range references {
+		if reference.IsPositive() && price.Sub(reference).Abs().GreaterThan(reference.MustMul(move)) {
+			return reference, true
+		}
+	}
+	return decimal.Zero, false
+}
+
+// withinPriceBand reports whether a limit price lies within the symbol's
+// price band around its last trade, as the order creator checks when an
+// order is placed. Before the first trade every price is allowed.
+func (s *OrderCheckerService) withinPriceBand(symbol string, price decimal.Decimal) bool {
+	band := s.symbols[symbol].PriceBand
+	reference, ok := s.lastPrices[symbol]
+	if !ok || !band.IsPositive() || !reference.IsPositive() {
+		return true
+	}
+	low, high := utils.PriceBand(reference, band)
+	return price.GreaterThanOrEqual(low) && price.LessThanOrEqual(high)
+}
+
+func (s *OrderCheckerService) halt(symbol string, reference, price decimal.Decimal, now time.Time) {
+	rules := s.symbols[symbol]
+	halt := entity.TradingHalt{
+		ID:     uuid.New(),
+		Symbol: symbol,
+		Reason: fmt.Sprintf("circuit breaker: a trade at %v would move the price more than %v%% from %v within %ds",
+			price, rules.BreakerMove.MustMul(decimal.NewFromInt(100)), reference, rules.BreakerWindowSeconds),
+		ReferencePrice: reference,
+		TriggerPrice:   price,
+		HaltedAt:       now,
+		ResumesAt:      now.Add(time.Duration(rules.BreakerCooldownSeconds) * time.Second),
+	}
+	s.halts[symbol] = &halt
+	s.pendingHalts = append(s.pendingHalts, halt)
+	log.Printf("%s halted until %s: %s", symbol, halt.ResumesAt.Format(time.RFC3339), halt.Reason)
+}
+
+// SaveTradingHalts persists the halts tripped while matching.
+func (s *OrderCheckerService) SaveTradingHalts(ctx context.Context) error {
+	for _, halt := range s.pendingHalts {
+		if err := s.haltRepo.CreateHalt(ctx, halt); err != nil {
+			return err
+		}
+	}
+	s.pendingHalts = nil
+	return nil
+}
+
+// ResumeHalts reopens every halted symbol whose cooldown is over, through a
+// call auction when the symbol asks for one and as continuous trading
+// otherwise.
+func (s *OrderCheckerService) ResumeHalts(ctx context.Context, now time.Time) error {
+	for symbol, halt := range s.halts {
+		if halt.ResumesAt.After(now) {
+			continue
+		}
+		if err := s.haltRepo.ResumeHalt(ctx, halt.ID, now); err != nil {
+			return err
+		}
+		delete(s.halts, symbol)
+
+		rules := s.symbols[symbol]
+		if rules.ReopenAuctionSeconds <= 0 {
+			continue
+		}
+		auction := entity.Auction{
+			ID:        uuid.New(),
+			Symbol:    symbol,
+			Reason:    "reopening after circuit breaker halt",
+			StartedAt: now,
+			EndsAt:    now.Add(time.Duration(rules.ReopenAuctionSeconds) * time.Second),
+		}
+		err := s.auctionRepo.CreateAuction(ctx, auction)
+		if errors.Is(err, repository.ErrAuctionRunning) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open reopening auction of %s: %w", symbol, err)
+		}
+		s.auctions[symbol] = &auction
+	}
+	return nil
+}
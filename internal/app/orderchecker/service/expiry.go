@@ -0,0 +1,40 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"context"
+	"fmt"
+	"time"
+)
+
+// ExpireOrders takes every GTD order whose expiry has passed off the book, or
+// out of the stop orders waiting for their trigger, and closes it. The
+// expired orders are returned so their locks can be released.
+func (s *OrderCheckerService) ExpireOrders(ctx context.Context, now time.Time) ([]*entity.Order, error) {
+	var expired []*entity.Order
+	for id, order := range s.expiringOrders {
+		_, resting := s.bookFor(order).Get(id)
+		_, waiting := s.stopOrders[id]
+		if !resting && !waiting {
+			delete(s.expiringOrders, id)
+			continue
+		}
+		if order.ExpiresAt == nil || order.ExpiresAt.After(now) {
+			continue
+		}
+		s.bookFor(order).Remove(id)
+		delete(s.stopOrders, id)
+		delete(s.expiringOrders, id)
+		order.OrderStatus = false
+		order.CompletedAt = &now
+		expired = append(expired, order)
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	if err := s.transactionRepo.UpdateOrders(ctx, expired); err != nil {
+		return nil, fmt.Errorf("failed to update expired orders: %w", err)
+	}
+	return expired, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// feeSchedule prices the fills of one settlement run. Each user's traded
+// volume and the precision of every asset are read once per run.
+type feeSchedule struct {
+	feeRepo    repository.IFeeRepository
+	tiers      []entity.FeeTier
+	precisions map[string]int32
+	since      time.Time
+	volumes    map[uuid.UUID]decimal.Decimal
+}
+
+func (s *OrderCheckerService) newFeeSchedule(ctx context.Context) (*feeSchedule, error) {
+	tiers, err := s.feeRepo.FindFeeTiers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fee tiers could not be retrieved: %w", err)
+	}
+	assets, err := s.assetRepo.FindAllAssets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("assets could not be retrieved: %w", err)
+	}
+	precisions := make(map[string]int32, len(assets))
+	for _, asset := range assets {
+		precisions[asset.Code] = asset.Precision
+	}
+	return &feeSchedule{
+		feeRepo:    s.feeRepo,
+		tiers:      tiers,
+		precisions: precisions,
+		since:      s.now().Add(-utils.FeeVolumeWindow),
+		volumes:    make(map[uuid.UUID]decimal.Decimal),
+	}, nil
+}
+
+// charge sets the fees of a match: the buyer pays in the base asset and the
+// seller in the quote asset, at the maker rate of their tier if their order
+// rested on the book and the taker rate otherwise. Auction trades have no
+// resting side, so both sides pay the taker rate. Each fee is rounded to the
+// decimal places of the asset it is paid in.
+func (f *feeSchedule) charge(ctx context.Context, match *entity.OrderMatch, symbol entity.Symbol, buyUserID, sellUserID uuid.UUID) error {
+	buyRate, err := f.rate(ctx, buyUserID, match.TakerSide != utils.SellOrder)
+	if err != nil {
+		return err
+	}
+	sellRate, err := f.rate(ctx, sellUserID, match.TakerSide != utils.BuyOrder)
+	if err != nil {
+		return err
+	}
+	match.BuyFee = match.OrderQuantity.MustMul(buyRate).Round(f.precision(symbol.BaseAsset))
+	match.SellFee = match.Price.MustMul(match.OrderQuantity).MustMul(sellRate).Round(f.precision(symbol.QuoteAsset))
+	return nil
+}
+
+// precision is the number of decimal places of the asset, decimal.Scale
+// for an asset missing from the registry.
+func (f *feeSchedule) precision(asset string) int32 {
+	if precision, ok := f.precisions[asset]; ok {
+		return precision
+	}
+	return decimal.Scale
+}
+
+func (f *feeSchedule) rate(ctx context.Context, userID uuid.UUID, taker bool) (decimal.Decimal, error) {
+	if userID == utils.FeeAccountID {
+		return decimal.Zero, nil
+	}
+	volume, ok := f.volumes[userID]
+	if !ok {
+		var err error
+		volume, err = f.feeRepo.FindTradedVolume(ctx, userID, utils.FeeVolumeAsset, f.since)
+		if err != nil {
+			return decimal.Zero, err
+		}
+		f.volumes[userID] = volume
+	}
+	return utils.FeeRate(f.tiers, volume, taker), nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"context"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// CancelDisconnected fires the dead-man's switch of every user whose
+// heartbeat is overdue: all their open orders are taken off the market and
+// their locks are released once the cancellations are settled.
+func (s *OrderCheckerService) CancelDisconnected(ctx context.Context, now time.Time) error {
+	heartbeats, err := s.heartbeatRepo.FindExpiredHeartbeats(ctx, now)
+	if err != nil {
+		return err
+	}
+	if len(heartbeats) == 0 {
+		return nil
+	}
+
+	users := make(map[uuid.UUID]bool, len(heartbeats))
+	for _, heartbeat := range heartbeats {
+		users[heartbeat.UserID] = true
+	}
+	cancelled := 0
+	for _, order := range s.openOrders() {
+		if !users[order.UserID] {
+			continue
+		}
+		// an OCO leg only gives up what its open sibling does not still need
+		s.cancelResting(order, s.engine.UnsharedLock(order))
+		cancelled++
+	}
+	log.Printf("dead-man's switch of %d users fired, %d orders cancelled", len(users), cancelled)
+	return nil
+}
+
+// openOrders returns every order the engine holds, resting or waiting.
+func (s *OrderCheckerService) openOrders() []*entity.Order {
+	orders := s.engine.Orders()
+	for _, waiting := range []map[uuid.UUID]*entity.Order{s.immediateOrders, s.postOnlyOrders, s.stopOrders} {
+		for _, order := range waiting {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/matching"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// PlacePostOnlyOrders rests every post-only order received since the last
+// sync unless it would cross the opposite best price. A crossing order is
+// moved one tick away from that price when it asked to be repriced and the
+// new price is within the price band, and is rejected otherwise. Rejected
+// orders are returned so their locks can be
+// released.
+func (s *OrderCheckerService) PlacePostOnlyOrders(ctx context.Context) ([]*entity.Order, error) {
+	var rejected []*entity.Order
+	var ordersToUpdate []*entity.Order
+
+	postOnlyOrders := make([]*entity.Order, 0, len(s.postOnlyOrders))
+	for _, order := range s.postOnlyOrders {
+		postOnlyOrders = append(postOnlyOrders, order)
+	}
+	sort.Slice(postOnlyOrders, func(i, j int) bool {
+		return postOnlyOrders[i].CreatedAt.Before(postOnlyOrders[j].CreatedAt)
+	})
+
+	for _, order := range postOnlyOrders {
+		delete(s.postOnlyOrders, order.ID)
+		best := s.bookFor(order).Best(matching.Opposite(order.Type))
+		if best == nil || !matching.WithinLimit(order, best.OrderPrice) {
+			s.rest(order)
+			continue
+		}
+
+		if order.RepriceOnCross {
+			price := oneTickAway(order.Type, best.OrderPrice, s.tickSize(order))
+			if price.IsPositive() && s.withinPriceBand(order.Asset, price) {
+				if order.Type == utils.BuyOrder {
+					// the buyer locked the quote asset at the original, higher price
+					excess := order.OrderPrice.Sub(price).MustMul(order.OrderQuantity)
+					if err := s.locks.Release(ctx, utils.LockID(order), excess, order.ID); err != nil {
+						return nil, fmt.Errorf("failed to release lock of repriced order %s: %w", order.ID, err)
+					}
+				}
+				order.OrderPrice = price
+				s.rest(order)
+				ordersToUpdate = append(ordersToUpdate, order)
+				continue
+			}
+		}
+
+		order.OrderStatus = false
+		now := s.now()
+		order.CompletedAt = &now
+		rejected = append(rejected, order)
+		ordersToUpdate = append(ordersToUpdate, order)
+	}
+	if len(ordersToUpdate) == 0 {
+		return nil, nil
+	}
+
+	if err := s.transactionRepo.UpdateOrders(ctx, ordersToUpdate); err != nil {
+		return nil, fmt.Errorf("failed to update post-only orders: %w", err)
+	}
+	return rejected, nil
+}
+
+// oneTickAway is the closest price to the opposite best that does not cross it.
+func oneTickAway(side string, oppositeBest, tick decimal.Decimal) decimal.Decimal {
+	price := oppositeBest.Add(tick)
+	if side == utils.BuyOrder {
+		price = oppositeBest.Sub(tick)
+	}
+	// stay on the tick grid when the opposite best is off it
+	return price.MustDiv(tick).Round(0).MustMul(tick)
+}
+
+// tickSize is the price tick of the order's symbol, or the default tick when
+// the symbol does not set one.
+func (s *OrderCheckerService) tickSize(order *entity.Order) decimal.Decimal {
+	if tick := s.symbols[order.Asset].TickSize; tick.IsPositive() {
+		return tick
+	}
+	return utils.PriceTick
+}
@@ -3,6 +3,11 @@ package service
 import (
 	"bitcoinOrder/internal/domain/entity"
 	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/ledger"
+	"bitcoinOrder/pkg/matching"
+	"bitcoinOrder/pkg/orderbook"
+	"bitcoinOrder/pkg/utils"
 	"context"
 	"database/sql"
 	"fmt"
@@ -12,105 +17,357 @@ import (
 	"time"
 )
 
+// syncOverlap is subtracted from the last sync time when polling for changed
+// orders, so rows committed slightly late are not missed. Re-applying an
+// order that was already seen is harmless.
+const syncOverlap = 5 * time.Second
+
 type OrderCheckerService struct {
 	transactionRepo repository.ITransactionRepository
 	lockRepo        repository.ILockRepository
+	balanceRepo     repository.IBalanceRepository
+	assetRepo       repository.IAssetRepository
+	symbolRepo      repository.ISymbolRepository
+	auctionRepo     repository.IAuctionRepository
+	heartbeatRepo   repository.IHeartbeatRepository
+	feeRepo         repository.IFeeRepository
+	haltRepo        repository.ITradingHaltRepository
+	ledgerRepo      repository.ILedgerRepository
+	locks           *repository.LockReleaser
 	db              *sql.DB
+	now             matching.Clock
+	symbols         map[string]entity.Symbol
+	engine          *matching.Engine
+	auctions        map[string]*entity.Auction
+	halts           map[string]*entity.TradingHalt
+	pendingHalts    []entity.TradingHalt
+	priceWindows    map[string][]pricePoint
+	immediateOrders map[uuid.UUID]*entity.Order
+	expiringOrders  map[uuid.UUID]*entity.Order
+	postOnlyOrders  map[uuid.UUID]*entity.Order
+	stopOrders      map[uuid.UUID]*entity.Order
+	released        []matching.Release
+	selfTradeEvents []entity.SelfTradeEvent
+	lastPrices      map[string]decimal.Decimal
+	syncedAt        time.Time
 }
 
-func NewOrderCheckerService(transactionRepo repository.ITransactionRepository, lockRepo repository.ILockRepository, db *sql.DB) *OrderCheckerService {
+func NewOrderCheckerService(transactionRepo repository.ITransactionRepository, lockRepo repository.ILockRepository,
+	balanceRepo repository.IBalanceRepository, assetRepo repository.IAssetRepository,
+	symbolRepo repository.ISymbolRepository, auctionRepo repository.IAuctionRepository,
+	heartbeatRepo repository.IHeartbeatRepository, feeRepo repository.IFeeRepository,
+	haltRepo repository.ITradingHaltRepository, ledgerRepo repository.ILedgerRepository, db *sql.DB,
+	clock matching.Clock) *OrderCheckerService {
 	return &OrderCheckerService{
 		transactionRepo: transactionRepo,
 		lockRepo:        lockRepo,
+		balanceRepo:     balanceRepo,
+		assetRepo:       assetRepo,
+		symbolRepo:      symbolRepo,
+		auctionRepo:     auctionRepo,
+		heartbeatRepo:   heartbeatRepo,
+		feeRepo:         feeRepo,
+		haltRepo:        haltRepo,
+		ledgerRepo:      ledgerRepo,
+		locks:           repository.NewLockReleaser(lockRepo, balanceRepo, assetRepo, ledgerRepo),
 		db:              db,
+		now:             clock,
 	}
 }
 
-func (s *OrderCheckerService) MatchOrder(ctx context.Context, buyOrders, sellOrders []entity.Order) ([]entity.OrderMatch, error) {
-	var orderMatches []entity.OrderMatch
-	var ordersToUpdate []*entity.Order
+// LoadOrderBook rebuilds the in-memory books, one per symbol, from every open
+// order in the orders table, and reads the running auctions and halts.
+func (s *OrderCheckerService) LoadOrderBook() error {
+	ctx := context.Background()
+	dbTx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+	ctx = context.WithValue(ctx, "tx", dbTx)
 
-	if len(buyOrders) == 0 || len(sellOrders) == 0 {
-		return nil, nil
+	loadedAt := s.now()
+	if err = s.loadSymbols(ctx); err != nil {
+		return err
 	}
-	sort.Slice(buyOrders, func(i, j int) bool {
-		if buyOrders[i].OrderPrice == buyOrders[j].OrderPrice {
-			return buyOrders[i].CreatedAt.Before(buyOrders[j].CreatedAt)
-		}
-		return buyOrders[i].OrderPrice < buyOrders[j].OrderPrice
-	})
+	if err = s.loadAuctions(ctx); err != nil {
+		return err
+	}
+	if err = s.loadHalts(ctx); err != nil {
+		return err
+	}
+	orders, err := s.transactionRepo.FindOpenOrders(ctx)
+	if err != nil {
+		return fmt.Errorf("open orders could not be retrieved: %w", err)
+	}
+	lastPrices, err := s.transactionRepo.FindLastMatchPrices(ctx)
+	if err != nil {
+		return fmt.Errorf("last trade prices could not be retrieved: %w", err)
+	}
+	s.lastPrices = lastPrices
+
+	s.engine = matching.New(s.now, uuid.New)
+	if err = s.loadLots(ctx); err != nil {
+		return err
+	}
+	s.immediateOrders = make(map[uuid.UUID]*entity.Order)
+	s.expiringOrders = make(map[uuid.UUID]*entity.Order)
+	s.postOnlyOrders = make(map[uuid.UUID]*entity.Order)
+	s.stopOrders = make(map[uuid.UUID]*entity.Order)
+	s.released = nil
+	s.selfTradeEvents = nil
+	s.pendingHalts = nil
+	s.priceWindows = make(map[string][]pricePoint)
+	for i := range orders {
+		s.applyOrderChange(&orders[i])
+	}
+	s.syncedAt = loadedAt
+	log.Printf("order books of %d symbols loaded with %d resting orders", len(s.engine.Symbols()), len(s.engine.Orders()))
+	return nil
+}
+
+// loadSymbols reads the symbol registry, so symbols added while running are
+// picked up on the next sync.
+func (s *OrderCheckerService) loadSymbols(ctx context.Context) error {
+	symbols, err := s.symbolRepo.FindAllSymbols(ctx)
+	if err != nil {
+		return fmt.Errorf("symbols could not be retrieved: %w", err)
+	}
+	s.symbols = make(map[string]entity.Symbol, len(symbols))
+	for _, symbol := range symbols {
+		s.symbols[symbol.Name] = symbol
+	}
+	return nil
+}
 
-	sort.Slice(sellOrders, func(i, j int) bool {
-		if sellOrders[i].OrderPrice == sellOrders[j].OrderPrice {
-			return sellOrders[i].CreatedAt.Before(sellOrders[j].CreatedAt)
+// loadLots hands the engine the lot rules of every symbol, by which it sizes
+// the fills of market buys.
+func (s *OrderCheckerService) loadLots(ctx context.Context) error {
+	assets, err := s.assetRepo.FindAllAssets(ctx)
+	if err != nil {
+		return fmt.Errorf("assets could not be retrieved: %w", err)
+	}
+	precisions := make(map[string]int32, len(assets))
+	for _, asset := range assets {
+		precisions[asset.Code] = asset.Precision
+	}
+	for _, symbol := range s.symbols {
+		precision, ok := precisions[symbol.BaseAsset]
+		if !ok {
+			precision = decimal.Scale
 		}
-		return sellOrders[i].OrderPrice > sellOrders[j].OrderPrice
-	})
+		s.engine.SetLot(symbol.Name, matching.Lot{StepSize: symbol.StepSize, MinQuantity: symbol.MinQuantity, Precision: precision})
+	}
+	return nil
+}
 
-	i := 0
-	j := 0
+// bookFor returns the book of the order's symbol, creating it on first use.
+func (s *OrderCheckerService) bookFor(order *entity.Order) *orderbook.OrderBook {
+	return s.engine.Book(order.Asset)
+}
 
-	for i < len(buyOrders) && j < len(sellOrders) {
-		buyOrder := &buyOrders[i]
-		sellOrder := &sellOrders[j]
+// syncOrderBook applies the orders created, changed or cancelled since the
+// last sync to the book.
+func (s *OrderCheckerService) syncOrderBook(ctx context.Context) error {
+	syncedAt := s.now()
+	if err := s.loadSymbols(ctx); err != nil {
+		return err
+	}
+	if err := s.loadLots(ctx); err != nil {
+		return err
+	}
+	if err := s.loadAuctions(ctx); err != nil {
+		return err
+	}
+	if err := s.loadHalts(ctx); err != nil {
+		return err
+	}
+	orders, err := s.transactionRepo.FindOrdersChangedSince(ctx, s.syncedAt.Add(-syncOverlap))
+	if err != nil {
+		return fmt.Errorf("changed orders could not be retrieved: %w", err)
+	}
+	for i := range orders {
+		s.applyOrderChange(&orders[i])
+	}
+	s.syncedAt = syncedAt
+	return nil
+}
 
-		if buyOrder.OrderPrice >= sellOrder.OrderPrice {
-			var matchQuantity float64
-			if buyOrder.OrderQuantity < sellOrder.OrderQuantity {
-				matchQuantity = buyOrder.OrderQuantity
-			} else {
-				matchQuantity = sellOrder.OrderQuantity
-			}
+func (s *OrderCheckerService) applyOrderChange(order *entity.Order) {
+	if !order.OrderStatus || order.DeletedAt.Valid {
+		s.bookFor(order).Remove(order.ID)
+		delete(s.immediateOrders, order.ID)
+		delete(s.expiringOrders, order.ID)
+		delete(s.postOnlyOrders, order.ID)
+		delete(s.stopOrders, order.ID)
+		s.engine.Untrack(order)
+		return
+	}
+	s.engine.Track(order)
+	if isStop(order) {
+		// stop orders wait off the book until a trade reaches their trigger
+		s.stopOrders[order.ID] = order
+		s.expireLater(order)
+		return
+	}
+	if isImmediate(order) {
+		// these orders never rest, they are executed once after the sync
+		s.immediateOrders[order.ID] = order
+		return
+	}
+	if resting, ok := s.bookFor(order).Amend(order); ok {
+		s.engine.Track(resting)
+		s.expireLater(resting)
+		return
+	}
+	if order.PostOnly {
+		// checked against the opposite side before it may rest
+		s.postOnlyOrders[order.ID] = order
+		return
+	}
+	s.rest(order)
+}
 
-			orderMatch := entity.OrderMatch{
-				ID:            uuid.New(),
-				OrderID1:      buyOrder.ID,
-				OrderID2:      sellOrder.ID,
-				OrderQuantity: matchQuantity,
-				MatchedAt:     time.Now(),
-			}
-			orderMatches = append(orderMatches, orderMatch)
-
-			buyOrder.OrderQuantity -= matchQuantity
-			sellOrder.OrderQuantity -= matchQuantity
-
-			if buyOrder.OrderQuantity == 0 {
-				buyOrder.OrderStatus = false
-				now := time.Now()
-				buyOrder.CompletedAt = &now
-				i++
-			} else {
-				buyOrder.CompletedAt = nil
-			}
-			if sellOrder.OrderQuantity == 0 {
-				sellOrder.OrderStatus = false
-				now := time.Now()
-				sellOrder.CompletedAt = &now
-				j++
-			} else {
-				sellOrder.CompletedAt = nil
-			}
+func (s *OrderCheckerService) rest(order *entity.Order) {
+	s.bookFor(order).Add(order)
+	s.expireLater(order)
+}
 
-			ordersToUpdate = append(ordersToUpdate, buyOrder, sellOrder)
-		} else {
-			if buyOrder.OrderPrice < sellOrder.OrderPrice {
-				i++
-			} else {
-				j++
-			}
+// expireLater watches a GTD order, resting or waiting for its trigger, for
+// its expiry.
+func (s *OrderCheckerService) expireLater(order *entity.Order) {
+	if order.TimeInForce == utils.GoodTillDate {
+		s.expiringOrders[order.ID] = order
+	}
+}
+
+// isImmediate reports whether the order must trade on arrival and cancel
+// whatever it cannot fill instead of resting on the book.
+func isImmediate(order *entity.Order) bool {
+	return order.Kind == utils.MarketOrder ||
+		order.TimeInForce == utils.ImmediateOrCancel || order.TimeInForce == utils.FillOrKill
+}
+
+// MatchOrder crosses the book of every matchable symbol until its best bid
+// no longer reaches its best ask, removing every order it completes.
+func (s *OrderCheckerService) MatchOrder(ctx context.Context) ([]entity.OrderMatch, error) {
+	var orderMatches []entity.OrderMatch
+	var ordersToUpdate []*entity.Order
+
+	for _, symbol := range s.engine.Symbols() {
+		if !s.matchable(symbol) {
+			continue
+		}
+		result := s.engine.Match(symbol, breaker{s})
+		s.apply(result)
+		orderMatches = append(orderMatches, result.Matches...)
+		ordersToUpdate = append(ordersToUpdate, result.Orders...)
+	}
+
+	if err := s.persistMatches(ctx, ordersToUpdate, orderMatches); err != nil {
+		return nil, err
+	}
+	return orderMatches, nil
+}
+
+// ExecuteImmediateOrders runs one matching pass for every market, IOC and
+// FOK order received since the last sync, never trading beyond the order's
+// limit price. FOK orders that cannot fill completely are rejected without
+// trading. Whatever is left unfilled is cancelled and the orders are returned
+// so their remaining locks can be released. Orders on a symbol that is not
+// matchable wait until it is; a halt tripped during a sweep cancels the
+// rest of that order like any other shortfall.
+func (s *OrderCheckerService) ExecuteImmediateOrders(ctx context.Context) ([]entity.OrderMatch, []*entity.Order, error) {
+	var orderMatches []entity.OrderMatch
+	var ordersToUpdate []*entity.Order
+
+	immediateOrders := make([]*entity.Order, 0, len(s.immediateOrders))
+	for _, order := range s.immediateOrders {
+		if s.matchable(order.Asset) {
+			immediateOrders = append(immediateOrders, order)
+		}
+	}
+	sort.Slice(immediateOrders, func(i, j int) bool {
+		return immediateOrders[i].CreatedAt.Before(immediateOrders[j].CreatedAt)
+	})
+
+	executed := immediateOrders[:0]
+	for _, order := range immediateOrders {
+		if s.halted(order.Asset) {
+			// an earlier order of this pass tripped the breaker
+			continue
 		}
+		result := s.engine.Execute(order, breaker{s})
+		s.apply(result)
+		orderMatches = append(orderMatches, result.Matches...)
+		ordersToUpdate = append(ordersToUpdate, result.Orders...)
+		delete(s.immediateOrders, order.ID)
+		executed = append(executed, order)
+	}
+
+	if err := s.persistMatches(ctx, ordersToUpdate, orderMatches); err != nil {
+		return nil, nil, err
+	}
+	return orderMatches, executed, nil
+}
+
+func (s *OrderCheckerService) persistMatches(ctx context.Context, ordersToUpdate []*entity.Order, orderMatches []entity.OrderMatch) error {
+	if len(ordersToUpdate) == 0 {
+		return nil
 	}
 	if err := s.transactionRepo.UpdateOrders(ctx, ordersToUpdate); err != nil {
-		return nil, fmt.Errorf("failed to update orders: %w", err)
+		return fmt.Errorf("failed to update orders: %w", err)
 	}
 	if err := s.transactionRepo.SaveMatches(ctx, orderMatches); err != nil {
-		return nil, fmt.Errorf("failed to save matches: %w", err)
+		return fmt.Errorf("failed to save matches: %w", err)
 	}
+	return nil
+}
 
-	return orderMatches, nil
+// ReleaseUnfilled returns the part of each cancelled order's lock that was
+// never traded to the user's available balance.
+func (s *OrderCheckerService) ReleaseUnfilled(ctx context.Context, orders []*entity.Order) error {
+	for _, order := range orders {
+		amount := s.engine.UnsharedLock(order)
+		if !amount.IsPositive() {
+			continue
+		}
+		if err := s.locks.Release(ctx, utils.LockID(order), amount, order.ID); err != nil {
+			return fmt.Errorf("failed to release lock of order %s: %w", order.ID, err)
+		}
+	}
+	return nil
+}
+
+// ReleaseClosedLocks releases what is left of the locks of closed orders,
+// such as the rounding a filled order's partial releases left behind, so
+// that locked funds only ever cover open orders.
+func (s *OrderCheckerService) ReleaseClosedLocks(ctx context.Context) error {
+	locks, err := s.lockRepo.FindClosedLocks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		if err = s.locks.Unlock(ctx, lock, lock.Amount, *lock.OrderID); err != nil {
+			return fmt.Errorf("failed to release lock of order %s: %w", *lock.OrderID, err)
+		}
+	}
+	return nil
 }
 
+// UpdateUserBalances settles every match at its execution price. The buyer's
+// lock is released at the buy order's own price, so any USDT locked above
+// the execution price goes back to their available balance. Both sides pay
+// the fee of their tier out of what they receive.
 func (s *OrderCheckerService) UpdateUserBalances(ctx context.Context, orderMatches []entity.OrderMatch) error {
+	if len(orderMatches) == 0 {
+		return nil
+	}
+	fees, err := s.newFeeSchedule(ctx)
+	if err != nil {
+		return err
+	}
+
 	for _, match := range orderMatches {
 		buyOrder, err := s.transactionRepo.FindOrderById(ctx, match.OrderID1)
 		if err != nil {
@@ -123,17 +380,19 @@ func (s *OrderCheckerService) UpdateUserBalances(ctx context.Context, orderMatch
 		}
 		buyUser := &buyOrder.User
 		sellUser := &sellOrder.User
+		symbol := s.symbols[match.Symbol]
 
-		*buyUser.UsdtBalance -= buyOrder.OrderPrice * match.OrderQuantity
-		*buyUser.BtcBalance += match.OrderQuantity
-		*sellUser.UsdtBalance += sellOrder.OrderPrice * match.OrderQuantity
-		*sellUser.BtcBalance -= match.OrderQuantity
-
-		if err := s.transactionRepo.UpdateBalance(ctx, []*entity.Users{buyUser, sellUser}); err != nil {
+		if err := fees.charge(ctx, &match, symbol, buyOrder.UserID, sellOrder.UserID); err != nil {
+			return fmt.Errorf("failed to compute fees: %w", err)
+		}
+		// the buyer's lock was rounded up to the quote asset's places, so the
+		// cost is rounded down and the seller never receives dust
+		cost := match.Price.MustMul(match.OrderQuantity).RoundDown(fees.precision(symbol.QuoteAsset))
+		if err := s.settleMatch(ctx, buyUser, sellUser, symbol, match, cost); err != nil {
 			return fmt.Errorf("failed to update user balances: %w", err)
 		}
 
-		if err := s.manageLocksAfterMatch(ctx, buyUser, sellUser, buyOrder, match.OrderQuantity); err != nil {
+		if err := s.manageLocksAfterMatch(ctx, buyOrder, sellOrder, match); err != nil {
 			return fmt.Errorf("failed to manage locks: %w", err)
 		}
 	}
@@ -141,38 +400,67 @@ func (s *OrderCheckerService) UpdateUserBalances(ctx context.Context, orderMatch
 	return nil
 }
 
-func (s *OrderCheckerService) manageLocksAfterMatch(ctx context.Context, buyUser, sellUser *entity.Users, buyOrder entity.Order, matchQuantity float64) error {
-	if err := s.manageLockForAsset(ctx, buyUser, "USDT", buyOrder.OrderPrice*matchQuantity); err != nil {
-		return fmt.Errorf("failed to manage USDT lock for buyer: %w", err)
+// settleMatch moves the traded base asset from the seller to the buyer and
+// its cost in the quote asset the other way, keeping back the fees for the
+// exchange fee account, and stores the fees on the match. The trade and its
+// fees are journaled against the match.
+func (s *OrderCheckerService) settleMatch(ctx context.Context, buyUser, sellUser *entity.Users, symbol entity.Symbol,
+	match entity.OrderMatch, cost decimal.Decimal) error {
+	if err := s.balanceRepo.Debit(ctx, buyUser.ID, symbol.QuoteAsset, cost); err != nil {
+		return err
 	}
-	if err := s.manageLockForAsset(ctx, sellUser, "BTC", matchQuantity); err != nil {
-		return fmt.Errorf("failed to manage BTC lock for seller: %w", err)
+	if err := s.balanceRepo.Credit(ctx, buyUser.ID, symbol.BaseAsset, match.OrderQuantity.Sub(match.BuyFee)); err != nil {
+		return err
 	}
-	return nil
-}
-
-func (s *OrderCheckerService) manageLockForAsset(ctx context.Context, user *entity.Users, asset string, amount float64) error {
-	lockedAmount, err := s.lockRepo.GetLockedAmount(ctx, user.ID, asset)
-	if err != nil {
-		return fmt.Errorf("failed to get locked %s amount: %w", asset, err)
+	if err := s.balanceRepo.Credit(ctx, sellUser.ID, symbol.QuoteAsset, cost.Sub(match.SellFee)); err != nil {
+		return err
+	}
+	if err := s.balanceRepo.Debit(ctx, sellUser.ID, symbol.BaseAsset, match.OrderQuantity); err != nil {
+		return err
 	}
-	if lockedAmount >= amount {
-		if err = s.lockRepo.IncreaseUserBalance(ctx, user.ID, asset, amount); err != nil {
-			return fmt.Errorf("failed to increase %s balance: %w", asset, err)
+
+	if match.BuyFee.IsPositive() {
+		if err := s.balanceRepo.Credit(ctx, utils.FeeAccountID, symbol.BaseAsset, match.BuyFee); err != nil {
+			return err
 		}
-		if lockedAmount == amount {
-			if err = s.lockRepo.DeleteLock(ctx, user.ID, asset); err != nil {
-				return fmt.Errorf("failed to delete %s lock: %w", asset, err)
-			}
-		} else {
-			if err = s.lockRepo.UpdateLockAmount(ctx, user.ID, asset, amount); err != nil {
-				return fmt.Errorf("failed to update %s lock amount: %w", asset, err)
-			}
+	}
+	if match.SellFee.IsPositive() {
+		if err := s.balanceRepo.Credit(ctx, utils.FeeAccountID, symbol.QuoteAsset, match.SellFee); err != nil {
+			return err
 		}
-	} else {
-		return fmt.Errorf("insufficient locked %s usdt_balance: %v, btc_balance: %v, lock_amount:%v", asset, user.UsdtBalance, user.BtcBalance, amount)
 	}
 
+	buyer, seller := ledger.AvailableOf(buyUser.ID), ledger.AvailableOf(sellUser.ID)
+	trade := ledger.NewJournal(ledger.Trade, match.ID).
+		Transfer(symbol.QuoteAsset, cost, buyer, seller).
+		Transfer(symbol.BaseAsset, match.OrderQuantity, seller, buyer)
+	if err := s.ledgerRepo.PostJournal(ctx, trade); err != nil {
+		return err
+	}
+	feeAccount := ledger.AvailableOf(utils.FeeAccountID)
+	fees := ledger.NewJournal(ledger.Fee, match.ID).
+		Transfer(symbol.BaseAsset, match.BuyFee, buyer, feeAccount).
+		Transfer(symbol.QuoteAsset, match.SellFee, seller, feeAccount)
+	if err := s.ledgerRepo.PostJournal(ctx, fees); err != nil {
+		return err
+	}
+	return s.transactionRepo.UpdateMatchFees(ctx, match)
+}
+
+// manageLocksAfterMatch releases what a match used from the lock of each
+// of its orders.
+func (s *OrderCheckerService) manageLocksAfterMatch(ctx context.Context, buyOrder, sellOrder entity.Order, match entity.OrderMatch) error {
+	// a market buy locked a quote amount rather than price times quantity
+	lockedPrice := buyOrder.OrderPrice
+	if buyOrder.Kind == utils.MarketOrder {
+		lockedPrice = match.Price
+	}
+	if err := s.locks.Release(ctx, utils.LockID(&buyOrder), lockedPrice.MustMul(match.OrderQuantity), match.ID); err != nil {
+		return fmt.Errorf("failed to manage lock of buy order %s: %w", buyOrder.ID, err)
+	}
+	if err := s.locks.Release(ctx, utils.LockID(&sellOrder), match.OrderQuantity, match.ID); err != nil {
+		return fmt.Errorf("failed to manage lock of sell order %s: %w", sellOrder.ID, err)
+	}
 	return nil
 }
 
@@ -192,6 +480,12 @@ func (s *OrderCheckerService) SoftDeleteOrderMatch(ctx context.Context, orderMat
 }
 
 func (s *OrderCheckerService) ProcessTransactions() error {
+	if s.engine == nil {
+		if err := s.LoadOrderBook(); err != nil {
+			return err
+		}
+	}
+
 	ctx := context.Background()
 	dbTx, err := s.db.BeginTx(ctx, nil)
 	ctx = context.WithValue(ctx, "tx", dbTx)
@@ -201,6 +495,8 @@ func (s *OrderCheckerService) ProcessTransactions() error {
 
 	defer func() {
 		if r := recover(); r != nil {
+			// the book may already hold matches that were never persisted
+			s.engine = nil
 			err := dbTx.Rollback()
 			if err != nil {
 				log.Printf("Transaction rollback failed during panic recovery: %v\n", err)
@@ -208,6 +504,7 @@ func (s *OrderCheckerService) ProcessTransactions() error {
 			}
 			log.Println("transaction rolled back due to panic:", r)
 		} else if err != nil {
+			s.engine = nil
 			err := dbTx.Rollback()
 			if err != nil {
 				log.Printf("Transaction rollback failed due to error: %v\n", err)
@@ -217,23 +514,83 @@ func (s *OrderCheckerService) ProcessTransactions() error {
 		} else {
 			err = dbTx.Commit()
 			if err != nil {
+				s.engine = nil
 				log.Println("An error occurred while processing the transaction:", err)
 			}
 		}
 	}()
 
-	buyOrders, err := s.transactionRepo.FindBuyOrders(ctx)
+	if err = s.syncOrderBook(ctx); err != nil {
+		return err
+	}
+
+	expired, err := s.ExpireOrders(ctx, s.now())
 	if err != nil {
-		return fmt.Errorf("buy orders could not be retrieved: %w", err)
+		return fmt.Errorf("expiring orders failed: %w", err)
 	}
 
-	sellOrders, err := s.transactionRepo.FindSellOrders(ctx)
+	if err = s.CancelDisconnected(ctx, s.now()); err != nil {
+		return fmt.Errorf("cancelling orders of disconnected users failed: %w", err)
+	}
+
+	rejected, err := s.PlacePostOnlyOrders(ctx)
 	if err != nil {
-		return fmt.Errorf("sell orders could not be retrieved: %w", err)
+		return fmt.Errorf("placing post-only orders failed: %w", err)
+	}
+	expired = append(expired, rejected...)
+
+	if err = s.ResumeHalts(ctx, s.now()); err != nil {
+		return fmt.Errorf("resuming halted symbols failed: %w", err)
 	}
-	orderMatches, err := s.MatchOrder(ctx, buyOrders, sellOrders)
+
+	auctionMatches, err := s.RunAuctions(ctx, s.now())
 	if err != nil {
-		return fmt.Errorf("matching orders failed: %w", err)
+		return fmt.Errorf("running auctions failed: %w", err)
+	}
+
+	var orderMatches, immediateMatches, crossMatches []entity.OrderMatch
+	var unfilled, cancelled []*entity.Order
+	var triggered bool
+	for {
+		immediateMatches, cancelled, err = s.ExecuteImmediateOrders(ctx)
+		if err != nil {
+			return fmt.Errorf("executing immediate orders failed: %w", err)
+		}
+		unfilled = append(unfilled, cancelled...)
+
+		crossMatches, err = s.MatchOrder(ctx)
+		if err != nil {
+			return fmt.Errorf("matching orders failed: %w", err)
+		}
+
+		// the auction trades can trigger stop orders like any other
+		batch := append(auctionMatches, append(immediateMatches, crossMatches...)...)
+		auctionMatches = nil
+		orderMatches = append(orderMatches, batch...)
+
+		// orders released by these trades are executed in another pass
+		triggered, err = s.TriggerStopOrders(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("triggering stop orders failed: %w", err)
+		}
+		if !triggered {
+			break
+		}
+	}
+
+	err = s.SettleCancellations(ctx)
+	if err != nil {
+		return fmt.Errorf("cancelled orders could not be settled: %w", err)
+	}
+
+	err = s.SaveSelfTradeEvents(ctx)
+	if err != nil {
+		return fmt.Errorf("self-trade events could not be saved: %w", err)
+	}
+
+	err = s.SaveTradingHalts(ctx)
+	if err != nil {
+		return fmt.Errorf("trading halts could not be saved: %w", err)
 	}
 
 	err = s.UpdateUserBalances(ctx, orderMatches)
@@ -241,6 +598,16 @@ func (s *OrderCheckerService) ProcessTransactions() error {
 		return fmt.Errorf("user balances could not be updated: %w", err)
 	}
 
+	err = s.ReleaseUnfilled(ctx, append(unfilled, expired...))
+	if err != nil {
+		return fmt.Errorf("unfilled orders could not be released: %w", err)
+	}
+
+	err = s.ReleaseClosedLocks(ctx)
+	if err != nil {
+		return fmt.Errorf("locks of closed orders could not be released: %w", err)
+	}
+
 	err = s.SoftDeleteOrderMatch(ctx, orderMatches)
 	if err != nil {
 		return fmt.Errorf("order matches could not be deleted: %w", err)
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"fmt"
+	"sort"
+)
+
+func isStop(order *entity.Order) bool {
+	return order.Kind == utils.StopMarketOrder || order.Kind == utils.StopLimitOrder || order.Kind == utils.TrailingStop
+}
+
+// priceRange is the highest and lowest trade price of one symbol in a batch.
+type priceRange struct {
+	high, low decimal.Decimal
+}
+
+// TriggerStopOrders checks the waiting stop orders against the prices of a
+// batch of persisted trades on their symbol. A buy stop triggers once a
+// trade reaches its trigger price from below and a sell stop once a trade
+// reaches it from above. A trailing stop instead follows the trades one by
+// one and moves its trigger after every trade that goes its way. Triggered
+// orders become market or limit orders and are queued like newly arrived
+// ones; a limit price outside the price band around the last trade cancels
+// the order instead. It reports whether anything was triggered.
+func (s *OrderCheckerService) TriggerStopOrders(ctx context.Context, orderMatches []entity.OrderMatch) (bool, error) {
+	if len(orderMatches) == 0 {
+		return false, nil
+	}
+
+	ranges := make(map[string]priceRange)
+	prices := make(map[string][]decimal.Decimal)
+	for _, match := range orderMatches {
+		prices[match.Symbol] = append(prices[match.Symbol], match.Price)
+		r, ok := ranges[match.Symbol]
+		if !ok {
+			r = priceRange{high: match.Price, low: match.Price}
+		}
+		ranges[match.Symbol] = priceRange{high: decimal.Max(r.high, match.Price), low: decimal.Min(r.low, match.Price)}
+		s.lastPrices[match.Symbol] = match.Price
+	}
+
+	var triggered, trailed []*entity.Order
+	for _, order := range s.stopOrders {
+		r, ok := ranges[order.Asset]
+		if !ok {
+			continue
+		}
+		if order.Kind == utils.TrailingStop {
+			hit, moved := trail(order, prices[order.Asset])
+			if hit {
+				triggered = append(triggered, order)
+			} else if moved {
+				trailed = append(trailed, order)
+			}
+			continue
+		}
+		if (order.Type == utils.BuyOrder && r.high.GreaterThanOrEqual(order.TriggerPrice)) ||
+			(order.Type == utils.SellOrder && r.low.LessThanOrEqual(order.TriggerPrice)) {
+			triggered = append(triggered, order)
+		}
+	}
+	if len(trailed) > 0 {
+		if err := s.transactionRepo.UpdateOrders(ctx, trailed); err != nil {
+			return false, fmt.Errorf("failed to update trailing stops: %w", err)
+		}
+	}
+	if len(triggered) == 0 {
+		return false, nil
+	}
+	sort.Slice(triggered, func(i, j int) bool {
+		return triggered[i].CreatedAt.Before(triggered[j].CreatedAt)
+	})
+
+	now := s.now()
+	for _, order := range triggered {
+		delete(s.stopOrders, order.ID)
+		if order.Kind == utils.StopMarketOrder || order.Kind == utils.TrailingStop {
+			order.Kind = utils.MarketOrder
+		} else {
+			order.Kind = utils.LimitOrder
+		}
+		order.TriggeredAt = &now
+		if order.Kind == utils.LimitOrder && !s.withinPriceBand(order.Asset, order.OrderPrice) {
+			s.cancelResting(order, s.engine.UnsharedLock(order))
+			continue
+		}
+		s.applyOrderChange(order)
+	}
+
+	if err := s.transactionRepo.UpdateOrders(ctx, triggered); err != nil {
+		return false, fmt.Errorf("failed to update triggered orders: %w", err)
+	}
+	return true, nil
+}
+
+// trail walks a trailing stop through the trade prices of its symbol in
+// order. It reports whether a trade reached the trigger and whether the
+// trigger moved before that. The slippage cap moves with the trigger.
+func trail(order *entity.Order, prices []decimal.Decimal) (hit, moved bool) {
+	for _, price := range prices {
+		if (order.Type == utils.BuyOrder && price.GreaterThanOrEqual(order.TriggerPrice)) ||
+			(order.Type == utils.SellOrder && price.LessThanOrEqual(order.TriggerPrice)) {
+			return true, moved
+		}
+		next := utils.TrailingTrigger(order, price)
+		if (order.Type == utils.BuyOrder && next.LessThan(order.TriggerPrice)) ||
+			(order.Type == utils.SellOrder && next.GreaterThan(order.TriggerPrice)) {
+			order.OrderPrice = order.OrderPrice.MustMul(next).MustDiv(order.TriggerPrice)
+			order.TriggerPrice = next
+			moved = true
+		}
+	}
+	return false, moved
+}
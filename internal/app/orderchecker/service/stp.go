@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+	"fmt"
+)
+
+// SaveSelfTradeEvents records every trade prevented in this pass.
+func (s *OrderCheckerService) SaveSelfTradeEvents(ctx context.Context) error {
+	if len(s.selfTradeEvents) == 0 {
+		return nil
+	}
+	if err := s.transactionRepo.SaveSelfTradeEvents(ctx, s.selfTradeEvents); err != nil {
+		return fmt.Errorf("failed to save self-trade events: %w", err)
+	}
+	s.selfTradeEvents = nil
+	return nil
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+// adminKey is where RequireAdmin keeps the name of the authenticated admin.
+const adminKey = "admin"
+
+// RequireAdmin lets a request through only with the bearer token of one of
+// the admins, and keeps that admin's name for the handler to record as the
+// actor. Without any admins configured every admin request is refused.
+func (h *Handler) RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		token, ok := strings.CutPrefix(e.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" {
+			return e.JSON(http.StatusUnauthorized, "Missing admin token")
+		}
+		for name, adminToken := range h.admins {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+				e.Set(adminKey, name)
+				return next(e)
+			}
+		}
+		return e.JSON(http.StatusForbidden, "Invalid admin token")
+	}
+}
+
+// admin is the name of the admin RequireAdmin authenticated.
+func admin(e echo.Context) string {
+	name, _ := e.Get(adminKey).(string)
+	return name
+}
@@ -3,6 +3,10 @@ package controller
 import (
 	"bitcoinOrder/internal/app/ordercreator/service"
 	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/ledger"
+	"bitcoinOrder/pkg/utils"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"net/http"
@@ -10,18 +14,38 @@ import (
 
 type Handler struct {
 	Service service.IOrderCreatorService
+	// admins maps the name of each admin to their token.
+	admins map[string]string
 }
 
-func NewOrderCreatorHandler(service *service.OrderCreatorService) *Handler {
-	return &Handler{Service: service}
+func NewOrderCreatorHandler(service service.IOrderCreatorService, admins map[string]string) *Handler {
+	return &Handler{Service: service, admins: admins}
 }
 
 func (h *Handler) RegisterRoutes(e *echo.Echo) {
 	e.POST("/api/v1/order", h.CreateOrder)
+	e.PUT("/api/v1/order/:id", h.AmendOrder)
+	e.DELETE("/api/v1/order/:id", h.CancelOrder)
+	e.POST("/api/v1/order/oco", h.CreateOcoOrder)
+	e.GET("/api/v1/order/oco/:id", h.FindOcoOrder)
+	e.DELETE("/api/v1/order/oco/:id", h.CancelOcoOrder)
 	e.POST("/api/v1/user", h.CreateUser)
 	e.POST("/api/v1/user/addBalance/:id/:asset", h.AddBalance)
+	e.PUT("/api/v1/user/:id/selfTradePrevention", h.UpdateSelfTradePrevention)
+	e.DELETE("/api/v1/user/:id/orders", h.CancelAllOrders)
+	e.POST("/api/v1/user/:id/heartbeat", h.Heartbeat)
 	e.GET("/api/v1/user/:id", h.GetBalance)
+	e.GET("/api/v1/user/:id/ledger", h.FindLedgerEntries)
+	e.GET("/api/v1/ledger/verify", h.VerifyLedger)
 	e.GET("/api/v1/allOrder", h.FindAllOrder)
+	e.GET("/api/v1/symbols", h.FindAllSymbols)
+	e.GET("/api/v1/assets", h.FindAllAssets)
+	e.POST("/api/v1/assets", h.CreateAsset, h.RequireAdmin)
+	e.PUT("/api/v1/assets/:code", h.UpdateAsset, h.RequireAdmin)
+	e.POST("/api/v1/symbols/:name/auction", h.StartAuction, h.RequireAdmin)
+	e.GET("/api/v1/symbols/:name/auction", h.FindAuction)
+	e.PUT("/api/v1/symbols/:name/status", h.UpdateSymbolStatus, h.RequireAdmin)
+	e.GET("/api/v1/symbols/:name/status", h.FindSymbolStatusChanges)
 	e.GET("api/v1/allUser", h.FindAllUser)
 	e.GET("api/v1/findUser/:id", h.FindUser)
 }
@@ -33,16 +57,173 @@ func (h *Handler) CreateOrder(c echo.Context) error {
 	}
 
 	//TODO: this is optional, but it's a good practice to validate the request data
-	if orderDTO.OrderPrice <= 0 || orderDTO.OrderQuantity <= 0 {
-		return c.JSON(http.StatusBadRequest, "Order price and quantity must be positive")
+	switch orderDTO.Kind {
+	case utils.MarketOrder, utils.StopMarketOrder, utils.TrailingStop:
+		if !orderDTO.QuoteAmount.IsPositive() && !orderDTO.OrderQuantity.IsPositive() {
+			return c.JSON(http.StatusBadRequest, "Market orders need a quote amount or a quantity")
+		}
+	default:
+		if !orderDTO.OrderPrice.IsPositive() || !orderDTO.OrderQuantity.IsPositive() {
+			return c.JSON(http.StatusBadRequest, "Order price and quantity must be positive")
+		}
 	}
 
-	err := h.Service.CreateOrder(orderDTO)
+	orderID, err := h.Service.CreateOrder(orderDTO)
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTradingRule), errors.Is(err, repository.ErrSymbolNotFound):
+			return c.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrSymbolStatus), errors.Is(err, service.ErrAssetDisabled):
+			return c.JSON(http.StatusConflict, err.Error())
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
+	return c.JSON(http.StatusCreated, orderID)
+}
+
+func (h *Handler) AmendOrder(e echo.Context) error {
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid order ID")
+	}
 
-	return nil
+	var amendDTO dto.AmendOrderDto
+	if err := e.Bind(&amendDTO); err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+
+	ctx := e.Request().Context()
+	order, err := h.Service.AmendOrder(ctx, id, amendDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrOrderNotFound):
+			return e.JSON(http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrInvalidAmend), errors.Is(err, service.ErrTradingRule):
+			return e.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrOrderNotAmendable), errors.Is(err, service.ErrSymbolStatus),
+			errors.Is(err, service.ErrAssetDisabled):
+			return e.JSON(http.StatusConflict, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, order)
+}
+
+func (h *Handler) CancelOrder(e echo.Context) error {
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid order ID")
+	}
+
+	ctx := e.Request().Context()
+	if err := h.Service.CancelOrder(ctx, id); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrOrderNotFound):
+			return e.JSON(http.StatusNotFound, err.Error())
+		case errors.Is(err, service.ErrOrderNotCancellable):
+			return e.JSON(http.StatusConflict, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, "Order cancelled")
+}
+
+func (h *Handler) CancelAllOrders(e echo.Context) error {
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var filter dto.CancelAllDto
+	if err := (&echo.DefaultBinder{}).BindQueryParams(e, &filter); err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+	if filter.Side != "" {
+		if err := utils.ValidateOrderType(utils.OrderType(filter.Side)); err != nil {
+			return e.JSON(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	ctx := e.Request().Context()
+	cancelled, err := h.Service.CancelAllOrders(ctx, id, filter)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, cancelled)
+}
+
+func (h *Handler) Heartbeat(e echo.Context) error {
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var heartbeatDTO dto.HeartbeatDto
+	if err := e.Bind(&heartbeatDTO); err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+
+	ctx := e.Request().Context()
+	heartbeat, err := h.Service.Heartbeat(ctx, id, heartbeatDTO)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidHeartbeatTimeout) {
+			return e.JSON(http.StatusBadRequest, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, heartbeat)
+}
+
+func (h *Handler) CreateOcoOrder(c echo.Context) error {
+	var ocoDTO dto.OcoOrderDto
+	if err := c.Bind(&ocoDTO); err != nil {
+		return c.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+
+	groupID, err := h.Service.CreateOcoOrder(ocoDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTradingRule):
+			return c.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrSymbolStatus), errors.Is(err, service.ErrAssetDisabled):
+			return c.JSON(http.StatusConflict, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusCreated, groupID)
+}
+
+func (h *Handler) FindOcoOrder(e echo.Context) error {
+	ctx := e.Request().Context()
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid OCO order ID")
+	}
+
+	orders, err := h.Service.FindOcoOrder(ctx, id)
+	if err != nil {
+		if errors.Is(err, service.ErrOcoOrderNotFound) {
+			return e.JSON(http.StatusNotFound, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, orders)
+}
+
+func (h *Handler) CancelOcoOrder(e echo.Context) error {
+	ctx := e.Request().Context()
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid OCO order ID")
+	}
+
+	if err := h.Service.CancelOcoOrder(ctx, id); err != nil {
+		if errors.Is(err, service.ErrOcoOrderNotFound) {
+			return e.JSON(http.StatusNotFound, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, "OCO order cancelled")
 }
 
 func (h *Handler) CreateUser(e echo.Context) error {
@@ -53,6 +234,12 @@ func (h *Handler) CreateUser(e echo.Context) error {
 
 	createdUser, err := h.Service.CreateUser(*userDto)
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, repository.ErrAssetNotFound):
+			return e.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrAssetDisabled):
+			return e.JSON(http.StatusConflict, err.Error())
+		}
 		return e.JSON(http.StatusInternalServerError, err.Error())
 	}
 	return e.JSON(http.StatusCreated, createdUser)
@@ -73,11 +260,38 @@ func (h *Handler) AddBalance(e echo.Context) error {
 
 	ctx := e.Request().Context()
 	if err := h.Service.AddBalance(ctx, balance); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, repository.ErrAssetNotFound):
+			return e.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrAssetDisabled):
+			return e.JSON(http.StatusConflict, err.Error())
+		}
 		return e.JSON(http.StatusInternalServerError, err.Error())
 	}
 	return e.JSON(http.StatusOK, "Balance updated successfully")
 }
 
+func (h *Handler) UpdateSelfTradePrevention(e echo.Context) error {
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var stp dto.SelfTradePreventionDto
+	if err := e.Bind(&stp); err != nil {
+		return e.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := utils.ValidateSelfTradePrevention(stp.Mode); err != nil {
+		return e.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := e.Request().Context()
+	if err := h.Service.UpdateSelfTradePrevention(ctx, id, stp.Mode); err != nil {
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, "Self-trade prevention updated successfully")
+}
+
 func (h *Handler) GetBalance(e echo.Context) error {
 	id, err := uuid.Parse(e.Param("id"))
 	if err != nil {
@@ -100,6 +314,156 @@ func (h *Handler) FindAllOrder(e echo.Context) error {
 	return e.JSON(http.StatusOK, orders)
 }
 
+func (h *Handler) FindAllSymbols(e echo.Context) error {
+	ctx := e.Request().Context()
+	symbols, err := h.Service.FindAllSymbols(ctx)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, symbols)
+}
+
+func (h *Handler) FindAllAssets(e echo.Context) error {
+	ctx := e.Request().Context()
+	assets, err := h.Service.FindAllAssets(ctx)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, assets)
+}
+
+func (h *Handler) CreateAsset(e echo.Context) error {
+	var assetDTO dto.AssetDto
+	if err := e.Bind(&assetDTO); err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+
+	ctx := e.Request().Context()
+	asset, err := h.Service.CreateAsset(ctx, assetDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAsset):
+			return e.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, repository.ErrAssetExists):
+			return e.JSON(http.StatusConflict, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusCreated, asset)
+}
+
+func (h *Handler) UpdateAsset(e echo.Context) error {
+	var assetDTO dto.AssetDto
+	if err := e.Bind(&assetDTO); err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+
+	ctx := e.Request().Context()
+	asset, err := h.Service.UpdateAsset(ctx, e.Param("code"), assetDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAsset):
+			return e.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, repository.ErrAssetNotFound):
+			return e.JSON(http.StatusNotFound, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, asset)
+}
+
+func (h *Handler) StartAuction(e echo.Context) error {
+	var auctionDTO dto.AuctionDto
+	if err := e.Bind(&auctionDTO); err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+
+	ctx := e.Request().Context()
+	auction, err := h.Service.StartAuction(ctx, e.Param("name"), auctionDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAuctionDuration):
+			return e.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, repository.ErrSymbolNotFound):
+			return e.JSON(http.StatusNotFound, err.Error())
+		case errors.Is(err, repository.ErrAuctionRunning):
+			return e.JSON(http.StatusConflict, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusCreated, auction)
+}
+
+func (h *Handler) FindAuction(e echo.Context) error {
+	ctx := e.Request().Context()
+	auction, err := h.Service.FindAuction(ctx, e.Param("name"))
+	if err != nil {
+		if errors.Is(err, repository.ErrAuctionNotFound) {
+			return e.JSON(http.StatusNotFound, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, auction)
+}
+
+func (h *Handler) UpdateSymbolStatus(e echo.Context) error {
+	var statusDTO dto.SymbolStatusDto
+	if err := e.Bind(&statusDTO); err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid request data")
+	}
+	statusDTO.ChangedBy = admin(e)
+
+	ctx := e.Request().Context()
+	change, err := h.Service.UpdateSymbolStatus(ctx, e.Param("name"), statusDTO)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidStatusChange):
+			return e.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, repository.ErrSymbolNotFound):
+			return e.JSON(http.StatusNotFound, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, change)
+}
+
+func (h *Handler) FindSymbolStatusChanges(e echo.Context) error {
+	ctx := e.Request().Context()
+	changes, err := h.Service.FindSymbolStatusChanges(ctx, e.Param("name"))
+	if err != nil {
+		if errors.Is(err, repository.ErrSymbolNotFound) {
+			return e.JSON(http.StatusNotFound, err.Error())
+		}
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, changes)
+}
+
+func (h *Handler) FindLedgerEntries(e echo.Context) error {
+	id, err := uuid.Parse(e.Param("id"))
+	if err != nil {
+		return e.JSON(http.StatusBadRequest, "Invalid user ID")
+	}
+	entries, err := h.Service.FindLedgerEntries(e.Request().Context(), id)
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return e.JSON(http.StatusOK, entries)
+}
+
+// VerifyLedger reports the balances that differ from the journal. An empty
+// list means every balance matches.
+func (h *Handler) VerifyLedger(e echo.Context) error {
+	mismatches, err := h.Service.VerifyLedger(e.Request().Context())
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, err.Error())
+	}
+	if mismatches == nil {
+		mismatches = []ledger.Mismatch{}
+	}
+	return e.JSON(http.StatusOK, mismatches)
+}
+
 func (h *Handler) FindAllUser(c echo.Context) error {
 	users, err := h.Service.FindAllUser()
 	if err != nil {
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	ErrInvalidAmend      = errors.New("an amend needs a positive price or quantity")
+	ErrOrderNotAmendable = errors.New("only open limit orders outside an OCO pair can be amended")
+)
+
+// AmendOrder changes the price and/or quantity of an open limit order.
+// Reducing the quantity keeps the order's place in the queue; raising it or
+// changing the price sends the order to the back. The order's lock grows or
+// shrinks with what it needs. Only an open symbol accepts amends.
+func (s *OrderCreatorService) AmendOrder(ctx context.Context, orderID uuid.UUID, amend dto.AmendOrderDto) (entity.Order, error) {
+	if amend.OrderPrice.IsNegative() || amend.OrderQuantity.IsNegative() || (amend.OrderPrice.IsZero() && amend.OrderQuantity.IsZero()) {
+		return entity.Order{}, ErrInvalidAmend
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Order{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	order, err := s.orderRepo.FindOrderForUpdate(ctx, orderID)
+	if err != nil {
+		return entity.Order{}, err
+	}
+	if !order.OrderStatus || order.DeletedAt.Valid || order.Kind != utils.LimitOrder || order.OcoGroupID != nil {
+		return entity.Order{}, ErrOrderNotAmendable
+	}
+
+	amended := order
+	if amend.OrderPrice.IsPositive() {
+		amended.OrderPrice = amend.OrderPrice
+	}
+	if amend.OrderQuantity.IsPositive() {
+		amended.OrderQuantity = amend.OrderQuantity
+	}
+	if amended.OrderPrice.Equal(order.OrderPrice) && amended.OrderQuantity.Equal(order.OrderQuantity) {
+		return order, nil
+	}
+
+	symbol, err := s.symbolRepo.FindSymbol(ctx, order.Asset)
+	if err != nil {
+		return entity.Order{}, err
+	}
+	if symbol.Status != utils.SymbolOpen {
+		// an amended price could cross the book, which only an open symbol matches
+		return entity.Order{}, fmt.Errorf("%w: %s is %s", ErrSymbolStatus, symbol.Name, symbol.Status)
+	}
+	if err = s.checkAssetsTradable(ctx, symbol); err != nil {
+		return entity.Order{}, err
+	}
+	rules := dto.OrderDto{
+		Kind:            utils.LimitOrder,
+		OrderPrice:      amended.OrderPrice,
+		OrderQuantity:   amended.OrderQuantity,
+		DisplayQuantity: amended.DisplayQuantity,
+	}
+	if err = checkTradingRules(symbol, rules); err != nil {
+		return entity.Order{}, err
+	}
+	if !amended.OrderPrice.Equal(order.OrderPrice) {
+		if err = s.checkPriceBand(ctx, symbol, rules); err != nil {
+			return entity.Order{}, err
+		}
+	}
+
+	if !amended.OrderPrice.Equal(order.OrderPrice) || amended.OrderQuantity.GreaterThan(order.OrderQuantity) {
+		amended.PriorityAt = time.Now()
+	}
+	if amended.DisplayQuantity.IsPositive() {
+		amended.VisibleQuantity = decimal.Min(amended.VisibleQuantity, amended.OrderQuantity)
+	}
+
+	if err = s.adjustLock(ctx, order, amended, symbol); err != nil {
+		return entity.Order{}, err
+	}
+	if err = s.orderRepo.UpdateOrder(ctx, amended); err != nil {
+		return entity.Order{}, err
+	}
+
+	return amended, tx.Commit()
+}
+
+// adjustLock locks or releases the difference between what the order needed
+// before and after an amend.
+func (s *OrderCreatorService) adjustLock(ctx context.Context, before, after entity.Order, symbol entity.Symbol) error {
+	asset := utils.LockedAsset(&before, symbol)
+	precision, err := repository.PrecisionOf(ctx, s.assetRepo, asset)
+	if err != nil {
+		return err
+	}
+	diff := utils.LockAmount(&after, precision).Sub(utils.LockAmount(&before, precision))
+	if diff.IsNegative() {
+		return s.locks.Release(ctx, before.ID, diff.Neg(), before.ID)
+	}
+	if diff.IsZero() {
+		return nil
+	}
+
+	user, err := s.userRepo.FindUser(ctx, before.UserID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if err = s.lockAsset(ctx, user, asset, diff, before.ID); err != nil {
+		return fmt.Errorf("failed to lock %s for amended order: %w", asset, err)
+	}
+	return nil
+}
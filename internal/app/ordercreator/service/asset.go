@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidAsset  = errors.New("an asset needs a code of 2 to 10 capital letters or digits, a name, a precision of 0 to 8 and minimums that fit it")
+	ErrAssetDisabled = errors.New("the asset does not allow this right now")
+)
+
+var assetCode = regexp.MustCompile(`^[A-Z0-9]{2,10}$`)
+
+// CreateAsset registers a new asset.
+func (s *OrderCreatorService) CreateAsset(ctx context.Context, newAsset dto.AssetDto) (entity.Asset, error) {
+	asset, err := assetFromDto(newAsset.Code, newAsset)
+	if err != nil {
+		return entity.Asset{}, err
+	}
+	return s.assetRepo.CreateAsset(ctx, asset)
+}
+
+// UpdateAsset replaces the name, precision, minimums and flags of an asset.
+// Balances already held keep their decimal places; a lower precision only
+// applies to amounts that come in afterwards.
+func (s *OrderCreatorService) UpdateAsset(ctx context.Context, code string, update dto.AssetDto) (entity.Asset, error) {
+	asset, err := assetFromDto(code, update)
+	if err != nil {
+		return entity.Asset{}, err
+	}
+	return s.assetRepo.UpdateAsset(ctx, asset)
+}
+
+func (s *OrderCreatorService) FindAllAssets(ctx context.Context) ([]entity.Asset, error) {
+	return s.assetRepo.FindAllAssets(ctx)
+}
+
+func assetFromDto(code string, asset dto.AssetDto) (entity.Asset, error) {
+	if !assetCode.MatchString(code) || strings.TrimSpace(asset.Name) == "" ||
+		asset.Precision < 0 || asset.Precision > entity.MaxAssetPrecision ||
+		asset.MinDeposit.IsNegative() || !utils.FitsPrecision(asset.MinDeposit, asset.Precision) ||
+		asset.MinWithdrawal.IsNegative() || !utils.FitsPrecision(asset.MinWithdrawal, asset.Precision) {
+		return entity.Asset{}, ErrInvalidAsset
+	}
+	return entity.Asset{
+		Code:            code,
+		Name:            strings.TrimSpace(asset.Name),
+		Precision:       asset.Precision,
+		MinDeposit:      asset.MinDeposit,
+		MinWithdrawal:   asset.MinWithdrawal,
+		DepositEnabled:  asset.DepositEnabled,
+		WithdrawEnabled: asset.WithdrawEnabled,
+		TradeEnabled:    asset.TradeEnabled,
+	}, nil
+}
+
+// checkDeposit looks the asset up and rejects a deposit of amount into it
+// unless deposits are enabled and the amount is at least the minimum deposit
+// and fits the asset's precision.
+func (s *OrderCreatorService) checkDeposit(ctx context.Context, code string, amount decimal.Decimal) error {
+	asset, err := s.assetRepo.FindAsset(ctx, code)
+	if err != nil {
+		return err
+	}
+	if !asset.DepositEnabled {
+		return fmt.Errorf("%w: deposits of %s are disabled", ErrAssetDisabled, asset.Code)
+	}
+	if !amount.IsPositive() || amount.LessThan(asset.MinDeposit) {
+		return fmt.Errorf("%w: the minimum %s deposit is %v", ErrInvalidAmount, asset.Code, asset.MinDeposit)
+	}
+	if !utils.FitsPrecision(amount, asset.Precision) {
+		return fmt.Errorf("%w: %s has %d decimal places", ErrInvalidAmount, asset.Code, asset.Precision)
+	}
+	return nil
+}
+
+// checkAssetsTradable rejects orders on a symbol either of whose assets has
+// trading disabled.
+func (s *OrderCreatorService) checkAssetsTradable(ctx context.Context, symbol entity.Symbol) error {
+	for _, code := range []string{symbol.BaseAsset, symbol.QuoteAsset} {
+		asset, err := s.assetRepo.FindAsset(ctx, code)
+		if err != nil {
+			return err
+		}
+		if !asset.TradeEnabled {
+			return fmt.Errorf("%w: trading in %s is disabled", ErrAssetDisabled, asset.Code)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+var ErrInvalidAuctionDuration = errors.New("auction duration must be positive")
+
+// StartAuction puts a symbol into a call auction for the given duration.
+// Orders keep collecting and the orderchecker uncrosses the book once the
+// auction ends.
+func (s *OrderCreatorService) StartAuction(ctx context.Context, symbolName string, auction dto.AuctionDto) (entity.Auction, error) {
+	if auction.DurationSeconds <= 0 {
+		return entity.Auction{}, ErrInvalidAuctionDuration
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Auction{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	symbol, err := s.symbolRepo.FindSymbol(ctx, symbolName)
+	if err != nil {
+		return entity.Auction{}, err
+	}
+
+	now := time.Now()
+	newAuction := entity.Auction{
+		ID:        uuid.New(),
+		Symbol:    symbol.Name,
+		Reason:    auction.Reason,
+		StartedAt: now,
+		EndsAt:    now.Add(time.Duration(auction.DurationSeconds) * time.Second),
+	}
+	if err = s.auctionRepo.CreateAuction(ctx, newAuction); err != nil {
+		return entity.Auction{}, err
+	}
+
+	return newAuction, tx.Commit()
+}
+
+// FindAuction returns the running or most recent auction of a symbol with
+// its indicative or clearing price and volume.
+func (s *OrderCreatorService) FindAuction(ctx context.Context, symbolName string) (entity.Auction, error) {
+	return s.auctionRepo.FindLatestAuction(ctx, symbolName)
+}
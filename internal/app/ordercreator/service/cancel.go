@@ -0,0 +1,93 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+var ErrOrderNotCancellable = errors.New("the order is already filled or cancelled")
+
+// CancelOrder cancels an open order and returns what is left of its lock to
+// the user's available balance. The order row is locked first, so a match
+// the orderchecker is persisting for it either commits before the remainder
+// is read or is rolled back because the order is gone.
+func (s *OrderCreatorService) CancelOrder(ctx context.Context, orderID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	order, err := s.orderRepo.FindOrderForUpdate(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if !order.OrderStatus || order.DeletedAt.Valid {
+		return ErrOrderNotCancellable
+	}
+	if err = s.cancelOrder(ctx, order); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CancelAllOrders cancels every open order of the user, or only those of one
+// symbol and/or side, in one transaction. It returns how many orders were
+// cancelled.
+func (s *OrderCreatorService) CancelAllOrders(ctx context.Context, userID uuid.UUID, filter dto.CancelAllDto) (int, error) {
+	if filter.Side != "" {
+		if err := utils.ValidateOrderType(utils.OrderType(filter.Side)); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	orders, err := s.orderRepo.FindOpenOrdersForUpdate(ctx, userID, filter.Symbol, filter.Side)
+	if err != nil {
+		return 0, err
+	}
+	cancelled := 0
+	ocoGroups := make(map[uuid.UUID]bool)
+	for _, order := range orders {
+		if order.OcoGroupID != nil {
+			if ocoGroups[*order.OcoGroupID] {
+				continue
+			}
+			ocoGroups[*order.OcoGroupID] = true
+		}
+		if err = s.cancelOrder(ctx, order); err != nil {
+			return 0, err
+		}
+		cancelled++
+	}
+
+	return cancelled, tx.Commit()
+}
+
+// cancelOrder cancels an open order locked for update and releases what is
+// left of its lock. Cancelling a leg of an OCO pair cancels the whole pair.
+func (s *OrderCreatorService) cancelOrder(ctx context.Context, order entity.Order) error {
+	if order.OcoGroupID != nil {
+		return s.cancelOcoGroup(ctx, *order.OcoGroupID)
+	}
+
+	if err := s.orderRepo.SoftDeleteOrder(ctx, order.ID); err != nil {
+		return err
+	}
+	return s.locks.ReleaseRemainder(ctx, order.ID, order.ID)
+}
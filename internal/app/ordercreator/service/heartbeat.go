@@ -0,0 +1,37 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var ErrInvalidHeartbeatTimeout = errors.New("heartbeat timeout must not be negative")
+
+// Heartbeat arms the user's dead-man's switch or pushes it further out. The
+// orderchecker cancels all open orders of a user whose switch runs out. A
+// zero timeout disarms the switch.
+func (s *OrderCreatorService) Heartbeat(ctx context.Context, userID uuid.UUID, heartbeat dto.HeartbeatDto) (entity.Heartbeat, error) {
+	if heartbeat.TimeoutSeconds < 0 {
+		return entity.Heartbeat{}, ErrInvalidHeartbeatTimeout
+	}
+	if heartbeat.TimeoutSeconds == 0 {
+		return entity.Heartbeat{UserID: userID}, s.heartbeatRepo.DeleteHeartbeat(ctx, userID)
+	}
+
+	if _, err := s.userRepo.FindUser(ctx, userID); err != nil {
+		return entity.Heartbeat{}, err
+	}
+	saved := entity.Heartbeat{
+		UserID:         userID,
+		TimeoutSeconds: heartbeat.TimeoutSeconds,
+		ExpiresAt:      time.Now().Add(time.Duration(heartbeat.TimeoutSeconds) * time.Second),
+	}
+	if err := s.heartbeatRepo.SaveHeartbeat(ctx, saved); err != nil {
+		return entity.Heartbeat{}, err
+	}
+	return saved, nil
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/ledger"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// FindLedgerEntries returns the journal entries of a user, newest first.
+func (s *OrderCreatorService) FindLedgerEntries(ctx context.Context, userID uuid.UUID) ([]entity.LedgerEntry, error) {
+	return s.ledgerRepo.FindEntries(ctx, userID)
+}
+
+// VerifyLedger rebuilds every balance and lock from the journal and returns
+// those that differ from what is stored. Both are read from one snapshot so
+// a movement in flight does not show up as a mismatch.
+func (s *OrderCreatorService) VerifyLedger(ctx context.Context) ([]ledger.Mismatch, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	return s.ledgerRepo.FindMismatches(context.WithValue(ctx, "tx", tx))
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"strings"
+)
+
+// MigrateLegacyLocks replaces the locks taken before locks were per order,
+// which pool the funds of all of a user's orders in one asset, with one lock
+// per open order. The pooled funds go back to the available balance and
+// each open order locks what its remainder needs. An order whose owner can
+// no longer cover it is logged and left without a lock. It does nothing once
+// no pooled locks are left, and has to run before the order checker settles
+// fills of those orders.
+func (s *OrderCreatorService) MigrateLegacyLocks(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	legacy, err := s.lockRepo.FindLegacyLocks(ctx)
+	if err != nil {
+		return err
+	}
+	users := make(map[uuid.UUID]bool)
+	for _, lock := range legacy {
+		users[lock.UserID] = true
+		// the journal names assets in upper case, as the opening did
+		lock.Asset = strings.ToUpper(lock.Asset)
+		if err = s.locks.Unlock(ctx, lock, lock.Amount, lock.ID); err != nil {
+			return fmt.Errorf("failed to release legacy lock %s: %w", lock.ID, err)
+		}
+	}
+	for userID := range users {
+		if err = s.lockOpenOrders(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// lockOpenOrders locks the remainder of each of the user's open orders that
+// holds no lock of its own, once per OCO pair.
+func (s *OrderCreatorService) lockOpenOrders(ctx context.Context, userID uuid.UUID) error {
+	orders, err := s.orderRepo.FindOpenOrdersForUpdate(ctx, userID, "", "")
+	if err != nil {
+		return err
+	}
+	required := make(map[uuid.UUID]decimal.Decimal)
+	assets := make(map[uuid.UUID]string)
+	for _, order := range orders {
+		symbol, err := s.symbolRepo.FindSymbol(ctx, order.Asset)
+		if err != nil {
+			return err
+		}
+		lockID := utils.LockID(&order)
+		required[lockID] = decimal.Max(required[lockID], utils.LockRequirement(&order))
+		assets[lockID] = utils.LockedAsset(&order, symbol)
+	}
+
+	user := entity.Users{ID: userID}
+	for lockID, amount := range required {
+		_, err = s.lockRepo.FindLock(ctx, lockID)
+		if err == nil || !amount.IsPositive() {
+			continue
+		}
+		if !errors.Is(err, repository.ErrLockNotFound) {
+			return err
+		}
+		err = s.lockAsset(ctx, user, assets[lockID], amount, lockID)
+		if errors.Is(err, ErrInsufficientBalance) {
+			log.Printf("could not lock %v %s for order %s of user %s: %v", amount, assets[lockID], lockID, userID, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
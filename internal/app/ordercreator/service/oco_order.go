@@ -0,0 +1,194 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidOcoOrder  = errors.New("an OCO pair needs a GTC take-profit limit order and a stop-loss stop order")
+	ErrOcoOrderNotFound = errors.New("OCO order not found")
+)
+
+// CreateOcoOrder stores a take-profit limit order and a stop-loss order as
+// one linked pair and returns the pair's ID. Both legs share a single lock
+// sized for the larger leg.
+func (s *OrderCreatorService) CreateOcoOrder(newOrder dto.OcoOrderDto) (uuid.UUID, error) {
+	ctx := context.Background()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	groupID, err := s.createOcoOrderWithContext(ctx, newOrder)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return groupID, tx.Commit()
+}
+
+func (s *OrderCreatorService) createOcoOrderWithContext(ctx context.Context, newOrder dto.OcoOrderDto) (uuid.UUID, error) {
+	if err := utils.ValidateOrderType(utils.OrderType(newOrder.Type)); err != nil {
+		return uuid.Nil, err
+	}
+	if err := utils.ValidateSelfTradePrevention(newOrder.SelfTradePrevention); err != nil {
+		return uuid.Nil, err
+	}
+
+	takeProfit, stopLoss := newOrder.TakeProfit, newOrder.StopLoss
+	for _, leg := range []*dto.OrderDto{&takeProfit, &stopLoss} {
+		leg.UserID = newOrder.UserID
+		leg.Asset = newOrder.Asset
+		leg.Type = newOrder.Type
+		leg.SelfTradePrevention = newOrder.SelfTradePrevention
+	}
+	if takeProfit.Kind == "" {
+		takeProfit.Kind = utils.LimitOrder
+	}
+	if takeProfit.Kind != utils.LimitOrder || takeProfit.PostOnly || !takeProfit.DisplayQuantity.IsZero() ||
+		(stopLoss.Kind != utils.StopMarketOrder && stopLoss.Kind != utils.StopLimitOrder) {
+		return uuid.Nil, ErrInvalidOcoOrder
+	}
+	for _, leg := range []*dto.OrderDto{&takeProfit, &stopLoss} {
+		if err := resolveTimeInForce(leg); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	if takeProfit.TimeInForce != utils.GoodTillCancel {
+		return uuid.Nil, ErrInvalidOcoOrder
+	}
+	if !takeProfit.OrderPrice.IsPositive() || !takeProfit.OrderQuantity.IsPositive() {
+		return uuid.Nil, ErrInvalidOrderPriceOrQuantity
+	}
+
+	symbol, err := s.findSymbol(ctx, &newOrder.Asset)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err = s.checkAssetsTradable(ctx, symbol); err != nil {
+		return uuid.Nil, err
+	}
+	for _, leg := range []dto.OrderDto{takeProfit, stopLoss} {
+		if err = checkSymbolStatus(symbol, leg); err != nil {
+			return uuid.Nil, err
+		}
+		if err = checkTradingRules(symbol, leg); err != nil {
+			return uuid.Nil, err
+		}
+		if err = s.checkPriceBand(ctx, symbol, leg); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	user, err := s.userRepo.FindUser(ctx, newOrder.UserID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	groupID := uuid.New()
+	takeProfitOrder := entity.Order{
+		ID:                  uuid.New(),
+		Asset:               symbol.Name,
+		Kind:                utils.LimitOrder,
+		TimeInForce:         utils.GoodTillCancel,
+		OrderPrice:          takeProfit.OrderPrice,
+		OrderQuantity:       takeProfit.OrderQuantity,
+		OrderStatus:         true,
+		UserID:              newOrder.UserID,
+		Type:                newOrder.Type,
+		OcoGroupID:          &groupID,
+		SelfTradePrevention: selfTradePrevention(newOrder.SelfTradePrevention, user),
+		User:                user,
+	}
+	stopLossOrder, err := buildStopOrder(stopLoss, user)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err = checkStopNotional(symbol, stopLossOrder); err != nil {
+		return uuid.Nil, err
+	}
+	stopLossOrder.Asset = symbol.Name
+	stopLossOrder.OcoGroupID = &groupID
+
+	// lock once, for whichever leg needs more
+	lockedFor := takeProfitOrder
+	if utils.LockRequirement(&stopLossOrder).GreaterThan(utils.LockRequirement(&takeProfitOrder)) {
+		lockedFor = stopLossOrder
+	}
+	if err = s.lockOrderFunds(ctx, user, lockedFor, symbol); err != nil {
+		return uuid.Nil, err
+	}
+
+	for _, order := range []entity.Order{takeProfitOrder, stopLossOrder} {
+		if _, err = s.orderRepo.CreateOrder(ctx, order); err != nil {
+			return uuid.Nil, fmt.Errorf("could not create OCO order: %w", err)
+		}
+	}
+	return groupID, nil
+}
+
+// FindOcoOrder returns both legs of an OCO pair.
+func (s *OrderCreatorService) FindOcoOrder(ctx context.Context, groupID uuid.UUID) ([]entity.Order, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	orders, err := s.orderRepo.FindOrdersByOcoGroup(context.WithValue(ctx, "tx", tx), groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrOcoOrderNotFound
+	}
+	return orders, nil
+}
+
+// CancelOcoOrder cancels every open leg of an OCO pair and releases what is
+// left of their shared lock.
+func (s *OrderCreatorService) CancelOcoOrder(ctx context.Context, groupID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	if err = s.cancelOcoGroup(ctx, groupID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *OrderCreatorService) cancelOcoGroup(ctx context.Context, groupID uuid.UUID) error {
+	orders, err := s.orderRepo.FindOrdersByOcoGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return ErrOcoOrderNotFound
+	}
+
+	for _, order := range orders {
+		if !order.OrderStatus || order.DeletedAt.Valid {
+			continue
+		}
+		if err = s.orderRepo.SoftDeleteOrder(ctx, order.ID); err != nil {
+			return err
+		}
+	}
+	// the legs share one lock, which nothing holds open any more
+	return s.locks.ReleaseRemainder(ctx, groupID, groupID)
+}
@@ -4,6 +4,8 @@ import (
 	"bitcoinOrder/internal/common/dto"
 	"bitcoinOrder/internal/domain/entity"
 	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/ledger"
 	"bitcoinOrder/pkg/utils"
 	"context"
 	"database/sql"
@@ -11,114 +13,242 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"time"
 )
 
 type OrderCreatorService struct {
-	orderRepo repository.IOrderRepository
-	userRepo  repository.IUserRepository
-	lockRepo  repository.ILockRepository
-	gormDB    *gorm.DB
-	db        *sql.DB
+	orderRepo     repository.IOrderRepository
+	userRepo      repository.IUserRepository
+	lockRepo      repository.ILockRepository
+	balanceRepo   repository.IBalanceRepository
+	assetRepo     repository.IAssetRepository
+	symbolRepo    repository.ISymbolRepository
+	auctionRepo   repository.IAuctionRepository
+	heartbeatRepo repository.IHeartbeatRepository
+	ledgerRepo    repository.ILedgerRepository
+	locks         *repository.LockReleaser
+	gormDB        *gorm.DB
+	db            *sql.DB
 }
 
 func NewOrderCreatorService(
 	orderRepo repository.IOrderRepository,
 	userRepo repository.IUserRepository,
 	lockRepo repository.ILockRepository,
+	balanceRepo repository.IBalanceRepository,
+	assetRepo repository.IAssetRepository,
+	symbolRepo repository.ISymbolRepository,
+	auctionRepo repository.IAuctionRepository,
+	heartbeatRepo repository.IHeartbeatRepository,
+	ledgerRepo repository.ILedgerRepository,
 	gormDB *gorm.DB, db *sql.DB) *OrderCreatorService {
 	return &OrderCreatorService{
-		orderRepo: orderRepo,
-		userRepo:  userRepo,
-		lockRepo:  lockRepo,
-		gormDB:    gormDB,
-		db:        db,
+		orderRepo:     orderRepo,
+		userRepo:      userRepo,
+		lockRepo:      lockRepo,
+		balanceRepo:   balanceRepo,
+		assetRepo:     assetRepo,
+		symbolRepo:    symbolRepo,
+		auctionRepo:   auctionRepo,
+		heartbeatRepo: heartbeatRepo,
+		ledgerRepo:    ledgerRepo,
+		locks:         repository.NewLockReleaser(lockRepo, balanceRepo, assetRepo, ledgerRepo),
+		gormDB:        gormDB,
+		db:            db,
 	}
 }
 
 type IOrderCreatorService interface {
-	CreateOrder(newOrder dto.OrderDto) error
+	CreateOrder(newOrder dto.OrderDto) (uuid.UUID, error)
+	AmendOrder(ctx context.Context, orderID uuid.UUID, amend dto.AmendOrderDto) (entity.Order, error)
+	CancelOrder(ctx context.Context, orderID uuid.UUID) error
+	CancelAllOrders(ctx context.Context, userID uuid.UUID, filter dto.CancelAllDto) (int, error)
+	Heartbeat(ctx context.Context, userID uuid.UUID, heartbeat dto.HeartbeatDto) (entity.Heartbeat, error)
+	CreateOcoOrder(newOrder dto.OcoOrderDto) (uuid.UUID, error)
+	FindOcoOrder(ctx context.Context, groupID uuid.UUID) ([]entity.Order, error)
+	CancelOcoOrder(ctx context.Context, groupID uuid.UUID) error
+	UpdateSelfTradePrevention(ctx context.Context, userID uuid.UUID, mode string) error
 	CreateUser(newUser dto.UserDto) (entity.Users, error)
 	FindAllOrder(ctx context.Context) ([]entity.Order, error)
-	GetBalance(id uuid.UUID) (dto.UserDto, error)
+	GetBalance(id uuid.UUID) (dto.UserBalancesDto, error)
 	AddBalance(ctx context.Context, balance dto.BalanceDto) error
 	FindAllUser() ([]entity.Users, error)
 	FindUser(ctx context.Context, userID uuid.UUID) (entity.Users, error)
+	FindAllSymbols(ctx context.Context) ([]entity.Symbol, error)
+	CreateAsset(ctx context.Context, newAsset dto.AssetDto) (entity.Asset, error)
+	UpdateAsset(ctx context.Context, code string, update dto.AssetDto) (entity.Asset, error)
+	FindAllAssets(ctx context.Context) ([]entity.Asset, error)
+	StartAuction(ctx context.Context, symbol string, auction dto.AuctionDto) (entity.Auction, error)
+	FindAuction(ctx context.Context, symbol string) (entity.Auction, error)
+	UpdateSymbolStatus(ctx context.Context, symbol string, status dto.SymbolStatusDto) (entity.SymbolStatusChange, error)
+	FindSymbolStatusChanges(ctx context.Context, symbol string) ([]entity.SymbolStatusChange, error)
+	FindLedgerEntries(ctx context.Context, userID uuid.UUID) ([]entity.LedgerEntry, error)
+	VerifyLedger(ctx context.Context) ([]ledger.Mismatch, error)
 }
 
-var ErrInvalidOrderPriceOrQuantity = errors.New("invalid order price or quantity")
+var (
+	ErrInvalidOrderPriceOrQuantity = errors.New("invalid order price or quantity")
+	ErrInvalidMarketOrderAmount    = errors.New("market buy needs a positive quote amount and market sell a positive quantity")
+	ErrInvalidSlippage             = errors.New("max slippage must be between 0 and 1")
+	ErrInvalidAmount               = errors.New("amount is not valid for its asset")
+	ErrInsufficientBalance         = errors.New("insufficient balance")
+	ErrNoLiquidity                 = errors.New("no opposite orders to execute the market order against")
+	ErrMarketOrderTimeInForce      = errors.New("market orders can only be IOC or FOK")
+	ErrInvalidExpiry               = errors.New("GTD orders need an expiry in the future and other orders none")
+	ErrInvalidPostOnly             = errors.New("post-only orders must be GTC or GTD limit orders")
+	ErrInvalidTriggerPrice         = errors.New("stop orders need a positive trigger price")
+	ErrInvalidTrailingOffset       = errors.New("trailing stops need either a positive trailing amount or a trailing percent between 0 and 100")
+	ErrInvalidDisplayQuantity      = errors.New("iceberg orders must be GTC or GTD limit orders showing less than their quantity")
+)
 
-func (s *OrderCreatorService) CreateOrder(newOrder dto.OrderDto) error {
+// CreateOrder stores a new order and returns its ID.
+func (s *OrderCreatorService) CreateOrder(newOrder dto.OrderDto) (uuid.UUID, error) {
 	ctx := context.Background()
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+		return uuid.Nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	ctx = context.WithValue(ctx, "tx", tx)
 
-	if err = s.createOrderWithContext(ctx, newOrder); err != nil {
-		return err
+	orderID, err := s.createOrderWithContext(ctx, newOrder)
+	if err != nil {
+		return uuid.Nil, err
 	}
 
-	return tx.Commit()
+	return orderID, tx.Commit()
 }
 
-func (s *OrderCreatorService) createOrderWithContext(ctx context.Context, newOrder dto.OrderDto) error {
-	if newOrder.OrderPrice <= 0 || newOrder.OrderQuantity <= 0 {
-		return ErrInvalidOrderPriceOrQuantity
+func (s *OrderCreatorService) createOrderWithContext(ctx context.Context, newOrder dto.OrderDto) (uuid.UUID, error) {
+	if newOrder.Kind == "" {
+		newOrder.Kind = utils.LimitOrder
+	}
+	if err := utils.ValidateOrderKind(newOrder.Kind); err != nil {
+		return uuid.Nil, err
+	}
+	if err := resolveTimeInForce(&newOrder); err != nil {
+		return uuid.Nil, err
+	}
+	if err := utils.ValidateSelfTradePrevention(newOrder.SelfTradePrevention); err != nil {
+		return uuid.Nil, err
+	}
+	if newOrder.PostOnly && (newOrder.Kind != utils.LimitOrder ||
+		newOrder.TimeInForce == utils.ImmediateOrCancel || newOrder.TimeInForce == utils.FillOrKill) {
+		return uuid.Nil, ErrInvalidPostOnly
+	}
+	if !newOrder.DisplayQuantity.IsZero() && (newOrder.Kind != utils.LimitOrder ||
+		newOrder.TimeInForce == utils.ImmediateOrCancel || newOrder.TimeInForce == utils.FillOrKill ||
+		newOrder.DisplayQuantity.IsNegative() || newOrder.DisplayQuantity.GreaterThanOrEqual(newOrder.OrderQuantity)) {
+		return uuid.Nil, ErrInvalidDisplayQuantity
+	}
+	symbol, err := s.findSymbol(ctx, &newOrder.Asset)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err = checkSymbolStatus(symbol, newOrder); err != nil {
+		return uuid.Nil, err
+	}
+	if err = s.checkAssetsTradable(ctx, symbol); err != nil {
+		return uuid.Nil, err
+	}
+	if err = checkTradingRules(symbol, newOrder); err != nil {
+		return uuid.Nil, err
+	}
+	if err = s.checkPriceBand(ctx, symbol, newOrder); err != nil {
+		return uuid.Nil, err
+	}
+	switch newOrder.Kind {
+	case utils.MarketOrder:
+		return s.createMarketOrder(ctx, newOrder, symbol)
+	case utils.StopMarketOrder, utils.StopLimitOrder:
+		return s.createStopOrder(ctx, newOrder, symbol)
+	case utils.TrailingStop:
+		return s.createTrailingStopOrder(ctx, newOrder, symbol)
+	}
+
+	if !newOrder.OrderPrice.IsPositive() || !newOrder.OrderQuantity.IsPositive() {
+		return uuid.Nil, ErrInvalidOrderPriceOrQuantity
 	}
 	if err := utils.ValidateOrderType(utils.OrderType(newOrder.Type)); err != nil {
 
-		return err
+		return uuid.Nil, err
 	}
 	user, err := s.userRepo.FindUser(ctx, newOrder.UserID)
 
 	if err != nil {
 
-		return fmt.Errorf("user not found: %w", err)
+		return uuid.Nil, fmt.Errorf("user not found: %w", err)
 	}
+	newOrder.SelfTradePrevention = selfTradePrevention(newOrder.SelfTradePrevention, user)
 
+	orderID := uuid.New()
 	switch newOrder.Type {
 	case "buy":
-		if err = s.lockUSDTForBuyOrder(ctx, user, newOrder.OrderPrice*newOrder.OrderQuantity); err != nil {
-			return fmt.Errorf("failed to lock USDT for buy order: %w", err)
+		if err = s.lockAsset(ctx, user, symbol.QuoteAsset, newOrder.OrderPrice.MustMul(newOrder.OrderQuantity), orderID); err != nil {
+			return uuid.Nil, fmt.Errorf("failed to lock %s for buy order: %w", symbol.QuoteAsset, err)
 		}
 	case "sell":
-		if err = s.lockBTCForSellOrder(ctx, user, newOrder.OrderQuantity); err != nil {
+		if err = s.lockAsset(ctx, user, symbol.BaseAsset, newOrder.OrderQuantity, orderID); err != nil {
 
-			return fmt.Errorf("failed to lock BTC for sell order: %w", err)
+			return uuid.Nil, fmt.Errorf("failed to lock %s for sell order: %w", symbol.BaseAsset, err)
 		}
 	default:
-		return fmt.Errorf("invalid order type: %s", newOrder.Type)
+		return uuid.Nil, fmt.Errorf("invalid order type: %s", newOrder.Type)
 	}
 
-	openOrders, err := s.orderRepo.FindOpenOrdersByUser(ctx, newOrder.UserID)
-	if err != nil {
-
-		return fmt.Errorf("open orders not found %w", err)
+	if err = s.createNewOrder(ctx, user, newOrder, orderID); err != nil {
+		return uuid.Nil, fmt.Errorf("could not create new order: %w", err)
 	}
+	return orderID, nil
+}
 
-	existingOrder := s.findExistingOrder(openOrders, newOrder)
-
-	if existingOrder != nil {
-		err = s.updateExistingOrder(ctx, user, existingOrder, newOrder)
-		if err != nil {
+// findSymbol looks up the symbol an order trades on, defaulting an empty
+// name to the original BTC/USDT market.
+func (s *OrderCreatorService) findSymbol(ctx context.Context, name *string) (entity.Symbol, error) {
+	if *name == "" {
+		*name = utils.DefaultSymbol
+	}
+	return s.symbolRepo.FindSymbol(ctx, *name)
+}
 
-			return fmt.Errorf("failed to update existing order: %w", err)
+// resolveTimeInForce defaults the time in force to GTC for limit and IOC for
+// market orders and checks that only GTD orders carry an expiry.
+func resolveTimeInForce(newOrder *dto.OrderDto) error {
+	isMarket := utils.ExecutesAsMarket(newOrder.Kind)
+	if newOrder.TimeInForce == "" {
+		newOrder.TimeInForce = utils.GoodTillCancel
+		if isMarket {
+			newOrder.TimeInForce = utils.ImmediateOrCancel
 		}
-	} else {
-		err = s.createNewOrder(ctx, user, openOrders, newOrder)
-		if err != nil {
-
-			return fmt.Errorf("could not create new order: %w", err)
+	}
+	if err := utils.ValidateTimeInForce(newOrder.TimeInForce); err != nil {
+		return err
+	}
+	if isMarket &&
+		newOrder.TimeInForce != utils.ImmediateOrCancel && newOrder.TimeInForce != utils.FillOrKill {
+		return ErrMarketOrderTimeInForce
+	}
+	if newOrder.TimeInForce == utils.GoodTillDate {
+		if newOrder.ExpiresAt == nil || !newOrder.ExpiresAt.After(time.Now()) {
+			return ErrInvalidExpiry
 		}
+	} else if newOrder.ExpiresAt != nil {
+		return ErrInvalidExpiry
 	}
-
 	return nil
 }
 
+// selfTradePrevention picks the mode of an order: the one it asks for, or the
+// default of its account.
+func selfTradePrevention(mode string, user entity.Users) string {
+	if mode != "" {
+		return mode
+	}
+	return user.SelfTradePrevention
+}
+
 func (s *OrderCreatorService) fetchUserData(ctx context.Context, userID uuid.UUID) (entity.Users, []entity.Order, error) {
 	user, err := s.FindUser(ctx, userID)
 	if err != nil {
@@ -133,170 +263,252 @@ func (s *OrderCreatorService) fetchUserData(ctx context.Context, userID uuid.UUI
 	return user, openOrders, nil
 }
 
-func (s *OrderCreatorService) findExistingOrder(openOrders []entity.Order, newOrder dto.OrderDto) *entity.Order {
-	for _, order := range openOrders {
-		if order.Type == newOrder.Type && order.OrderPrice == newOrder.OrderPrice && order.OrderStatus {
-			return &order
-		}
+// createNewOrder stores a limit order whose funds have already been locked
+// in the asset of its symbol.
+func (s *OrderCreatorService) createNewOrder(ctx context.Context, user entity.Users, newOrder dto.OrderDto, orderID uuid.UUID) error {
+	orderEntity := entity.Order{
+		ID:                  orderID,
+		Asset:               newOrder.Asset,
+		Kind:                utils.LimitOrder,
+		TimeInForce:         newOrder.TimeInForce,
+		ExpiresAt:           newOrder.ExpiresAt,
+		PostOnly:            newOrder.PostOnly,
+		RepriceOnCross:      newOrder.RepriceOnCross,
+		DisplayQuantity:     newOrder.DisplayQuantity,
+		VisibleQuantity:     newOrder.DisplayQuantity,
+		SelfTradePrevention: selfTradePrevention(newOrder.SelfTradePrevention, user),
+		OrderPrice:          newOrder.OrderPrice,
+		OrderQuantity:       newOrder.OrderQuantity,
+		OrderStatus:         newOrder.OrderStatus,
+		UserID:              newOrder.UserID,
+		Type:                newOrder.Type,
+		User:                user,
 	}
-	return nil
+	_, err := s.orderRepo.CreateOrder(ctx, orderEntity)
+	return err
 }
 
-func (s *OrderCreatorService) updateExistingOrder(ctx context.Context, user entity.Users, existingOrder *entity.Order, newOrder dto.OrderDto) error {
-	if newOrder.Type == "buy" {
-		if newOrder.OrderQuantity*newOrder.OrderPrice > *user.UsdtBalance-existingOrder.OrderPrice*existingOrder.OrderQuantity {
-			return errors.New("insufficient usdt balance for this order")
-		}
-		*user.UsdtBalance -= newOrder.OrderQuantity * newOrder.OrderPrice
-	} else {
-		if newOrder.OrderQuantity+existingOrder.OrderQuantity > *user.BtcBalance {
-			return errors.New("insufficient BTC balance for this order")
-		}
-		*user.BtcBalance -= newOrder.OrderQuantity
+// createMarketOrder stores a market order for the orderchecker to execute,
+// protected by a slippage cap measured from the current best opposite price.
+func (s *OrderCreatorService) createMarketOrder(ctx context.Context, newOrder dto.OrderDto, symbol entity.Symbol) (uuid.UUID, error) {
+	if err := utils.ValidateOrderType(utils.OrderType(newOrder.Type)); err != nil {
+		return uuid.Nil, err
 	}
 
-	existingOrder.OrderQuantity += newOrder.OrderQuantity
-	if err := s.orderRepo.UpdateOrder(ctx, *existingOrder); err != nil {
-		return err
+	user, err := s.userRepo.FindUser(ctx, newOrder.UserID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("user not found: %w", err)
 	}
 
-	return nil
-}
-
-func (s *OrderCreatorService) createNewOrder(ctx context.Context, user entity.Users, openOrders []entity.Order, newOrder dto.OrderDto) error {
-	if newOrder.Type == "buy" {
-		totalOpenBuyValue := 0.0
-		for _, order := range openOrders {
-			if order.Type == "buy" && order.OrderStatus {
-				totalOpenBuyValue += order.OrderPrice * order.OrderQuantity
-			}
-		}
-		if newOrder.OrderQuantity*newOrder.OrderPrice > *user.UsdtBalance-totalOpenBuyValue {
-			return errors.New("insufficient usdt balance for this order")
-		}
-		*user.UsdtBalance -= newOrder.OrderQuantity * newOrder.OrderPrice
-	} else {
-		if newOrder.OrderQuantity > *user.BtcBalance {
-			return errors.New("insufficient BTC balance for this order")
-		}
-		*user.BtcBalance -= newOrder.OrderQuantity
+	opposite := utils.SellOrder
+	if newOrder.Type == utils.SellOrder {
+		opposite = utils.BuyOrder
+	}
+	bestPrice, ok, err := s.orderRepo.FindBestPrice(ctx, symbol.Name, opposite)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !ok {
+		return uuid.Nil, ErrNoLiquidity
 	}
 
 	orderEntity := entity.Order{
-		ID:            uuid.New(),
-		Asset:         newOrder.Asset,
-		OrderPrice:    newOrder.OrderPrice,
-		OrderQuantity: newOrder.OrderQuantity,
-		OrderStatus:   newOrder.OrderStatus,
-		UserID:        newOrder.UserID,
-		Type:          newOrder.Type,
-		User:          user,
+		ID:                  uuid.New(),
+		Asset:               newOrder.Asset,
+		Kind:                utils.MarketOrder,
+		TimeInForce:         newOrder.TimeInForce,
+		SelfTradePrevention: selfTradePrevention(newOrder.SelfTradePrevention, user),
+		OrderStatus:         true,
+		UserID:              newOrder.UserID,
+		Type:                newOrder.Type,
+		User:                user,
 	}
-	_, err := s.orderRepo.CreateOrder(ctx, orderEntity)
+	if err = sizeMarketOrder(&orderEntity, newOrder, bestPrice); err != nil {
+		return uuid.Nil, err
+	}
+	notional, err := marketNotional(orderEntity, bestPrice)
 	if err != nil {
-		return err
+		return uuid.Nil, err
+	}
+	if err = checkNotional(symbol, notional); err != nil {
+		return uuid.Nil, err
+	}
+	if err = s.lockOrderFunds(ctx, user, orderEntity, symbol); err != nil {
+		return uuid.Nil, err
 	}
 
-	return nil
-
+	if _, err = s.orderRepo.CreateOrder(ctx, orderEntity); err != nil {
+		return uuid.Nil, fmt.Errorf("could not create market order: %w", err)
+	}
+	return orderEntity.ID, nil
 }
 
-func (s *OrderCreatorService) lockUSDTForBuyOrder(ctx context.Context, user entity.Users, amount float64) error {
-	currentUSDTBalance, err := s.lockRepo.GetUserBalance(ctx, user.ID, "USDT")
-	if err != nil {
-		return fmt.Errorf("failed to get USDT balance: %w", err)
+// sizeMarketOrder sizes a market order: a market buy by the USDT amount it
+// may spend and a market sell by the BTC quantity it sells. The order price
+// is set to the worst price the slippage cap allows away from the reference
+// price.
+func sizeMarketOrder(order *entity.Order, newOrder dto.OrderDto, referencePrice decimal.Decimal) error {
+	slippage := newOrder.MaxSlippage
+	if slippage.IsZero() {
+		slippage = utils.DefaultMaxSlippage
+	}
+	if slippage.IsNegative() || slippage.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return ErrInvalidSlippage
 	}
 
-	if currentUSDTBalance >= amount {
-		if err := s.lockRepo.DecreaseUserBalance(ctx, user.ID, "USDT", amount); err != nil {
-			return fmt.Errorf("failed to decrease USDT balance: %w", err)
-		}
-
-		newLock := entity.Lock{
-			UserID: user.ID,
-			Asset:  "USDT",
-			Amount: amount,
-		}
-		if err := s.lockRepo.CreateLock(ctx, newLock); err != nil {
-			return fmt.Errorf("failed to create lock: %w", err)
+	if newOrder.Type == utils.BuyOrder {
+		if !newOrder.QuoteAmount.IsPositive() {
+			return ErrInvalidMarketOrderAmount
 		}
+		order.QuoteAmount = newOrder.QuoteAmount
+		order.OrderPrice = referencePrice.Add(referencePrice.MustMul(slippage))
 		return nil
-	} else {
-		return fmt.Errorf("insufficient USDT balance: %v", user.ID)
 	}
+
+	if !newOrder.OrderQuantity.IsPositive() {
+		return ErrInvalidMarketOrderAmount
+	}
+	order.OrderQuantity = newOrder.OrderQuantity
+	order.OrderPrice = referencePrice.Sub(referencePrice.MustMul(slippage))
+	return nil
+}
+
+// marketNotional is the value of a market order: the quote amount a market
+// buy spends, or what a market sell is worth at the reference price.
+func marketNotional(order entity.Order, referencePrice decimal.Decimal) (decimal.Decimal, error) {
+	if utils.IsQuoteSized(&order) {
+		return order.QuoteAmount, nil
+	}
+	return orderValue(referencePrice, order.OrderQuantity)
+}
+
+// lockOrderFunds locks what the order needs: the quote asset of its symbol
+// for a buy and the base asset for a sell.
+func (s *OrderCreatorService) lockOrderFunds(ctx context.Context, user entity.Users, order entity.Order, symbol entity.Symbol) error {
+	asset := utils.LockedAsset(&order, symbol)
+	if err := s.lockAsset(ctx, user, asset, utils.LockRequirement(&order), utils.LockID(&order)); err != nil {
+		return fmt.Errorf("failed to lock %s for %s order: %w", asset, order.Type, err)
+	}
+	return nil
 }
 
-func (s *OrderCreatorService) lockBTCForSellOrder(ctx context.Context, user entity.Users, amount float64) error {
-	currentBTCBalance, err := s.lockRepo.GetUserBalance(ctx, user.ID, "BTC")
+// lockAsset moves amount of the asset from the user's available balance to
+// the lock kept under lockID, the order's or its OCO pair's.
+func (s *OrderCreatorService) lockAsset(ctx context.Context, user entity.Users, asset string, amount decimal.Decimal, lockID uuid.UUID) error {
+	precision, err := repository.PrecisionOf(ctx, s.assetRepo, asset)
+	if err != nil {
+		return err
+	}
+	amount = amount.RoundUp(precision)
+	currentBalance, err := s.balanceRepo.GetAvailable(ctx, user.ID, asset)
 	if err != nil {
-		return fmt.Errorf("failed to get BTC balance: %w", err)
+		return fmt.Errorf("failed to get %s balance: %w", asset, err)
 	}
 
-	if currentBTCBalance >= amount {
-		if err := s.lockRepo.DecreaseUserBalance(ctx, user.ID, "BTC", amount); err != nil {
-			return fmt.Errorf("failed to decrease BTC balance: %w", err)
+	if currentBalance.GreaterThanOrEqual(amount) {
+		if err := s.balanceRepo.Lock(ctx, user.ID, asset, amount); err != nil {
+			return err
 		}
 
 		newLock := entity.Lock{
-			UserID: user.ID,
-			Asset:  "BTC",
-			Amount: amount,
+			OrderID: &lockID,
+			UserID:  user.ID,
+			Asset:   asset,
+			Amount:  amount,
 		}
 		if err := s.lockRepo.CreateLock(ctx, newLock); err != nil {
 			return fmt.Errorf("failed to create lock: %w", err)
 		}
-		return nil
+		journal := ledger.NewJournal(ledger.Lock, lockID).
+			Transfer(asset, amount, ledger.AvailableOf(user.ID), ledger.LockedOf(user.ID))
+		return s.ledgerRepo.PostJournal(ctx, journal)
 	} else {
-		return fmt.Errorf("insufficient BTC balance: %v", user.ID)
+		return fmt.Errorf("%w: %s %v", ErrInsufficientBalance, asset, user.ID)
 	}
 }
 
+// CreateUser stores a user with their opening balances, which are journaled
+// as a deposit referencing the user.
 func (s *OrderCreatorService) CreateUser(newUser dto.UserDto) (entity.Users, error) {
-	btcBalance := newUser.BtcBalance
-	usdtBalance := newUser.UsdtBalance
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.Users{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
 
 	userEntity := entity.Users{
-		ID:          uuid.New(),
-		Email:       newUser.Email,
-		BtcBalance:  &btcBalance,
-		UsdtBalance: &usdtBalance,
+		ID:    uuid.New(),
+		Email: newUser.Email,
 	}
-	user, err := s.userRepo.CreateUser(userEntity)
+	user, err := s.userRepo.CreateUser(ctx, userEntity)
 	if err != nil {
 		return user, err
 	}
-	return user, nil
+
+	external, available := ledger.ExternalOf(user.ID), ledger.AvailableOf(user.ID)
+	journal := ledger.NewJournal(ledger.Deposit, user.ID)
+	for _, opening := range newUser.OpeningBalances {
+		if err = s.checkDeposit(ctx, opening.Asset, opening.Amount); err != nil {
+			return entity.Users{}, err
+		}
+		if err = s.balanceRepo.Credit(ctx, user.ID, opening.Asset, opening.Amount); err != nil {
+			return entity.Users{}, err
+		}
+		journal.Transfer(opening.Asset, opening.Amount, external, available)
+	}
+	if err = s.ledgerRepo.PostJournal(ctx, journal); err != nil {
+		return entity.Users{}, err
+	}
+	return user, tx.Commit()
 }
 
-func (s *OrderCreatorService) GetBalance(id uuid.UUID) (dto.UserDto, error) {
+// GetBalance returns what the user holds of every asset they have held.
+func (s *OrderCreatorService) GetBalance(id uuid.UUID) (dto.UserBalancesDto, error) {
 	user, err := s.userRepo.GetBalance(id)
 	if err != nil {
-		return dto.UserDto{}, err
+		return dto.UserBalancesDto{}, err
 	}
 
-	balance := dto.UserDto{
-		Email:       user.Email,
-		UsdtBalance: *user.UsdtBalance,
-		BtcBalance:  *user.BtcBalance,
+	balances := dto.UserBalancesDto{Email: user.Email, Balances: []dto.AssetBalanceDto{}}
+	for _, balance := range user.Balances {
+		balances.Balances = append(balances.Balances, dto.AssetBalanceDto{
+			Asset:     balance.Asset,
+			Available: balance.Available,
+			Locked:    balance.Locked,
+		})
 	}
-	return balance, nil
+	return balances, nil
 }
 
+// AddBalance deposits an amount of a registered asset into the user's
+// available balance and journals it as a deposit with an ID of its own.
 func (s *OrderCreatorService) AddBalance(ctx context.Context, balance dto.BalanceDto) error {
-	user, err := s.userRepo.FindUser(ctx, balance.Id)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	switch balance.Asset {
-	case "BTC":
-		*user.BtcBalance += balance.Amount
-	case "USD":
-		*user.UsdtBalance += balance.Amount
-	default:
-		return errors.New("invalid asset")
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	if err = s.checkDeposit(ctx, balance.Asset, balance.Amount); err != nil {
+		return err
 	}
-	return s.userRepo.UpdateUser(ctx, user)
+	if _, err = s.userRepo.FindUser(ctx, balance.Id); err != nil {
+		return err
+	}
+	if err = s.balanceRepo.Credit(ctx, balance.Id, balance.Asset, balance.Amount); err != nil {
+		return err
+	}
+	journal := ledger.NewJournal(ledger.Deposit, uuid.New()).
+		Transfer(balance.Asset, balance.Amount, ledger.ExternalOf(balance.Id), ledger.AvailableOf(balance.Id))
+	if err = s.ledgerRepo.PostJournal(ctx, journal); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *OrderCreatorService) FindAllOrder(ctx context.Context) ([]entity.Order, error) {
@@ -304,9 +516,28 @@ func (s *OrderCreatorService) FindAllOrder(ctx context.Context) ([]entity.Order,
 	if err != nil {
 		return nil, err
 	}
+	// iceberg orders only ever show their visible slice
+	for i := range orders {
+		if orders[i].DisplayQuantity.IsPositive() {
+			orders[i].OrderQuantity = orders[i].VisibleQuantity
+		}
+	}
 	return orders, nil
 }
 
+// UpdateSelfTradePrevention sets the self-trade prevention mode used by the
+// user's orders that do not ask for one. It does not touch open orders.
+func (s *OrderCreatorService) UpdateSelfTradePrevention(ctx context.Context, userID uuid.UUID, mode string) error {
+	if err := utils.ValidateSelfTradePrevention(mode); err != nil {
+		return err
+	}
+	return s.userRepo.UpdateSelfTradePrevention(ctx, userID, mode)
+}
+
+func (s *OrderCreatorService) FindAllSymbols(ctx context.Context) ([]entity.Symbol, error) {
+	return s.symbolRepo.FindAllSymbols(ctx)
+}
+
 func (s *OrderCreatorService) FindAllUser() ([]entity.Users, error) {
 	return s.userRepo.FindAllUser()
 }
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// createStopOrder stores a stop order that waits off the book until the last
+// trade price reaches its trigger. Its funds are locked now, so the order can
+// always be funded once it triggers.
+func (s *OrderCreatorService) createStopOrder(ctx context.Context, newOrder dto.OrderDto, symbol entity.Symbol) (uuid.UUID, error) {
+	user, err := s.userRepo.FindUser(ctx, newOrder.UserID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	orderEntity, err := buildStopOrder(newOrder, user)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err = checkStopNotional(symbol, orderEntity); err != nil {
+		return uuid.Nil, err
+	}
+	if err = s.lockOrderFunds(ctx, user, orderEntity, symbol); err != nil {
+		return uuid.Nil, err
+	}
+
+	if _, err = s.orderRepo.CreateOrder(ctx, orderEntity); err != nil {
+		return uuid.Nil, fmt.Errorf("could not create stop order: %w", err)
+	}
+	return orderEntity.ID, nil
+}
+
+// createTrailingStopOrder stores a trailing stop. Its first trigger price
+// trails the last trade price of the symbol, or the best opposite price when
+// the symbol has not traded yet; the orderchecker moves it with later trades.
+func (s *OrderCreatorService) createTrailingStopOrder(ctx context.Context, newOrder dto.OrderDto, symbol entity.Symbol) (uuid.UUID, error) {
+	if err := utils.ValidateOrderType(utils.OrderType(newOrder.Type)); err != nil {
+		return uuid.Nil, err
+	}
+	if newOrder.TrailingAmount.IsPositive() == newOrder.TrailingPercent.IsPositive() ||
+		newOrder.TrailingAmount.IsNegative() || newOrder.TrailingPercent.IsNegative() ||
+		newOrder.TrailingPercent.GreaterThanOrEqual(decimal.NewFromInt(100)) {
+		return uuid.Nil, ErrInvalidTrailingOffset
+	}
+
+	marketPrice, err := s.marketPrice(ctx, symbol, newOrder.Type)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	trailing := entity.Order{
+		Type:            newOrder.Type,
+		TrailingAmount:  newOrder.TrailingAmount,
+		TrailingPercent: newOrder.TrailingPercent,
+	}
+	newOrder.TriggerPrice = utils.TrailingTrigger(&trailing, marketPrice)
+	return s.createStopOrder(ctx, newOrder, symbol)
+}
+
+// marketPrice is the price a trailing stop starts trailing: the last trade of
+// the symbol, or the best price on the opposite side.
+func (s *OrderCreatorService) marketPrice(ctx context.Context, symbol entity.Symbol, orderType string) (decimal.Decimal, error) {
+	price, ok, err := s.orderRepo.FindLastTradePrice(ctx, symbol.Name)
+	if err != nil || ok {
+		return price, err
+	}
+
+	opposite := utils.SellOrder
+	if orderType == utils.SellOrder {
+		opposite = utils.BuyOrder
+	}
+	price, ok, err = s.orderRepo.FindBestPrice(ctx, symbol.Name, opposite)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !ok {
+		return decimal.Zero, ErrNoLiquidity
+	}
+	return price, nil
+}
+
+// checkStopNotional checks the value of a stop-market or trailing stop order
+// at its trigger price. Stop-limit orders are checked like limit orders.
+func checkStopNotional(symbol entity.Symbol, order entity.Order) error {
+	if order.Kind != utils.StopMarketOrder && order.Kind != utils.TrailingStop {
+		return nil
+	}
+	notional, err := marketNotional(order, order.TriggerPrice)
+	if err != nil {
+		return err
+	}
+	return checkNotional(symbol, notional)
+}
+
+// buildStopOrder validates a stop order request. A stop-market or trailing
+// stop order is priced like a market order with the trigger price as
+// reference.
+func buildStopOrder(newOrder dto.OrderDto, user entity.Users) (entity.Order, error) {
+	if err := utils.ValidateOrderType(utils.OrderType(newOrder.Type)); err != nil {
+		return entity.Order{}, err
+	}
+	if !newOrder.TriggerPrice.IsPositive() {
+		return entity.Order{}, ErrInvalidTriggerPrice
+	}
+
+	orderEntity := entity.Order{
+		ID:                  uuid.New(),
+		Asset:               newOrder.Asset,
+		Kind:                newOrder.Kind,
+		TimeInForce:         newOrder.TimeInForce,
+		ExpiresAt:           newOrder.ExpiresAt,
+		TriggerPrice:        newOrder.TriggerPrice,
+		TrailingAmount:      newOrder.TrailingAmount,
+		TrailingPercent:     newOrder.TrailingPercent,
+		SelfTradePrevention: selfTradePrevention(newOrder.SelfTradePrevention, user),
+		OrderStatus:         true,
+		UserID:              newOrder.UserID,
+		Type:                newOrder.Type,
+		User:                user,
+	}
+
+	if utils.ExecutesAsMarket(newOrder.Kind) {
+		if err := sizeMarketOrder(&orderEntity, newOrder, newOrder.TriggerPrice); err != nil {
+			return entity.Order{}, err
+		}
+		return orderEntity, nil
+	}
+	if !newOrder.OrderPrice.IsPositive() || !newOrder.OrderQuantity.IsPositive() {
+		return entity.Order{}, ErrInvalidOrderPriceOrQuantity
+	}
+	orderEntity.OrderPrice = newOrder.OrderPrice
+	orderEntity.OrderQuantity = newOrder.OrderQuantity
+	return orderEntity, nil
+}
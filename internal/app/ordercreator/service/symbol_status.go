@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSymbolStatus        = errors.New("the symbol does not accept this order in its current status")
+	ErrInvalidStatusChange = errors.New("a status change needs a valid status, who made it and why")
+)
+
+// UpdateSymbolStatus moves a symbol to another trading status and records
+// who made the change and why. The orderchecker picks the new status up on
+// its next sync.
+func (s *OrderCreatorService) UpdateSymbolStatus(ctx context.Context, symbolName string, status dto.SymbolStatusDto) (entity.SymbolStatusChange, error) {
+	if utils.ValidateSymbolStatus(status.Status) != nil ||
+		strings.TrimSpace(status.ChangedBy) == "" || strings.TrimSpace(status.Reason) == "" {
+		return entity.SymbolStatusChange{}, ErrInvalidStatusChange
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entity.SymbolStatusChange{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx = context.WithValue(ctx, "tx", tx)
+
+	symbol, err := s.symbolRepo.FindSymbolForUpdate(ctx, symbolName)
+	if err != nil {
+		return entity.SymbolStatusChange{}, err
+	}
+
+	change := entity.SymbolStatusChange{
+		ID:         uuid.New(),
+		Symbol:     symbol.Name,
+		FromStatus: symbol.Status,
+		ToStatus:   status.Status,
+		ChangedBy:  status.ChangedBy,
+		Reason:     status.Reason,
+		ChangedAt:  time.Now(),
+	}
+	if err = s.symbolRepo.UpdateSymbolStatus(ctx, change); err != nil {
+		return entity.SymbolStatusChange{}, err
+	}
+
+	return change, tx.Commit()
+}
+
+// FindSymbolStatusChanges returns the status changes of a symbol, newest
+// first.
+func (s *OrderCreatorService) FindSymbolStatusChanges(ctx context.Context, symbolName string) ([]entity.SymbolStatusChange, error) {
+	symbol, err := s.symbolRepo.FindSymbol(ctx, symbolName)
+	if err != nil {
+		return nil, err
+	}
+	return s.symbolRepo.FindSymbolStatusChanges(ctx, symbol.Name)
+}
+
+// checkSymbolStatus rejects an order its symbol does not accept right now:
+// an open symbol takes every order, a post-only symbol only post-only limit
+// orders and the other statuses none.
+func checkSymbolStatus(symbol entity.Symbol, newOrder dto.OrderDto) error {
+	switch {
+	case symbol.Status == utils.SymbolOpen:
+		return nil
+	case symbol.Status == utils.SymbolPostOnly && newOrder.Kind == utils.LimitOrder && newOrder.PostOnly:
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s", ErrSymbolStatus, symbol.Name, symbol.Status)
+}
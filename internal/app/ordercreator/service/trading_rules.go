@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTradingRule  = errors.New("order breaks a trading rule of its symbol")
+	ErrPriceTick    = fmt.Errorf("%w: price tick", ErrTradingRule)
+	ErrQuantityStep = fmt.Errorf("%w: quantity step", ErrTradingRule)
+	ErrMinQuantity  = fmt.Errorf("%w: minimum quantity", ErrTradingRule)
+	ErrMaxQuantity  = fmt.Errorf("%w: maximum quantity", ErrTradingRule)
+	ErrMinNotional  = fmt.Errorf("%w: minimum notional", ErrTradingRule)
+	ErrPriceBand    = fmt.Errorf("%w: price band", ErrTradingRule)
+)
+
+// checkTradingRules checks every price of the order against the symbol's tick
+// size, every quantity against its step and limits, and the order's value
+// against the minimum notional. A rule set to zero is not enforced. A market
+// order's notional is only known once it is sized, so it is checked by
+// checkNotional instead.
+func checkTradingRules(symbol entity.Symbol, newOrder dto.OrderDto) error {
+	isMarket := utils.ExecutesAsMarket(newOrder.Kind)
+	if !isMarket {
+		if err := checkPrice(symbol, "price", newOrder.OrderPrice); err != nil {
+			return err
+		}
+	}
+	if newOrder.Kind == utils.StopMarketOrder || newOrder.Kind == utils.StopLimitOrder {
+		if err := checkPrice(symbol, "trigger price", newOrder.TriggerPrice); err != nil {
+			return err
+		}
+	}
+	if newOrder.Kind == utils.TrailingStop && newOrder.TrailingAmount.IsPositive() {
+		if err := checkPrice(symbol, "trailing amount", newOrder.TrailingAmount); err != nil {
+			return err
+		}
+	}
+	if newOrder.OrderQuantity.IsPositive() {
+		if err := checkQuantity(symbol, "quantity", newOrder.OrderQuantity); err != nil {
+			return err
+		}
+	}
+	if newOrder.DisplayQuantity.IsPositive() {
+		if err := checkQuantity(symbol, "display quantity", newOrder.DisplayQuantity); err != nil {
+			return err
+		}
+	}
+	if !isMarket {
+		value, err := orderValue(newOrder.OrderPrice, newOrder.OrderQuantity)
+		if err != nil {
+			return err
+		}
+		return checkNotional(symbol, value)
+	}
+	return nil
+}
+
+// checkPriceBand rejects a limit or stop-limit order priced further than the
+// symbol's price band from the last trade. The order checker checks a stop
+// limit again when it triggers. Market orders carry no price, so they are
+// not checked; nor is any order before the symbol's first trade.
+func (s *OrderCreatorService) checkPriceBand(ctx context.Context, symbol entity.Symbol, newOrder dto.OrderDto) error {
+	if (newOrder.Kind != utils.LimitOrder && newOrder.Kind != utils.StopLimitOrder) || !symbol.PriceBand.IsPositive() {
+		return nil
+	}
+	reference, ok, err := s.orderRepo.FindLastTradePrice(ctx, symbol.Name)
+	if err != nil || !ok {
+		return err
+	}
+	low, high := utils.PriceBand(reference, symbol.PriceBand)
+	if newOrder.OrderPrice.LessThan(low) || newOrder.OrderPrice.GreaterThan(high) {
+		return fmt.Errorf("%w: price %v is outside %v-%v around the last trade at %v",
+			ErrPriceBand, newOrder.OrderPrice, low, high, reference)
+	}
+	return nil
+}
+
+func checkPrice(symbol entity.Symbol, name string, price decimal.Decimal) error {
+	if symbol.TickSize.IsPositive() && !price.IsMultipleOf(symbol.TickSize) {
+		return fmt.Errorf("%w: %s %v is not a multiple of %v", ErrPriceTick, name, price, symbol.TickSize)
+	}
+	return nil
+}
+
+func checkQuantity(symbol entity.Symbol, name string, quantity decimal.Decimal) error {
+	if symbol.StepSize.IsPositive() && !quantity.IsMultipleOf(symbol.StepSize) {
+		return fmt.Errorf("%w: %s %v is not a multiple of %v", ErrQuantityStep, name, quantity, symbol.StepSize)
+	}
+	if symbol.MinQuantity.IsPositive() && quantity.LessThan(symbol.MinQuantity) {
+		return fmt.Errorf("%w: %s %v is below %v", ErrMinQuantity, name, quantity, symbol.MinQuantity)
+	}
+	if symbol.MaxQuantity.IsPositive() && quantity.GreaterThan(symbol.MaxQuantity) {
+		return fmt.Errorf("%w: %s %v is above %v", ErrMaxQuantity, name, quantity, symbol.MaxQuantity)
+	}
+	return nil
+}
+
+// orderValue is price times quantity, refusing an order whose value is too
+// large to hold.
+func orderValue(price, quantity decimal.Decimal) (decimal.Decimal, error) {
+	value, err := price.Mul(quantity)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%w: value of %v at %v: %w", ErrTradingRule, quantity, price, err)
+	}
+	return value, nil
+}
+
+func checkNotional(symbol entity.Symbol, notional decimal.Decimal) error {
+	if symbol.MinNotional.IsPositive() && notional.LessThan(symbol.MinNotional) {
+		return fmt.Errorf("%w: order value %v %s is below %v", ErrMinNotional, notional, symbol.QuoteAsset, symbol.MinNotional)
+	}
+	return nil
+}
@@ -1,19 +1,115 @@
 package dto
 
-import "github.com/google/uuid"
+import (
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+	"time"
+)
 
 type OrderDto struct {
-	Asset         string    `json:"Asset"`
-	OrderPrice    float64   `json:"OrderPrice"`
-	OrderQuantity float64   `json:"OrderQuantity"`
-	OrderStatus   bool      `json:"OrderStatus"`
-	UserID        uuid.UUID `json:"UserID"`
-	Type          string    `json:"Type"`
+	Asset               string          `json:"Asset"`
+	OrderPrice          decimal.Decimal `json:"OrderPrice"`
+	OrderQuantity       decimal.Decimal `json:"OrderQuantity"`
+	OrderStatus         bool            `json:"OrderStatus"`
+	UserID              uuid.UUID       `json:"UserID"`
+	Type                string          `json:"Type"`
+	Kind                string          `json:"Kind"`
+	QuoteAmount         decimal.Decimal `json:"QuoteAmount"`
+	MaxSlippage         decimal.Decimal `json:"MaxSlippage"`
+	TimeInForce         string          `json:"TimeInForce"`
+	ExpiresAt           *time.Time      `json:"ExpiresAt"`
+	PostOnly            bool            `json:"PostOnly"`
+	RepriceOnCross      bool            `json:"RepriceOnCross"`
+	TriggerPrice        decimal.Decimal `json:"TriggerPrice"`
+	TrailingAmount      decimal.Decimal `json:"TrailingAmount"`
+	TrailingPercent     decimal.Decimal `json:"TrailingPercent"`
+	DisplayQuantity     decimal.Decimal `json:"DisplayQuantity"`
+	SelfTradePrevention string          `json:"SelfTradePrevention"`
 }
+
+// AmendOrderDto changes the price and/or the quantity of an open limit order.
+// A zero field keeps the current value.
+type AmendOrderDto struct {
+	OrderPrice    decimal.Decimal `json:"OrderPrice"`
+	OrderQuantity decimal.Decimal `json:"OrderQuantity"`
+}
+
+// CancelAllDto narrows a mass cancel to one symbol and/or side. Empty fields
+// match every order.
+type CancelAllDto struct {
+	Symbol string `query:"symbol"`
+	Side   string `query:"side"`
+}
+
+// HeartbeatDto arms or refreshes the dead-man's switch: without another
+// heartbeat within TimeoutSeconds all open orders are cancelled. Zero
+// disarms it.
+type HeartbeatDto struct {
+	TimeoutSeconds int `json:"TimeoutSeconds"`
+}
+
+// OcoOrderDto links a take-profit limit order and a stop-loss order of the
+// same user and side. A fill on either leg cancels the other.
+type OcoOrderDto struct {
+	UserID              uuid.UUID `json:"UserID"`
+	Asset               string    `json:"Asset"`
+	Type                string    `json:"Type"`
+	TakeProfit          OrderDto  `json:"TakeProfit"`
+	StopLoss            OrderDto  `json:"StopLoss"`
+	SelfTradePrevention string    `json:"SelfTradePrevention"`
+}
+
+// AuctionDto starts a call auction that collects orders for DurationSeconds.
+type AuctionDto struct {
+	DurationSeconds int    `json:"DurationSeconds"`
+	Reason          string `json:"Reason"`
+}
+
+// SymbolStatusDto moves a symbol to another trading status. Who made the
+// change and why are recorded with it; who made it is the authenticated
+// admin and never comes from the request body.
+type SymbolStatusDto struct {
+	Status    string `json:"Status"`
+	ChangedBy string `json:"-"`
+	Reason    string `json:"Reason"`
+}
+
+// UserDto creates a user. Each opening balance is deposited into the user's
+// available balance of a registered asset.
 type UserDto struct {
-	Email       string  `json:"Email"`
-	BtcBalance  float64 `json:"BtcBalance"`
-	UsdtBalance float64 `json:"UsdtBalance"`
+	Email           string           `json:"Email"`
+	OpeningBalances []AssetAmountDto `json:"OpeningBalances"`
+}
+
+type AssetAmountDto struct {
+	Asset  string          `json:"Asset"`
+	Amount decimal.Decimal `json:"Amount"`
+}
+
+// UserBalancesDto lists what a user holds of each asset.
+type UserBalancesDto struct {
+	Email    string            `json:"Email"`
+	Balances []AssetBalanceDto `json:"Balances"`
+}
+
+type AssetBalanceDto struct {
+	Asset     string          `json:"Asset"`
+	Available decimal.Decimal `json:"Available"`
+	Locked    decimal.Decimal `json:"Locked"`
+}
+
+// AssetDto registers an asset or replaces its settings. Precision is its
+// number of decimal places; the code of an existing asset comes from the
+// path.
+type AssetDto struct {
+	Code            string          `json:"Code"`
+	Name            string          `json:"Name"`
+	Precision       int32           `json:"Precision"`
+	MinDeposit      decimal.Decimal `json:"MinDeposit"`
+	MinWithdrawal   decimal.Decimal `json:"MinWithdrawal"`
+	DepositEnabled  bool            `json:"DepositEnabled"`
+	WithdrawEnabled bool            `json:"WithdrawEnabled"`
+	TradeEnabled    bool            `json:"TradeEnabled"`
 }
 
 type OrderMatchDto struct {
@@ -21,8 +117,12 @@ type OrderMatchDto struct {
 	OrderID2 uuid.UUID
 }
 
+type SelfTradePreventionDto struct {
+	Mode string `json:"Mode"`
+}
+
 type BalanceDto struct {
-	Id     uuid.UUID `param:"Id"`
-	Asset  string    `param:"Asset"`
-	Amount float64   `json:"Amount"`
+	Id     uuid.UUID       `param:"Id"`
+	Asset  string          `param:"Asset"`
+	Amount decimal.Decimal `json:"Amount"`
 }
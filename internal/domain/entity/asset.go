@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"time"
+)
+
+// MaxAssetPrecision is the most decimal places an asset can have. Every
+// amount is a decimal.Decimal, an int64 count of 10^-8 units kept in
+// numeric(30,8) columns, and more places would cost it the range balances
+// need. Assets with more places on chain, such as ETH with 18, are held to
+// eight, and deposits of them may not carry more.
+const MaxAssetPrecision = decimal.Scale
+
+// Asset is a currency the exchange holds balances in. Amounts of it have at
+// most Precision decimal places. Deposits below MinDeposit and withdrawals
+// below MinWithdrawal are refused, and the Enabled flags turn deposits,
+// withdrawals and trading in the asset on and off.
+type Asset struct {
+	Code            string          `gorm:"type:varchar(10);primaryKey"`
+	Name            string          `gorm:"type:varchar(50);not null"`
+	Precision       int32           `gorm:"not null;default:8"`
+	MinDeposit      decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	MinWithdrawal   decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	DepositEnabled  bool            `gorm:"not null;default:true"`
+	WithdrawEnabled bool            `gorm:"not null;default:true"`
+	TradeEnabled    bool            `gorm:"not null;default:true"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Auction is a call auction of one symbol. Until EndsAt orders only collect
+// and the indicative price and volume are refreshed; at the end every
+// crossing order is filled at the single clearing price.
+type Auction struct {
+	ID               uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	Symbol           string          `gorm:"type:varchar(20);not null;index"`
+	Reason           string          `gorm:"type:text"`
+	StartedAt        time.Time       `gorm:"not null"`
+	EndsAt           time.Time       `gorm:"not null"`
+	IndicativePrice  decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	IndicativeVolume decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	ClearingPrice    decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	ClearedVolume    decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	CompletedAt      *time.Time      `gorm:"default:NULL;index"`
+}
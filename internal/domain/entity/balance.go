@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Balance is what a user holds of one asset. Available can be spent or
+// withdrawn; Locked is held for open orders and always equals the sum of the
+// user's locks in the asset. Neither may go negative.
+type Balance struct {
+	UserID    uuid.UUID       `gorm:"type:uuid;primaryKey"`
+	Asset     string          `gorm:"type:varchar(10);primaryKey"`
+	Available decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0;check:chk_balances_available,available >= 0"`
+	Locked    decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0;check:chk_balances_locked,locked >= 0"`
+	UpdatedAt *time.Time
+}
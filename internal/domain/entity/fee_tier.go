@@ -0,0 +1,13 @@
+package entity
+
+import "bitcoinOrder/pkg/decimal"
+
+// FeeTier is one step of the fee schedule. A user whose traded volume over
+// the last 30 days reaches MinVolume pays the tier's maker and taker rates,
+// a fraction of what each fill gives them.
+type FeeTier struct {
+	Name      string          `gorm:"type:varchar(20);primaryKey"`
+	MinVolume decimal.Decimal `gorm:"type:numeric(30,8);not null;uniqueIndex"`
+	MakerRate decimal.Decimal `gorm:"type:numeric(30,8);not null"`
+	TakerRate decimal.Decimal `gorm:"type:numeric(30,8);not null"`
+}
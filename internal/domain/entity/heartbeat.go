@@ -0,0 +1,16 @@
+package entity
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Heartbeat is a user's dead-man's switch. Every heartbeat pushes ExpiresAt
+// TimeoutSeconds into the future; once it passes, all open orders of the
+// user are cancelled and the switch is disarmed.
+type Heartbeat struct {
+	UserID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	TimeoutSeconds int       `gorm:"not null"`
+	ExpiresAt      time.Time `gorm:"not null;index"`
+	UpdatedAt      time.Time
+}
@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+	"time"
+)
+
+// LedgerEntry is one side of a balance movement. A positive amount credits
+// the account and a negative one debits it; the entries of one journal sum
+// to zero per asset. EventType and EventID name what caused the movement,
+// such as the order a lock was taken for or the match that was settled.
+type LedgerEntry struct {
+	ID        uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	JournalID uuid.UUID       `gorm:"type:uuid;not null;index"`
+	UserID    uuid.UUID       `gorm:"type:uuid;not null;index:idx_ledger_user_asset"`
+	Asset     string          `gorm:"type:varchar(10);not null;index:idx_ledger_user_asset"`
+	Account   string          `gorm:"type:varchar(20);not null"`
+	Amount    decimal.Decimal `gorm:"type:numeric(30,8);not null"`
+	EventType string          `gorm:"type:varchar(20);not null"`
+	EventID   uuid.UUID       `gorm:"type:uuid;not null;index"`
+	CreatedAt time.Time       `gorm:"not null"`
+}
@@ -1,16 +1,21 @@
 package entity
 
 import (
+	"bitcoinOrder/pkg/decimal"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"time"
 )
 
+// Lock holds funds an open order may still spend. OrderID is the order the
+// lock belongs to, or the group ID of an OCO pair whose legs share one lock.
+// Locks taken before locks were per order have none.
 type Lock struct {
-	ID        uuid.UUID `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null"`
-	Asset     string    `gorm:"type:varchar(10);not null"`
-	Amount    float64   `gorm:"type:decimal(18,8);not null"`
+	ID        uuid.UUID       `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()"`
+	OrderID   *uuid.UUID      `gorm:"type:uuid;uniqueIndex"`
+	UserID    uuid.UUID       `gorm:"type:uuid;not null"`
+	Asset     string          `gorm:"type:varchar(10);not null"`
+	Amount    decimal.Decimal `gorm:"type:numeric(30,8);not null"`
 	CreatedAt time.Time
 	UpdatedAt *time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -1,22 +1,39 @@
 package entity
 
 import (
+	"bitcoinOrder/pkg/decimal"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"time"
 )
 
 type Order struct {
-	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	UserID        uuid.UUID `gorm:"type:uuid;not null;index"`
-	Type          string    `gorm:"type:varchar(10);not null;index:idx_order_type"`
-	Asset         string    `gorm:"type:varchar(255);index"`
-	OrderPrice    float64   `gorm:"type:double precision;index:idx_order_price_type_status"`
-	OrderQuantity float64   `gorm:"type:double precision"`
-	OrderStatus   bool      `gorm:"type:boolean;default:true;index:idx_order_status"`
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	DeletedAt     gorm.DeletedAt `gorm:"index"`
-	CompletedAt   *time.Time     `gorm:"default:NULL"`
-	User          Users          `gorm:"foreignKey:UserID"`
+	ID                  uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID              uuid.UUID       `gorm:"type:uuid;not null;index"`
+	Type                string          `gorm:"type:varchar(10);not null;index:idx_order_type"`
+	Kind                string          `gorm:"type:varchar(20);not null;default:'limit'"`
+	Asset               string          `gorm:"type:varchar(255);index"` // symbol name, e.g. BTCUSDT
+	OrderPrice          decimal.Decimal `gorm:"type:numeric(30,8);index:idx_order_price_type_status"`
+	OrderQuantity       decimal.Decimal `gorm:"type:numeric(30,8)"`
+	QuoteAmount         decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	OrderStatus         bool            `gorm:"type:boolean;default:true;index:idx_order_status"`
+	TimeInForce         string          `gorm:"type:varchar(3);not null;default:'GTC'"`
+	ExpiresAt           *time.Time      `gorm:"default:NULL;index"`
+	PostOnly            bool            `gorm:"type:boolean;not null;default:false"`
+	RepriceOnCross      bool            `gorm:"type:boolean;not null;default:false"`
+	TriggerPrice        decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	TriggeredAt         *time.Time      `gorm:"default:NULL"`
+	TrailingAmount      decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	TrailingPercent     decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	DisplayQuantity     decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	VisibleQuantity     decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	PriorityAt          time.Time
+	OcoGroupID          *uuid.UUID `gorm:"type:uuid;index"`
+	SelfTradePrevention string     `gorm:"type:varchar(2);not null;default:''"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Version             int64          `gorm:"not null;default:0"` // bumped by every write of quantity, price or priority
+	DeletedAt           gorm.DeletedAt `gorm:"index"`
+	CompletedAt         *time.Time     `gorm:"default:NULL"`
+	User                Users          `gorm:"foreignKey:UserID"`
 }
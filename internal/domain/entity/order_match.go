@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"bitcoinOrder/pkg/decimal"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"time"
@@ -8,9 +9,14 @@ import (
 
 type OrderMatch struct {
 	gorm.Model
-	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	OrderID1      uuid.UUID `gorm:"type:uuid;not null;index:idx_order_match_order_ids"`
-	OrderID2      uuid.UUID `gorm:"type:uuid;not null;index:idx_order_match_order_ids"`
-	OrderQuantity float64   `gorm:"type:double precision"`
-	MatchedAt     time.Time `gorm:"default:current_timestamp"`
+	ID            uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	OrderID1      uuid.UUID       `gorm:"type:uuid;not null;index:idx_order_match_order_ids"`
+	OrderID2      uuid.UUID       `gorm:"type:uuid;not null;index:idx_order_match_order_ids"`
+	Symbol        string          `gorm:"type:varchar(20);index"`
+	OrderQuantity decimal.Decimal `gorm:"type:numeric(30,8)"`
+	Price         decimal.Decimal `gorm:"type:numeric(30,8)"`
+	MatchedAt     time.Time       `gorm:"default:current_timestamp"`
+	TakerSide     string          `gorm:"type:varchar(10);not null;default:''"` // empty for auction trades
+	BuyFee        decimal.Decimal `gorm:"type:numeric(30,8);default:0"`         // in the base asset the buyer received
+	SellFee       decimal.Decimal `gorm:"type:numeric(30,8);default:0"`         // in the quote asset the seller received
 }
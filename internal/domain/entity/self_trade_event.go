@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+	"time"
+)
+
+// SelfTradeEvent records a trade the engine prevented because both orders
+// belonged to the same user.
+type SelfTradeEvent struct {
+	ID           uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	UserID       uuid.UUID       `gorm:"type:uuid;not null;index"`
+	TakerOrderID uuid.UUID       `gorm:"type:uuid;not null;index"`
+	MakerOrderID uuid.UUID       `gorm:"type:uuid;not null;index"`
+	Mode         string          `gorm:"type:varchar(2);not null"`
+	Quantity     decimal.Decimal `gorm:"type:numeric(30,8)"`
+	Reason       string          `gorm:"type:text;not null"`
+	CreatedAt    time.Time
+}
@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"time"
+)
+
+// Symbol is a trading pair. Orders on it buy and sell the base asset and are
+// priced in the quote asset. Prices must be multiples of TickSize and
+// quantities multiples of StepSize; a rule left at zero is not enforced.
+//
+// Limit prices further than PriceBand (a fraction) from the last trade are
+// rejected. When trading moves the price by more than BreakerMove within
+// BreakerWindowSeconds, matching halts for BreakerCooldownSeconds and then
+// reopens through an auction of ReopenAuctionSeconds, or directly when that
+// is zero.
+//
+// Status is set by operations and decides which requests the symbol accepts;
+// see the Symbol* statuses in utils.
+type Symbol struct {
+	Name                   string          `gorm:"type:varchar(20);primaryKey"`
+	BaseAsset              string          `gorm:"type:varchar(10);not null"`
+	QuoteAsset             string          `gorm:"type:varchar(10);not null"`
+	TickSize               decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	StepSize               decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	MinQuantity            decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	MaxQuantity            decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	MinNotional            decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	PriceBand              decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	BreakerMove            decimal.Decimal `gorm:"type:numeric(30,8);not null;default:0"`
+	BreakerWindowSeconds   int             `gorm:"not null;default:0"`
+	BreakerCooldownSeconds int             `gorm:"not null;default:0"`
+	ReopenAuctionSeconds   int             `gorm:"not null;default:0"`
+	Status                 string          `gorm:"type:varchar(20);not null;default:'open'"`
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+}
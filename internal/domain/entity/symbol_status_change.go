@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// SymbolStatusChange records who moved a symbol from one trading status to
+// another, and why.
+type SymbolStatusChange struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	Symbol     string    `gorm:"type:varchar(20);not null;index"`
+	FromStatus string    `gorm:"type:varchar(20);not null"`
+	ToStatus   string    `gorm:"type:varchar(20);not null"`
+	ChangedBy  string    `gorm:"type:varchar(100);not null"`
+	Reason     string    `gorm:"type:text;not null"`
+	ChangedAt  time.Time `gorm:"not null"`
+}
@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+	"time"
+)
+
+// TradingHalt stops matching on a symbol after its circuit breaker tripped.
+// Orders keep collecting until ResumesAt, when the symbol reopens.
+type TradingHalt struct {
+	ID             uuid.UUID       `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	Symbol         string          `gorm:"type:varchar(20);not null;index"`
+	Reason         string          `gorm:"type:text"`
+	ReferencePrice decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	TriggerPrice   decimal.Decimal `gorm:"type:numeric(30,8);default:0"`
+	HaltedAt       time.Time       `gorm:"not null"`
+	ResumesAt      time.Time       `gorm:"not null"`
+	ResumedAt      *time.Time      `gorm:"default:NULL;index"`
+}
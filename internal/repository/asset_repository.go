@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrAssetExists   = errors.New("asset already exists")
+)
+
+type IAssetRepository interface {
+	CreateAssets(ctx context.Context, assets []entity.Asset) error
+	CreateAsset(ctx context.Context, asset entity.Asset) (entity.Asset, error)
+	UpdateAsset(ctx context.Context, asset entity.Asset) (entity.Asset, error)
+	FindAsset(ctx context.Context, code string) (entity.Asset, error)
+	FindAllAssets(ctx context.Context) ([]entity.Asset, error)
+}
+
+type AssetRepository struct {
+	db *sql.DB
+}
+
+func NewAssetRepository(db *sql.DB) *AssetRepository {
+	return &AssetRepository{db: db}
+}
+
+// CreateAssets registers the given assets, leaving the ones that already
+// exist untouched.
+func (r *AssetRepository) CreateAssets(ctx context.Context, assets []entity.Asset) error {
+	for _, asset := range assets {
+		if _, err := r.CreateAsset(ctx, asset); err != nil && !errors.Is(err, ErrAssetExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateAsset registers an asset, or returns ErrAssetExists when its code is
+// taken.
+func (r *AssetRepository) CreateAsset(ctx context.Context, asset entity.Asset) (entity.Asset, error) {
+	sqlStatement := `
+        INSERT INTO assets (code, name, precision, min_deposit, min_withdrawal,
+                            deposit_enabled, withdraw_enabled, trade_enabled, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+        ON CONFLICT (code) DO NOTHING;
+    `
+	now := time.Now()
+	result, err := queryer(ctx, r.db).ExecContext(ctx, sqlStatement, asset.Code, asset.Name, asset.Precision,
+		asset.MinDeposit, asset.MinWithdrawal, asset.DepositEnabled, asset.WithdrawEnabled, asset.TradeEnabled, now)
+	if err != nil {
+		return entity.Asset{}, fmt.Errorf("error while creating asset %s: %w", asset.Code, err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return entity.Asset{}, fmt.Errorf("%w: %s", ErrAssetExists, asset.Code)
+	}
+	asset.CreatedAt, asset.UpdatedAt = now, now
+	return asset, nil
+}
+
+// UpdateAsset replaces everything but the code and creation time of an
+// asset.
+func (r *AssetRepository) UpdateAsset(ctx context.Context, asset entity.Asset) (entity.Asset, error) {
+	sqlStatement := `
+        UPDATE assets
+        SET name = $1, precision = $2, min_deposit = $3, min_withdrawal = $4,
+            deposit_enabled = $5, withdraw_enabled = $6, trade_enabled = $7, updated_at = $8
+        WHERE code = $9
+        RETURNING created_at, updated_at;
+    `
+	err := queryer(ctx, r.db).QueryRowContext(ctx, sqlStatement, asset.Name, asset.Precision, asset.MinDeposit,
+		asset.MinWithdrawal, asset.DepositEnabled, asset.WithdrawEnabled, asset.TradeEnabled, time.Now(), asset.Code).
+		Scan(&asset.CreatedAt, &asset.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Asset{}, fmt.Errorf("%w: %s", ErrAssetNotFound, asset.Code)
+	}
+	if err != nil {
+		return entity.Asset{}, fmt.Errorf("error while updating asset %s: %w", asset.Code, err)
+	}
+	return asset, nil
+}
+
+func (r *AssetRepository) FindAsset(ctx context.Context, code string) (entity.Asset, error) {
+	sqlStatement := `
+        SELECT ` + assetColumns + `
+        FROM assets WHERE code = $1;
+    `
+	var asset entity.Asset
+	err := queryer(ctx, r.db).QueryRowContext(ctx, sqlStatement, code).Scan(assetFields(&asset)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Asset{}, fmt.Errorf("%w: %s", ErrAssetNotFound, code)
+	}
+	if err != nil {
+		return entity.Asset{}, fmt.Errorf("error while finding asset: %w", err)
+	}
+	return asset, nil
+}
+
+func (r *AssetRepository) FindAllAssets(ctx context.Context) ([]entity.Asset, error) {
+	sqlStatement := `
+        SELECT ` + assetColumns + `
+        FROM assets ORDER BY code;
+    `
+	rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching assets: %w", err)
+	}
+	defer rows.Close()
+
+	var assets []entity.Asset
+	for rows.Next() {
+		var asset entity.Asset
+		if err = rows.Scan(assetFields(&asset)...); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// PrecisionOf returns the number of decimal places of an asset, or
+// decimal.Scale for an asset missing from the registry.
+func PrecisionOf(ctx context.Context, assets IAssetRepository, code string) (int32, error) {
+	asset, err := assets.FindAsset(ctx, code)
+	if errors.Is(err, ErrAssetNotFound) {
+		return decimal.Scale, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return asset.Precision, nil
+}
+
+const assetColumns = `code, name, precision, min_deposit, min_withdrawal,
+               deposit_enabled, withdraw_enabled, trade_enabled, created_at, updated_at`
+
+func assetFields(asset *entity.Asset) []interface{} {
+	return []interface{}{
+		&asset.Code, &asset.Name, &asset.Precision, &asset.MinDeposit, &asset.MinWithdrawal,
+		&asset.DepositEnabled, &asset.WithdrawEnabled, &asset.TradeEnabled, &asset.CreatedAt, &asset.UpdatedAt,
+	}
+}
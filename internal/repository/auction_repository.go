@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrAuctionNotFound = errors.New("auction not found")
+	ErrAuctionRunning  = errors.New("an auction is already running for this symbol")
+)
+
+type IAuctionRepository interface {
+	CreateAuction(ctx context.Context, auction entity.Auction) error
+	FindOpenAuctions(ctx context.Context) ([]entity.Auction, error)
+	FindLatestAuction(ctx context.Context, symbol string) (entity.Auction, error)
+	UpdateAuction(ctx context.Context, auction *entity.Auction) error
+}
+
+type AuctionRepository struct {
+	db *sql.DB
+}
+
+func NewAuctionRepository(db *sql.DB) *AuctionRepository {
+	return &AuctionRepository{db: db}
+}
+
+const auctionColumns = `id, symbol, COALESCE(reason, ''), started_at, ends_at, indicative_price, indicative_volume,
+        clearing_price, cleared_volume, completed_at`
+
+func auctionFields(auction *entity.Auction) []interface{} {
+	return []interface{}{
+		&auction.ID, &auction.Symbol, &auction.Reason, &auction.StartedAt, &auction.EndsAt,
+		&auction.IndicativePrice, &auction.IndicativeVolume, &auction.ClearingPrice, &auction.ClearedVolume,
+		&auction.CompletedAt,
+	}
+}
+
+// CreateAuction starts an auction, unless one is already running for the
+// symbol.
+func (r *AuctionRepository) CreateAuction(ctx context.Context, auction entity.Auction) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var running bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM auctions WHERE symbol = $1 AND completed_at IS NULL)", auction.Symbol).
+		Scan(&running)
+	if err != nil {
+		return fmt.Errorf("error while checking running auctions: %w", err)
+	}
+	if running {
+		return ErrAuctionRunning
+	}
+
+	sqlStatement := `
+        INSERT INTO auctions (id, symbol, reason, started_at, ends_at)
+        VALUES ($1, $2, $3, $4, $5);
+    `
+	_, err = tx.ExecContext(ctx, sqlStatement, auction.ID, auction.Symbol, auction.Reason, auction.StartedAt, auction.EndsAt)
+	if err != nil {
+		return fmt.Errorf("error while creating auction: %w", err)
+	}
+	return nil
+}
+
+func (r *AuctionRepository) FindOpenAuctions(ctx context.Context) ([]entity.Auction, error) {
+	sqlStatement := `
+        SELECT ` + auctionColumns + `
+        FROM auctions
+        WHERE completed_at IS NULL;
+    `
+	rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching open auctions: %w", err)
+	}
+	defer rows.Close()
+
+	var auctions []entity.Auction
+	for rows.Next() {
+		var auction entity.Auction
+		if err = rows.Scan(auctionFields(&auction)...); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		auctions = append(auctions, auction)
+	}
+	return auctions, rows.Err()
+}
+
+func (r *AuctionRepository) FindLatestAuction(ctx context.Context, symbol string) (entity.Auction, error) {
+	sqlStatement := `
+        SELECT ` + auctionColumns + `
+        FROM auctions
+        WHERE symbol = $1
+        ORDER BY started_at DESC
+        LIMIT 1;
+    `
+	var auction entity.Auction
+	err := queryer(ctx, r.db).QueryRowContext(ctx, sqlStatement, symbol).Scan(auctionFields(&auction)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Auction{}, ErrAuctionNotFound
+		}
+		return entity.Auction{}, fmt.Errorf("error while finding auction: %w", err)
+	}
+	return auction, nil
+}
+
+// UpdateAuction stores the indicative and clearing figures of an auction and
+// whether it has completed.
+func (r *AuctionRepository) UpdateAuction(ctx context.Context, auction *entity.Auction) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+        UPDATE auctions
+        SET indicative_price = $1, indicative_volume = $2, clearing_price = $3, cleared_volume = $4, completed_at = $5
+        WHERE id = $6;
+    `
+	_, err = tx.ExecContext(ctx, sqlStatement, auction.IndicativePrice, auction.IndicativeVolume,
+		auction.ClearingPrice, auction.ClearedVolume, auction.CompletedAt, auction.ID)
+	if err != nil {
+		return fmt.Errorf("error while updating auction: %w", err)
+	}
+	return nil
+}
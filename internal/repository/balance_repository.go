@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrNegativeBalance is returned when a move would take an available or
+// locked balance below zero, which the balances table refuses.
+var ErrNegativeBalance = errors.New("balance would go negative")
+
+// legacyBalanceColumns are the columns users held their balances in before
+// balances had a table of their own.
+var legacyBalanceColumns = map[string]string{
+	"BTC":  "btc_balance",
+	"USDT": "usdt_balance",
+}
+
+type IBalanceRepository interface {
+	FindBalances(ctx context.Context, userID uuid.UUID) ([]entity.Balance, error)
+	GetAvailable(ctx context.Context, userID uuid.UUID, asset string) (decimal.Decimal, error)
+	Credit(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error
+	Debit(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error
+	Lock(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error
+	Unlock(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error
+	MigrateBalanceColumns(ctx context.Context) error
+}
+
+type BalanceRepository struct {
+	db *sql.DB
+}
+
+func NewBalanceRepository(db *sql.DB) *BalanceRepository {
+	return &BalanceRepository{db: db}
+}
+
+// FindBalances returns every balance of a user, ordered by asset.
+func (r *BalanceRepository) FindBalances(ctx context.Context, userID uuid.UUID) ([]entity.Balance, error) {
+	sqlStatement := `
+        SELECT user_id, asset, available, locked, updated_at
+        FROM balances
+        WHERE user_id = $1
+        ORDER BY asset;
+    `
+	rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []entity.Balance
+	for rows.Next() {
+		var balance entity.Balance
+		err = rows.Scan(&balance.UserID, &balance.Asset, &balance.Available, &balance.Locked, &balance.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+	return balances, rows.Err()
+}
+
+// GetAvailable returns the user's available balance of an asset, locking the
+// row for update. An asset the user never held has a zero balance.
+func (r *BalanceRepository) GetAvailable(ctx context.Context, userID uuid.UUID, asset string) (decimal.Decimal, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	var available decimal.Decimal
+	err = tx.QueryRowContext(ctx,
+		"SELECT available FROM balances WHERE user_id = $1 AND asset = $2 FOR UPDATE", userID, asset).Scan(&available)
+	if errors.Is(err, sql.ErrNoRows) {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("error while getting %s balance: %w", asset, err)
+	}
+	return available, nil
+}
+
+// Credit adds amount to the user's available balance of an asset.
+func (r *BalanceRepository) Credit(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	if err := r.move(ctx, userID, asset, amount, decimal.Zero); err != nil {
+		return fmt.Errorf("error while increasing %s balance: %w", asset, err)
+	}
+	return nil
+}
+
+// Debit takes amount off the user's available balance of an asset.
+func (r *BalanceRepository) Debit(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	if err := r.move(ctx, userID, asset, amount.Neg(), decimal.Zero); err != nil {
+		return fmt.Errorf("error while decreasing %s balance: %w", asset, err)
+	}
+	return nil
+}
+
+// Lock moves amount of an asset from the user's available balance to their
+// locked balance.
+func (r *BalanceRepository) Lock(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	if err := r.move(ctx, userID, asset, amount.Neg(), amount); err != nil {
+		return fmt.Errorf("error while locking %s: %w", asset, err)
+	}
+	return nil
+}
+
+// Unlock moves amount of an asset from the user's locked balance back to
+// their available balance.
+func (r *BalanceRepository) Unlock(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	if err := r.move(ctx, userID, asset, amount, amount.Neg()); err != nil {
+		return fmt.Errorf("error while unlocking %s: %w", asset, err)
+	}
+	return nil
+}
+
+// move adds to the available and locked balances of an asset, creating the
+// balance the first time the user holds the asset. It returns
+// ErrNegativeBalance when either balance would go below zero.
+func (r *BalanceRepository) move(ctx context.Context, userID uuid.UUID, asset string, available, locked decimal.Decimal) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO balances (user_id, asset, available, locked, updated_at)
+        VALUES ($1, $2, $3, $4, NOW())
+        ON CONFLICT (user_id, asset) DO UPDATE
+        SET available = balances.available + EXCLUDED.available,
+            locked = balances.locked + EXCLUDED.locked,
+            updated_at = NOW();
+    `, userID, asset, available, locked)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "check_violation" {
+		return fmt.Errorf("%w: %s of user %s", ErrNegativeBalance, asset, userID)
+	}
+	return err
+}
+
+// MigrateBalanceColumns moves the balances users still hold in the columns
+// of the users table into the balances table and drops the columns. Locked
+// balances are rebuilt from the locks. It does nothing once the columns are
+// gone.
+func (r *BalanceRepository) MigrateBalanceColumns(ctx context.Context) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	migrated := false
+	for asset, column := range legacyBalanceColumns {
+		var exists bool
+		err = tx.QueryRowContext(ctx, `
+            SELECT EXISTS (
+                SELECT 1 FROM information_schema.columns
+                WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = $1
+            );
+        `, column).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error while checking the %s column: %w", column, err)
+		}
+		if !exists {
+			continue
+		}
+
+		// column names come from legacyBalanceColumns, never from input
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+            INSERT INTO balances (user_id, asset, available, locked, updated_at)
+            SELECT id, $1, %s, 0, NOW() FROM users WHERE COALESCE(%s, 0) <> 0
+            ON CONFLICT (user_id, asset) DO UPDATE SET available = EXCLUDED.available, updated_at = NOW();
+        `, column, column), asset)
+		if err != nil {
+			return fmt.Errorf("error while migrating %s balances: %w", asset, err)
+		}
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE users DROP COLUMN %s", column)); err != nil {
+			return fmt.Errorf("error while dropping the %s column: %w", column, err)
+		}
+		migrated = true
+	}
+	if !migrated {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO balances (user_id, asset, available, locked, updated_at)
+        SELECT user_id, UPPER(asset), 0, SUM(amount), NOW() FROM locks GROUP BY user_id, UPPER(asset)
+        ON CONFLICT (user_id, asset) DO UPDATE SET locked = EXCLUDED.locked, updated_at = NOW();
+    `)
+	if err != nil {
+		return fmt.Errorf("error while migrating locked balances: %w", err)
+	}
+	return nil
+}
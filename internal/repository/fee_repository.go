@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+type IFeeRepository interface {
+	CreateFeeTiers(ctx context.Context, tiers []entity.FeeTier) error
+	FindFeeTiers(ctx context.Context) ([]entity.FeeTier, error)
+	FindTradedVolume(ctx context.Context, userID uuid.UUID, quoteAsset string, since time.Time) (decimal.Decimal, error)
+}
+
+type FeeRepository struct {
+	db *sql.DB
+}
+
+func NewFeeRepository(db *sql.DB) *FeeRepository {
+	return &FeeRepository{db: db}
+}
+
+// CreateFeeTiers registers the given tiers, leaving the ones that already
+// exist untouched.
+func (r *FeeRepository) CreateFeeTiers(ctx context.Context, tiers []entity.FeeTier) error {
+	sqlStatement := `
+        INSERT INTO fee_tiers (name, min_volume, maker_rate, taker_rate)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (name) DO NOTHING;
+    `
+	for _, tier := range tiers {
+		if _, err := queryer(ctx, r.db).ExecContext(ctx, sqlStatement, tier.Name, tier.MinVolume, tier.MakerRate, tier.TakerRate); err != nil {
+			return fmt.Errorf("error while creating fee tier %s: %w", tier.Name, err)
+		}
+	}
+	return nil
+}
+
+// FindFeeTiers returns the fee schedule, lowest volume first.
+func (r *FeeRepository) FindFeeTiers(ctx context.Context) ([]entity.FeeTier, error) {
+	rows, err := queryer(ctx, r.db).QueryContext(ctx,
+		"SELECT name, min_volume, maker_rate, taker_rate FROM fee_tiers ORDER BY min_volume ASC")
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving fee tiers: %w", err)
+	}
+	defer rows.Close()
+
+	var tiers []entity.FeeTier
+	for rows.Next() {
+		var tier entity.FeeTier
+		if err = rows.Scan(&tier.Name, &tier.MinVolume, &tier.MakerRate, &tier.TakerRate); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, rows.Err()
+}
+
+// FindTradedVolume sums the value of the user's trades since the given time
+// on symbols quoted in quoteAsset. Settled matches are soft deleted, so they
+// are counted too.
+func (r *FeeRepository) FindTradedVolume(ctx context.Context, userID uuid.UUID, quoteAsset string, since time.Time) (decimal.Decimal, error) {
+	sqlStatement := `
+        SELECT COALESCE(SUM(m.price * m.order_quantity), 0)
+        FROM order_matches m
+        JOIN symbols s ON s.name = m.symbol
+        WHERE s.quote_asset = $2 AND m.matched_at >= $3
+          AND EXISTS (SELECT 1 FROM orders o WHERE o.id IN (m.order_id1, m.order_id2) AND o.user_id = $1);
+    `
+	var volume decimal.Decimal
+	err := queryer(ctx, r.db).QueryRowContext(ctx, sqlStatement, userID, quoteAsset, since).Scan(&volume)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("error while summing traded volume: %w", err)
+	}
+	return volume, nil
+}
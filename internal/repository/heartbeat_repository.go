@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+type IHeartbeatRepository interface {
+	SaveHeartbeat(ctx context.Context, heartbeat entity.Heartbeat) error
+	DeleteHeartbeat(ctx context.Context, userID uuid.UUID) error
+	FindExpiredHeartbeats(ctx context.Context, now time.Time) ([]entity.Heartbeat, error)
+}
+
+type HeartbeatRepository struct {
+	db *sql.DB
+}
+
+func NewHeartbeatRepository(db *sql.DB) *HeartbeatRepository {
+	return &HeartbeatRepository{db: db}
+}
+
+// SaveHeartbeat arms the user's switch or pushes its expiry further out.
+func (r *HeartbeatRepository) SaveHeartbeat(ctx context.Context, heartbeat entity.Heartbeat) error {
+	sqlStatement := `
+        INSERT INTO heartbeats (user_id, timeout_seconds, expires_at, updated_at)
+        VALUES ($1, $2, $3, NOW())
+        ON CONFLICT (user_id) DO UPDATE
+        SET timeout_seconds = EXCLUDED.timeout_seconds, expires_at = EXCLUDED.expires_at, updated_at = NOW();
+    `
+	_, err := queryer(ctx, r.db).ExecContext(ctx, sqlStatement, heartbeat.UserID, heartbeat.TimeoutSeconds, heartbeat.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error while saving heartbeat: %w", err)
+	}
+	return nil
+}
+
+// DeleteHeartbeat disarms the user's switch.
+func (r *HeartbeatRepository) DeleteHeartbeat(ctx context.Context, userID uuid.UUID) error {
+	_, err := queryer(ctx, r.db).ExecContext(ctx, "DELETE FROM heartbeats WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("error while deleting heartbeat: %w", err)
+	}
+	return nil
+}
+
+// FindExpiredHeartbeats returns and disarms every switch whose heartbeat is
+// overdue. A heartbeat that arrives meanwhile waits for the transaction and
+// arms the switch again.
+func (r *HeartbeatRepository) FindExpiredHeartbeats(ctx context.Context, now time.Time) ([]entity.Heartbeat, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+        DELETE FROM heartbeats
+        WHERE expires_at <= $1
+        RETURNING user_id, timeout_seconds, expires_at, updated_at;
+    `
+	rows, err := tx.QueryContext(ctx, sqlStatement, now)
+	if err != nil {
+		return nil, fmt.Errorf("error while retrieving expired heartbeats: %w", err)
+	}
+	defer rows.Close()
+
+	var heartbeats []entity.Heartbeat
+	for rows.Next() {
+		var heartbeat entity.Heartbeat
+		if err = rows.Scan(&heartbeat.UserID, &heartbeat.TimeoutSeconds, &heartbeat.ExpiresAt, &heartbeat.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		heartbeats = append(heartbeats, heartbeat)
+	}
+	return heartbeats, rows.Err()
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/ledger"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+type ILedgerRepository interface {
+	PostJournal(ctx context.Context, journal *ledger.Journal) error
+	FindEntries(ctx context.Context, userID uuid.UUID) ([]entity.LedgerEntry, error)
+	FindMismatches(ctx context.Context) ([]ledger.Mismatch, error)
+	OpenLedger(ctx context.Context) error
+}
+
+type LedgerRepository struct {
+	db *sql.DB
+}
+
+func NewLedgerRepository(db *sql.DB) *LedgerRepository {
+	return &LedgerRepository{db: db}
+}
+
+// PostJournal stores the entries of a journal once it balances.
+func (r *LedgerRepository) PostJournal(ctx context.Context, journal *ledger.Journal) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err = journal.Validate(); err != nil {
+		return err
+	}
+
+	sqlStatement := `
+        INSERT INTO ledger_entries (id, journal_id, user_id, asset, account, amount, event_type, event_id, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+    `
+	for _, entry := range journal.Entries {
+		_, err = tx.ExecContext(ctx, sqlStatement, entry.ID, entry.JournalID, entry.UserID, entry.Asset, entry.Account,
+			entry.Amount, entry.EventType, entry.EventID, entry.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("error while posting %s journal: %w", journal.EventType, err)
+		}
+	}
+	return nil
+}
+
+// FindEntries returns the journal entries of a user, newest first.
+func (r *LedgerRepository) FindEntries(ctx context.Context, userID uuid.UUID) ([]entity.LedgerEntry, error) {
+	sqlStatement := `
+        SELECT id, journal_id, user_id, asset, account, amount, event_type, event_id, created_at
+        FROM ledger_entries
+        WHERE user_id = $1
+        ORDER BY created_at DESC, journal_id;
+    `
+	rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching ledger entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []entity.LedgerEntry
+	for rows.Next() {
+		var entry entity.LedgerEntry
+		err = rows.Scan(&entry.ID, &entry.JournalID, &entry.UserID, &entry.Asset, &entry.Account, &entry.Amount,
+			&entry.EventType, &entry.EventID, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// FindMismatches replays the journal and returns every available and
+// locked balance that differs from the sum of its entries.
+func (r *LedgerRepository) FindMismatches(ctx context.Context) ([]ledger.Mismatch, error) {
+	var mismatches []ledger.Mismatch
+	// the balance columns are named after the accounts they hold
+	for _, account := range []string{ledger.Available, ledger.Locked} {
+		sqlStatement := fmt.Sprintf(`
+            SELECT COALESCE(b.user_id, l.user_id), COALESCE(b.asset, l.asset), COALESCE(b.%s, 0), COALESCE(l.total, 0)
+            FROM balances b
+            FULL JOIN (
+                SELECT user_id, asset, SUM(amount) AS total FROM ledger_entries
+                WHERE account = $1 GROUP BY user_id, asset
+            ) l ON l.user_id = b.user_id AND l.asset = b.asset
+            WHERE COALESCE(b.%s, 0) <> COALESCE(l.total, 0)
+            ORDER BY 1, 2;
+        `, account, account)
+		rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement, account)
+		if err != nil {
+			return nil, fmt.Errorf("error while verifying %s balances: %w", account, err)
+		}
+		for rows.Next() {
+			mismatch := ledger.Mismatch{Account: account}
+			if err = rows.Scan(&mismatch.UserID, &mismatch.Asset, &mismatch.Balance, &mismatch.Journal); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("error while scanning row: %w", err)
+			}
+			mismatches = append(mismatches, mismatch)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mismatches, nil
+}
+
+// OpenLedger posts the balances held before the journal existed as one
+// opening journal, credited from each user's external account. It does
+// nothing once the journal has entries.
+func (r *LedgerRepository) OpenLedger(ctx context.Context) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var opened bool
+	if err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM ledger_entries)").Scan(&opened); err != nil {
+		return fmt.Errorf("error while checking the ledger: %w", err)
+	}
+	if opened {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT user_id, asset, available, locked FROM balances ORDER BY user_id, asset")
+	if err != nil {
+		return fmt.Errorf("error while reading opening balances: %w", err)
+	}
+	defer rows.Close()
+
+	// the opening journal is its own event
+	journal := ledger.NewJournal(ledger.Opening, uuid.Nil)
+	journal.EventID = journal.ID
+	for rows.Next() {
+		var balance entity.Balance
+		if err = rows.Scan(&balance.UserID, &balance.Asset, &balance.Available, &balance.Locked); err != nil {
+			return fmt.Errorf("error while scanning row: %w", err)
+		}
+		external := ledger.ExternalOf(balance.UserID)
+		journal.Transfer(balance.Asset, balance.Available, external, ledger.AvailableOf(balance.UserID)).
+			Transfer(balance.Asset, balance.Locked, external, ledger.LockedOf(balance.UserID))
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	return r.PostJournal(ctx, journal)
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/ledger"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// LockReleaser returns locked funds to their owner's available balance. It
+// moves the balance, journals the move and shrinks or deletes the lock, so
+// the order creator and the order checker release locks the same way.
+type LockReleaser struct {
+	lockRepo    ILockRepository
+	balanceRepo IBalanceRepository
+	assetRepo   IAssetRepository
+	ledgerRepo  ILedgerRepository
+}
+
+func NewLockReleaser(lockRepo ILockRepository, balanceRepo IBalanceRepository, assetRepo IAssetRepository,
+	ledgerRepo ILedgerRepository) *LockReleaser {
+	return &LockReleaser{lockRepo: lockRepo, balanceRepo: balanceRepo, assetRepo: assetRepo, ledgerRepo: ledgerRepo}
+}
+
+// Release returns up to amount of a lock to its owner's available balance,
+// never more than the lock still holds. Locks are taken rounded up to the
+// decimal places of their asset, so a partial release is rounded down to
+// them; what that leaves behind goes back once the lock's orders close. A
+// lock already released in full is left alone. The eventID is the order,
+// OCO pair or match it is released for.
+func (r *LockReleaser) Release(ctx context.Context, lockID uuid.UUID, amount decimal.Decimal, eventID uuid.UUID) error {
+	lock, err := r.lockRepo.FindLock(ctx, lockID)
+	if errors.Is(err, ErrLockNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if amount.LessThan(lock.Amount) {
+		precision, err := PrecisionOf(ctx, r.assetRepo, lock.Asset)
+		if err != nil {
+			return err
+		}
+		amount = amount.RoundDown(precision)
+	}
+	return r.Unlock(ctx, lock, decimal.Min(amount, lock.Amount), eventID)
+}
+
+// ReleaseRemainder releases everything a lock still holds, once the orders
+// it was taken for are closed.
+func (r *LockReleaser) ReleaseRemainder(ctx context.Context, lockID uuid.UUID, eventID uuid.UUID) error {
+	lock, err := r.lockRepo.FindLock(ctx, lockID)
+	if errors.Is(err, ErrLockNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.Unlock(ctx, lock, lock.Amount, eventID)
+}
+
+// Unlock releases amount of a lock the caller already holds, deleting the
+// lock once nothing is left in it.
+func (r *LockReleaser) Unlock(ctx context.Context, lock entity.Lock, amount decimal.Decimal, eventID uuid.UUID) error {
+	if amount.IsPositive() {
+		if err := r.balanceRepo.Unlock(ctx, lock.UserID, lock.Asset, amount); err != nil {
+			return err
+		}
+		journal := ledger.NewJournal(ledger.Unlock, eventID).
+			Transfer(lock.Asset, amount, ledger.LockedOf(lock.UserID), ledger.AvailableOf(lock.UserID))
+		if err := r.ledgerRepo.PostJournal(ctx, journal); err != nil {
+			return err
+		}
+	}
+	if amount.GreaterThanOrEqual(lock.Amount) {
+		if err := r.lockRepo.DeleteLock(ctx, lock.ID); err != nil {
+			return fmt.Errorf("failed to delete %s lock: %w", lock.Asset, err)
+		}
+		return nil
+	}
+	if err := r.lockRepo.UpdateLockAmount(ctx, lock.ID, amount); err != nil {
+		return fmt.Errorf("failed to update %s lock amount: %w", lock.Asset, err)
+	}
+	return nil
+}
@@ -2,21 +2,24 @@ package repository
 
 import (
 	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
 	"bitcoinOrder/pkg/utils"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 )
 
+var ErrLockNotFound = errors.New("lock not found")
+
 type ILockRepository interface {
-	GetUserBalance(ctx context.Context, userID uuid.UUID, asset string) (float64, error)
-	DecreaseUserBalance(ctx context.Context, userID uuid.UUID, asset string, amount float64) error
 	CreateLock(ctx context.Context, lock entity.Lock) error
-	GetLockedAmount(ctx context.Context, userID uuid.UUID, asset string) (float64, error)
-	IncreaseUserBalance(ctx context.Context, userID uuid.UUID, asset string, amount float64) error
-	DeleteLock(ctx context.Context, userID uuid.UUID, asset string) error
-	UpdateLockAmount(ctx context.Context, userID uuid.UUID, asset string, amount float64) error
+	FindLock(ctx context.Context, orderID uuid.UUID) (entity.Lock, error)
+	FindClosedLocks(ctx context.Context) ([]entity.Lock, error)
+	FindLegacyLocks(ctx context.Context) ([]entity.Lock, error)
+	DeleteLock(ctx context.Context, lockID uuid.UUID) error
+	UpdateLockAmount(ctx context.Context, lockID uuid.UUID, amount decimal.Decimal) error
 }
 
 type LockRepository struct {
@@ -27,114 +30,119 @@ type LockRepository struct {
 func NewLockRepository(db *sql.DB) *LockRepository {
 	return &LockRepository{db: db}
 }
-func (r *LockRepository) GetUserBalance(ctx context.Context, userID uuid.UUID, asset string) (float64, error) {
 
-	tx, err := utils.TxFromContext(ctx)
-	if err != nil {
-		return 0, err
-	}
-	var balance float64
-	sqlStatement := fmt.Sprintf("SELECT %s_balance FROM users WHERE id = $1", asset)
-	err = tx.QueryRowContext(ctx, sqlStatement, userID).Scan(&balance)
-	if err != nil {
-		return 0, fmt.Errorf("error while getting %s balance: %w", asset, err)
-	}
-	return balance, nil
-}
+// CreateLock locks funds for the order named by lock.OrderID, adding to the
+// order's lock if it already holds one.
+func (r *LockRepository) CreateLock(ctx context.Context, lock entity.Lock) error {
 
-func (r *LockRepository) DecreaseUserBalance(ctx context.Context, userID uuid.UUID, asset string, amount float64) error {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	sqlStatement := fmt.Sprintf(`
-        UPDATE users
-        SET %s_balance = %s_balance - $1
-        WHERE id = $2;
-    `, asset, asset)
-	_, err = tx.ExecContext(ctx, sqlStatement, amount, userID)
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO locks (user_id, order_id, asset, amount, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, NOW(), NOW())
+        ON CONFLICT (order_id) DO UPDATE SET amount = locks.amount + EXCLUDED.amount, updated_at = NOW();
+    `, lock.UserID, lock.OrderID, lock.Asset, lock.Amount)
 	if err != nil {
-		return fmt.Errorf("error while decreasing %s balance: %w", asset, err)
+		return fmt.Errorf("error while creating lock: %w", err)
 	}
 	return nil
 }
 
-func (r *LockRepository) CreateLock(ctx context.Context, lock entity.Lock) error {
-
+// FindLock returns the lock held for an order, locked for update, or
+// ErrLockNotFound once it has been released.
+func (r *LockRepository) FindLock(ctx context.Context, orderID uuid.UUID) (entity.Lock, error) {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
-		return err
+		return entity.Lock{}, err
 	}
 
+	var lock entity.Lock
 	err = tx.QueryRowContext(ctx,
-		"INSERT INTO locks (user_id, asset, amount) VALUES ($1, $2, $3) RETURNING id",
-		lock.UserID, lock.Asset, lock.Amount).Scan(&lock.ID)
+		"SELECT id, order_id, user_id, asset, amount FROM locks WHERE order_id = $1 FOR UPDATE", orderID).
+		Scan(&lock.ID, &lock.OrderID, &lock.UserID, &lock.Asset, &lock.Amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Lock{}, ErrLockNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("error while creating lock: %w", err)
+		return entity.Lock{}, fmt.Errorf("error while fetching lock: %w", err)
 	}
-	return nil
+	return lock, nil
 }
 
-// converting NULL COALESCE(SUM(amount), 0) band-aid
-func (r *LockRepository) GetLockedAmount(ctx context.Context, userID uuid.UUID, asset string) (float64, error) {
-	tx, err := utils.TxFromContext(ctx)
-	if err != nil {
-		return 0, err
-	}
+// FindClosedLocks returns the locks whose orders are all closed, which still
+// hold whatever the fills and releases of those orders did not use up.
+func (r *LockRepository) FindClosedLocks(ctx context.Context) ([]entity.Lock, error) {
+	return r.findLocks(ctx, `
+        SELECT l.id, l.order_id, l.user_id, l.asset, l.amount
+        FROM locks l
+        WHERE l.order_id IS NOT NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM orders o
+              WHERE (o.id = l.order_id OR o.oco_group_id = l.order_id)
+                AND o.order_status = true AND o.deleted_at IS NULL
+          )
+        FOR UPDATE OF l;
+    `)
+}
 
-	var lockedAmount float64
-	err = tx.QueryRowContext(ctx,
-		"SELECT COALESCE(SUM(amount), 0) FROM locks WHERE user_id = $1 AND asset = $2", userID, asset).Scan(&lockedAmount)
-	if err != nil {
-		return 0, fmt.Errorf("error while getting locked %s balance: %w", asset, err)
-	}
-	return lockedAmount, nil
+// FindLegacyLocks returns the locks taken before locks were per order, which
+// pool the funds of all of a user's orders in one asset.
+func (r *LockRepository) FindLegacyLocks(ctx context.Context) ([]entity.Lock, error) {
+	return r.findLocks(ctx,
+		"SELECT id, order_id, user_id, asset, amount FROM locks WHERE order_id IS NULL FOR UPDATE")
 }
 
-func (r *LockRepository) IncreaseUserBalance(ctx context.Context, userID uuid.UUID, asset string, amount float64) error {
+func (r *LockRepository) findLocks(ctx context.Context, sqlStatement string) ([]entity.Lock, error) {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	sqlStatement := fmt.Sprintf(`
-        UPDATE users
-        SET %s_balance = %s_balance + $1 
-        WHERE id = $2;
-    `, asset, asset)
-	_, err = tx.ExecContext(ctx, sqlStatement, amount, userID)
+	rows, err := tx.QueryContext(ctx, sqlStatement)
 	if err != nil {
-		return fmt.Errorf("error while increasing %s balance: %w", asset, err)
+		return nil, fmt.Errorf("error while fetching locks: %w", err)
 	}
-	return nil
+	defer rows.Close()
+
+	var locks []entity.Lock
+	for rows.Next() {
+		var lock entity.Lock
+		if err = rows.Scan(&lock.ID, &lock.OrderID, &lock.UserID, &lock.Asset, &lock.Amount); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		locks = append(locks, lock)
+	}
+	return locks, rows.Err()
 }
 
-func (r *LockRepository) DeleteLock(ctx context.Context, userID uuid.UUID, asset string) error {
+// DeleteLock deletes a lock by its own ID.
+func (r *LockRepository) DeleteLock(ctx context.Context, lockID uuid.UUID) error {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.ExecContext(ctx,
-		"DELETE FROM locks WHERE user_id = $1 AND asset = $2", userID, asset)
+	_, err = tx.ExecContext(ctx, "DELETE FROM locks WHERE id = $1", lockID)
 	if err != nil {
 		return fmt.Errorf("error while deleting lock: %w", err)
 	}
 	return nil
 }
 
-func (r *LockRepository) UpdateLockAmount(ctx context.Context, userID uuid.UUID, asset string, amount float64) error {
+// UpdateLockAmount takes amount off a lock.
+func (r *LockRepository) UpdateLockAmount(ctx context.Context, lockID uuid.UUID, amount decimal.Decimal) error {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
 		return err
 	}
 
 	_, err = tx.ExecContext(ctx,
-		"UPDATE locks SET amount = amount - $1 WHERE user_id = $2 AND asset = $3",
-		amount, userID, asset)
+		"UPDATE locks SET amount = amount - $1, updated_at = NOW() WHERE id = $2", amount, lockID)
 	if err != nil {
-		return fmt.Errorf("error while updating locked %s balance: %w", asset, err)
+		return fmt.Errorf("error while updating lock amount: %w", err)
 	}
 	return nil
 }
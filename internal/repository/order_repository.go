@@ -2,9 +2,11 @@ package repository
 
 import (
 	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
 	"bitcoinOrder/pkg/utils"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -17,10 +19,21 @@ type IOrderRepository interface {
 	CreateOrder(ctx context.Context, newOrder entity.Order) (entity.Order, error)
 	SoftDeleteOrder(ctx context.Context, orderId uuid.UUID) error
 	FindOpenOrdersByUser(ctx context.Context, userID uuid.UUID) ([]entity.Order, error)
+	FindBestPrice(ctx context.Context, symbol, orderType string) (decimal.Decimal, bool, error)
+	FindLastTradePrice(ctx context.Context, symbol string) (decimal.Decimal, bool, error)
+	FindOrdersByOcoGroup(ctx context.Context, groupID uuid.UUID) ([]entity.Order, error)
 	FindAllOrders(ctx context.Context) ([]entity.Order, error)
+	FindOrderForUpdate(ctx context.Context, orderID uuid.UUID) (entity.Order, error)
+	FindOpenOrdersForUpdate(ctx context.Context, userID uuid.UUID, symbol, orderType string) ([]entity.Order, error)
 	UpdateOrder(ctx context.Context, order entity.Order) error
 }
 
+var (
+	ErrOrderNotFound  = errors.New("order not found")
+	ErrOrderCancelled = errors.New("order was cancelled")
+	ErrOrderChanged   = errors.New("order was changed by its owner")
+)
+
 type OrderRepository struct {
 	gormDB *gorm.DB
 	db     *sql.DB
@@ -41,12 +54,21 @@ func (o *OrderRepository) CreateOrder(ctx context.Context, newOrder entity.Order
 
 	userIDStr := newOrder.UserID.String()
 	var sqlStatement = `
-        INSERT INTO orders (id, user_id, type, order_quantity, order_price, order_status, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
-        RETURNING id, created_at;
+        INSERT INTO orders (id, user_id, asset, type, kind, order_quantity, quote_amount, order_price, order_status,
+                            time_in_force, expires_at, post_only, reprice_on_cross, trigger_price,
+                            trailing_amount, trailing_percent,
+                            display_quantity, visible_quantity, oco_group_id, self_trade_prevention,
+                            created_at, updated_at, priority_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $21, $21)
+        RETURNING id, created_at, updated_at, priority_at;
     `
-	err = tx.QueryRowContext(ctx, sqlStatement, newOrder.ID, userIDStr, newOrder.Type, newOrder.OrderQuantity, newOrder.OrderPrice, newOrder.OrderStatus, time.Now()).
-		Scan(&newOrder.ID, &newOrder.CreatedAt)
+	err = tx.QueryRowContext(ctx, sqlStatement, newOrder.ID, userIDStr, newOrder.Asset, newOrder.Type, newOrder.Kind, newOrder.OrderQuantity,
+		newOrder.QuoteAmount, newOrder.OrderPrice, newOrder.OrderStatus, newOrder.TimeInForce, newOrder.ExpiresAt,
+		newOrder.PostOnly, newOrder.RepriceOnCross, newOrder.TriggerPrice,
+		newOrder.TrailingAmount, newOrder.TrailingPercent,
+		newOrder.DisplayQuantity, newOrder.VisibleQuantity, newOrder.OcoGroupID,
+		newOrder.SelfTradePrevention, time.Now()).
+		Scan(&newOrder.ID, &newOrder.CreatedAt, &newOrder.UpdatedAt, &newOrder.PriorityAt)
 	if err != nil {
 		return entity.Order{}, fmt.Errorf("an error occurred while creating the order: %w", err)
 	}
@@ -61,10 +83,12 @@ func (o *OrderRepository) UpdateOrder(ctx context.Context, order entity.Order) e
 	}
 	sqlStatement := `
         UPDATE orders
-        SET order_quantity = $1
-        WHERE id = $2;
+        SET order_price = $1, order_quantity = $2, visible_quantity = $3, priority_at = $4, version = version + 1,
+            updated_at = NOW()
+        WHERE id = $5;
     `
-	_, err = tx.ExecContext(ctx, sqlStatement, order.OrderQuantity, order.ID)
+	_, err = tx.ExecContext(ctx, sqlStatement, order.OrderPrice, order.OrderQuantity, order.VisibleQuantity,
+		order.PriorityAt, order.ID)
 	if err != nil {
 		return fmt.Errorf("an error occurred while updating the order: %w", err)
 	}
@@ -113,19 +137,191 @@ func (o *OrderRepository) FindOpenBuyOrders() ([]entity.Order, error) {
 
 func (o *OrderRepository) FindOpenOrdersByUser(ctx context.Context, userID uuid.UUID) ([]entity.Order, error) {
 	sqlStatement := `
-        SELECT id, user_id, type, order_quantity, order_price, order_status, created_at, completed_at
+        SELECT id, user_id, asset, type, kind, order_quantity, quote_amount, order_price, order_status,
+               time_in_force, expires_at, display_quantity, self_trade_prevention, created_at, completed_at
         FROM orders
         WHERE user_id = $1 AND deleted_at IS NULL AND order_status = true; 
     `
 	return o.fetchOrdersByUser(ctx, sqlStatement, userID)
 }
 
+// FindBestPrice returns the highest open buy price or the lowest open sell
+// price of a symbol. The boolean is false when that side has no open limit
+// orders.
+func (o *OrderRepository) FindBestPrice(ctx context.Context, symbol, orderType string) (decimal.Decimal, bool, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return decimal.Zero, false, err
+	}
+
+	aggregate := "MIN"
+	if orderType == utils.BuyOrder {
+		aggregate = "MAX"
+	}
+	sqlStatement := fmt.Sprintf(`
+        SELECT %s(order_price)
+        FROM orders
+        WHERE asset = $1 AND type = $2 AND kind = $3 AND order_status = true AND deleted_at IS NULL;
+    `, aggregate)
+
+	var price *decimal.Decimal
+	err = tx.QueryRowContext(ctx, sqlStatement, symbol, orderType, utils.LimitOrder).Scan(&price)
+	if err != nil {
+		return decimal.Zero, false, fmt.Errorf("an error occurred while finding the best %s price: %w", orderType, err)
+	}
+	if price == nil {
+		return decimal.Zero, false, nil
+	}
+	return *price, true, nil
+}
+
+// FindLastTradePrice returns the price of the latest trade of a symbol. The
+// boolean is false when the symbol has not traded yet. Settled matches are
+// soft deleted, so they are not filtered out.
+func (o *OrderRepository) FindLastTradePrice(ctx context.Context, symbol string) (decimal.Decimal, bool, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return decimal.Zero, false, err
+	}
+
+	sqlStatement := `
+        SELECT price
+        FROM order_matches
+        WHERE symbol = $1
+        ORDER BY matched_at DESC
+        LIMIT 1;
+    `
+	var price decimal.Decimal
+	err = tx.QueryRowContext(ctx, sqlStatement, symbol).Scan(&price)
+	if errors.Is(err, sql.ErrNoRows) {
+		return decimal.Zero, false, nil
+	}
+	if err != nil {
+		return decimal.Zero, false, fmt.Errorf("an error occurred while finding the last trade price: %w", err)
+	}
+	return price, true, nil
+}
+
+// FindOrderForUpdate returns one order, locked for update so it can be
+// changed without racing another request.
+func (o *OrderRepository) FindOrderForUpdate(ctx context.Context, orderID uuid.UUID) (entity.Order, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return entity.Order{}, err
+	}
+
+	sqlStatement := `
+        SELECT ` + lockedOrderColumns + `
+        FROM orders
+        WHERE id = $1
+        FOR UPDATE;
+    `
+	var order entity.Order
+	err = tx.QueryRowContext(ctx, sqlStatement, orderID).Scan(lockedOrderFields(&order)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Order{}, ErrOrderNotFound
+	}
+	if err != nil {
+		return entity.Order{}, fmt.Errorf("an error occurred while retrieving the order: %w", err)
+	}
+	return order, nil
+}
+
+// FindOpenOrdersForUpdate returns the user's open orders, optionally only
+// those of one symbol or one side, locked for update so they can be
+// cancelled together.
+func (o *OrderRepository) FindOpenOrdersForUpdate(ctx context.Context, userID uuid.UUID, symbol, orderType string) ([]entity.Order, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+        SELECT ` + lockedOrderColumns + `
+        FROM orders
+        WHERE user_id = $1 AND order_status = true AND deleted_at IS NULL
+          AND ($2 = '' OR asset = $2) AND ($3 = '' OR type = $3)
+        ORDER BY created_at ASC
+        FOR UPDATE;
+    `
+	rows, err := tx.QueryContext(ctx, sqlStatement, userID, symbol, orderType)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while retrieving open orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []entity.Order
+	for rows.Next() {
+		var order entity.Order
+		if err = rows.Scan(lockedOrderFields(&order)...); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating open orders: %w", err)
+	}
+	return orders, nil
+}
+
+const lockedOrderColumns = `id, user_id, asset, type, kind, order_quantity, quote_amount, order_price, order_status,
+               time_in_force, post_only, display_quantity, visible_quantity, oco_group_id,
+               COALESCE(priority_at, created_at), created_at, completed_at, deleted_at`
+
+func lockedOrderFields(order *entity.Order) []interface{} {
+	return []interface{}{
+		&order.ID, &order.UserID, &order.Asset, &order.Type, &order.Kind, &order.OrderQuantity, &order.QuoteAmount,
+		&order.OrderPrice, &order.OrderStatus, &order.TimeInForce, &order.PostOnly, &order.DisplayQuantity,
+		&order.VisibleQuantity, &order.OcoGroupID, &order.PriorityAt, &order.CreatedAt, &order.CompletedAt, &order.DeletedAt,
+	}
+}
+
+// FindOrdersByOcoGroup returns both legs of an OCO pair, locked for update so
+// the pair can be cancelled as one unit.
+func (o *OrderRepository) FindOrdersByOcoGroup(ctx context.Context, groupID uuid.UUID) ([]entity.Order, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+        SELECT id, user_id, asset, type, kind, order_quantity, quote_amount, order_price, order_status,
+               trigger_price, oco_group_id, created_at, completed_at, deleted_at
+        FROM orders
+        WHERE oco_group_id = $1
+        ORDER BY created_at ASC
+        FOR UPDATE;
+    `
+	rows, err := tx.QueryContext(ctx, sqlStatement, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while retrieving OCO orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []entity.Order
+	for rows.Next() {
+		var order entity.Order
+		err = rows.Scan(&order.ID, &order.UserID, &order.Asset, &order.Type, &order.Kind, &order.OrderQuantity, &order.QuoteAmount,
+			&order.OrderPrice, &order.OrderStatus, &order.TriggerPrice, &order.OcoGroupID,
+			&order.CreatedAt, &order.CompletedAt, &order.DeletedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating OCO orders: %w", err)
+	}
+	return orders, nil
+}
+
 func (o *OrderRepository) FindAllOrders(ctx context.Context) ([]entity.Order, error) {
 	sqlStatement := `
      SELECT
-		 o.id, o.user_id, o.type, o.order_quantity, o.order_price, o.order_status,
-		 o.created_at, o.completed_at,
-		 u.id AS user_id, u.email, u.btc_balance, u.usdt_balance, u.created_at AS user_created_at,
+		 o.id, o.user_id, o.asset, o.type, o.kind, o.order_quantity, o.quote_amount, o.order_price, o.order_status,
+		 o.time_in_force, o.expires_at, o.trigger_price, o.trailing_amount, o.trailing_percent,
+		 o.display_quantity, o.visible_quantity, o.created_at, o.completed_at,
+		 u.id AS user_id, u.email, u.created_at AS user_created_at,
 		 u.updated_at AS user_updated_at, u.deleted_at AS user_deleted_at
 	 FROM orders o 
      JOIN users u ON o.user_id = u.id
@@ -156,13 +352,12 @@ func (o *OrderRepository) fetchOrders(ctx context.Context, sqlStatement string,
 			var userIDStr string
 
 			var userEmail sql.NullString
-			var userBtcBalance, userUsdtBalance sql.NullFloat64
 			var userCreatedAt, userUpdatedAt, userDeletedAt sql.NullTime
 
 			err := rows.Scan(
 				&order.ID, &userIDStr, &order.Type, &order.OrderQuantity,
 				&order.OrderPrice, &order.OrderStatus, &order.CreatedAt, &order.CompletedAt,
-				&order.User.ID, &userEmail, &userBtcBalance, &userUsdtBalance,
+				&order.User.ID, &userEmail,
 				&userCreatedAt, &userUpdatedAt, &userDeletedAt,
 			)
 			if err != nil {
@@ -175,12 +370,6 @@ func (o *OrderRepository) fetchOrders(ctx context.Context, sqlStatement string,
 			}
 
 			order.User.Email = userEmail.String
-			if userBtcBalance.Valid {
-				order.User.BtcBalance = &userBtcBalance.Float64
-			}
-			if userUsdtBalance.Valid {
-				order.User.UsdtBalance = &userUsdtBalance.Float64
-			}
 			order.User.CreatedAt = userCreatedAt.Time
 			if userUpdatedAt.Valid {
 				t := userUpdatedAt.Time
@@ -221,13 +410,14 @@ func (o *OrderRepository) fetchOrdersWithUser(ctx context.Context, sqlStatement
 			var userIDStr string
 
 			var userEmail sql.NullString
-			var userBtcBalance, userUsdtBalance sql.NullFloat64
 			var userCreatedAt, userUpdatedAt, userDeletedAt sql.NullTime
 
 			err := rows.Scan(
-				&order.ID, &userIDStr, &order.Type, &order.OrderQuantity,
-				&order.OrderPrice, &order.OrderStatus, &order.CreatedAt, &order.CompletedAt,
-				&order.User.ID, &userEmail, &userBtcBalance, &userUsdtBalance,
+				&order.ID, &userIDStr, &order.Asset, &order.Type, &order.Kind, &order.OrderQuantity, &order.QuoteAmount,
+				&order.OrderPrice, &order.OrderStatus, &order.TimeInForce, &order.ExpiresAt,
+				&order.TriggerPrice, &order.TrailingAmount, &order.TrailingPercent,
+				&order.DisplayQuantity, &order.VisibleQuantity, &order.CreatedAt, &order.CompletedAt,
+				&order.User.ID, &userEmail,
 				&userCreatedAt, &userUpdatedAt, &userDeletedAt,
 			)
 			if err != nil {
@@ -240,12 +430,6 @@ func (o *OrderRepository) fetchOrdersWithUser(ctx context.Context, sqlStatement
 			}
 
 			order.User.Email = userEmail.String
-			if userBtcBalance.Valid {
-				order.User.BtcBalance = &userBtcBalance.Float64
-			}
-			if userUsdtBalance.Valid {
-				order.User.UsdtBalance = &userUsdtBalance.Float64
-			}
 			order.User.CreatedAt = userCreatedAt.Time
 			if userUpdatedAt.Valid {
 				t := userUpdatedAt.Time
@@ -284,7 +468,9 @@ func (o *OrderRepository) fetchOrdersByUser(ctx context.Context, sqlStatement st
 		for rows.Next() {
 			var order entity.Order
 			var userIDStr string
-			err := rows.Scan(&order.ID, &userIDStr, &order.Type, &order.OrderQuantity, &order.OrderPrice, &order.OrderStatus, &order.CreatedAt, &order.CompletedAt)
+			err := rows.Scan(&order.ID, &userIDStr, &order.Asset, &order.Type, &order.Kind, &order.OrderQuantity, &order.QuoteAmount,
+				&order.OrderPrice, &order.OrderStatus, &order.TimeInForce, &order.ExpiresAt, &order.DisplayQuantity,
+				&order.SelfTradePrevention, &order.CreatedAt, &order.CompletedAt)
 			if err != nil {
 				return nil, fmt.Errorf("error while scanning row: %w", err)
 			}
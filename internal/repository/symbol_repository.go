@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrSymbolNotFound = errors.New("symbol not found")
+
+type ISymbolRepository interface {
+	CreateSymbols(ctx context.Context, symbols []entity.Symbol) error
+	FindSymbol(ctx context.Context, name string) (entity.Symbol, error)
+	FindSymbolForUpdate(ctx context.Context, name string) (entity.Symbol, error)
+	FindAllSymbols(ctx context.Context) ([]entity.Symbol, error)
+	UpdateSymbolStatus(ctx context.Context, change entity.SymbolStatusChange) error
+	FindSymbolStatusChanges(ctx context.Context, name string) ([]entity.SymbolStatusChange, error)
+}
+
+type SymbolRepository struct {
+	db *sql.DB
+}
+
+func NewSymbolRepository(db *sql.DB) *SymbolRepository {
+	return &SymbolRepository{db: db}
+}
+
+// CreateSymbols registers the given symbols, leaving the ones that already
+// exist untouched.
+func (r *SymbolRepository) CreateSymbols(ctx context.Context, symbols []entity.Symbol) error {
+	sqlStatement := `
+        INSERT INTO symbols (name, base_asset, quote_asset, tick_size, step_size,
+                             min_quantity, max_quantity, min_notional,
+                             price_band, breaker_move, breaker_window_seconds, breaker_cooldown_seconds,
+                             reopen_auction_seconds, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $14)
+        ON CONFLICT (name) DO NOTHING;
+    `
+	for _, symbol := range symbols {
+		if _, err := r.db.ExecContext(ctx, sqlStatement, symbol.Name, symbol.BaseAsset, symbol.QuoteAsset,
+			symbol.TickSize, symbol.StepSize, symbol.MinQuantity, symbol.MaxQuantity, symbol.MinNotional,
+			symbol.PriceBand, symbol.BreakerMove, symbol.BreakerWindowSeconds, symbol.BreakerCooldownSeconds,
+			symbol.ReopenAuctionSeconds, time.Now()); err != nil {
+			return fmt.Errorf("error while creating symbol %s: %w", symbol.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *SymbolRepository) FindSymbol(ctx context.Context, name string) (entity.Symbol, error) {
+	return r.findSymbol(ctx, name, "")
+}
+
+// FindSymbolForUpdate locks the symbol's row until the transaction in ctx
+// ends, so status changes are applied one after another.
+func (r *SymbolRepository) FindSymbolForUpdate(ctx context.Context, name string) (entity.Symbol, error) {
+	if _, err := utils.TxFromContext(ctx); err != nil {
+		return entity.Symbol{}, err
+	}
+	return r.findSymbol(ctx, name, "FOR UPDATE")
+}
+
+func (r *SymbolRepository) findSymbol(ctx context.Context, name, lock string) (entity.Symbol, error) {
+	sqlStatement := `
+        SELECT ` + symbolColumns + `
+        FROM symbols WHERE name = $1 ` + lock + `;
+    `
+	var symbol entity.Symbol
+	err := queryer(ctx, r.db).QueryRowContext(ctx, sqlStatement, name).
+		Scan(symbolFields(&symbol)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return entity.Symbol{}, fmt.Errorf("%w: %s", ErrSymbolNotFound, name)
+		}
+		return entity.Symbol{}, fmt.Errorf("error while finding symbol: %w", err)
+	}
+	return symbol, nil
+}
+
+func (r *SymbolRepository) FindAllSymbols(ctx context.Context) ([]entity.Symbol, error) {
+	sqlStatement := `
+        SELECT ` + symbolColumns + `
+        FROM symbols ORDER BY name;
+    `
+	rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching symbols: %w", err)
+	}
+	defer rows.Close()
+
+	var symbols []entity.Symbol
+	for rows.Next() {
+		var symbol entity.Symbol
+		if err = rows.Scan(symbolFields(&symbol)...); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, rows.Err()
+}
+
+// UpdateSymbolStatus moves the symbol to the change's new status and records
+// the change.
+func (r *SymbolRepository) UpdateSymbolStatus(ctx context.Context, change entity.SymbolStatusChange) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE symbols SET status = $1, updated_at = $2 WHERE name = $3",
+		change.ToStatus, change.ChangedAt, change.Symbol)
+	if err != nil {
+		return fmt.Errorf("error while updating symbol status: %w", err)
+	}
+
+	sqlStatement := `
+        INSERT INTO symbol_status_changes (id, symbol, from_status, to_status, changed_by, reason, changed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7);
+    `
+	_, err = tx.ExecContext(ctx, sqlStatement, change.ID, change.Symbol, change.FromStatus, change.ToStatus,
+		change.ChangedBy, change.Reason, change.ChangedAt)
+	if err != nil {
+		return fmt.Errorf("error while recording symbol status change: %w", err)
+	}
+	return nil
+}
+
+// FindSymbolStatusChanges returns the status changes of a symbol, newest
+// first.
+func (r *SymbolRepository) FindSymbolStatusChanges(ctx context.Context, name string) ([]entity.SymbolStatusChange, error) {
+	sqlStatement := `
+        SELECT id, symbol, from_status, to_status, changed_by, reason, changed_at
+        FROM symbol_status_changes
+        WHERE symbol = $1
+        ORDER BY changed_at DESC;
+    `
+	rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement, name)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching symbol status changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []entity.SymbolStatusChange
+	for rows.Next() {
+		var change entity.SymbolStatusChange
+		err = rows.Scan(&change.ID, &change.Symbol, &change.FromStatus, &change.ToStatus,
+			&change.ChangedBy, &change.Reason, &change.ChangedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+const symbolColumns = `name, base_asset, quote_asset, tick_size, step_size, min_quantity, max_quantity, min_notional,
+               price_band, breaker_move, breaker_window_seconds, breaker_cooldown_seconds, reopen_auction_seconds,
+               status, created_at, updated_at`
+
+func symbolFields(symbol *entity.Symbol) []interface{} {
+	return []interface{}{
+		&symbol.Name, &symbol.BaseAsset, &symbol.QuoteAsset, &symbol.TickSize, &symbol.StepSize,
+		&symbol.MinQuantity, &symbol.MaxQuantity, &symbol.MinNotional,
+		&symbol.PriceBand, &symbol.BreakerMove, &symbol.BreakerWindowSeconds, &symbol.BreakerCooldownSeconds,
+		&symbol.ReopenAuctionSeconds, &symbol.Status, &symbol.CreatedAt, &symbol.UpdatedAt,
+	}
+}
+
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryer goes through the transaction in ctx when there is one, so lookups
+// see the same snapshot as the rest of the transaction and writes commit
+// with it.
+func queryer(ctx context.Context, db *sql.DB) sqlQueryer {
+	if tx, err := utils.TxFromContext(ctx); err == nil {
+		return tx
+	}
+	return db
+}
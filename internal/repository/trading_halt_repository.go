@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+type ITradingHaltRepository interface {
+	CreateHalt(ctx context.Context, halt entity.TradingHalt) error
+	FindActiveHalts(ctx context.Context) ([]entity.TradingHalt, error)
+	ResumeHalt(ctx context.Context, haltID uuid.UUID, resumedAt time.Time) error
+}
+
+type TradingHaltRepository struct {
+	db *sql.DB
+}
+
+func NewTradingHaltRepository(db *sql.DB) *TradingHaltRepository {
+	return &TradingHaltRepository{db: db}
+}
+
+func (r *TradingHaltRepository) CreateHalt(ctx context.Context, halt entity.TradingHalt) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqlStatement := `
+        INSERT INTO trading_halts (id, symbol, reason, reference_price, trigger_price, halted_at, resumes_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7);
+    `
+	_, err = tx.ExecContext(ctx, sqlStatement, halt.ID, halt.Symbol, halt.Reason, halt.ReferencePrice,
+		halt.TriggerPrice, halt.HaltedAt, halt.ResumesAt)
+	if err != nil {
+		return fmt.Errorf("error while creating trading halt: %w", err)
+	}
+	return nil
+}
+
+func (r *TradingHaltRepository) FindActiveHalts(ctx context.Context) ([]entity.TradingHalt, error) {
+	sqlStatement := `
+        SELECT id, symbol, COALESCE(reason, ''), reference_price, trigger_price, halted_at, resumes_at, resumed_at
+        FROM trading_halts
+        WHERE resumed_at IS NULL;
+    `
+	rows, err := queryer(ctx, r.db).QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching trading halts: %w", err)
+	}
+	defer rows.Close()
+
+	var halts []entity.TradingHalt
+	for rows.Next() {
+		var halt entity.TradingHalt
+		err = rows.Scan(&halt.ID, &halt.Symbol, &halt.Reason, &halt.ReferencePrice, &halt.TriggerPrice,
+			&halt.HaltedAt, &halt.ResumesAt, &halt.ResumedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		halts = append(halts, halt)
+	}
+	return halts, rows.Err()
+}
+
+func (r *TradingHaltRepository) ResumeHalt(ctx context.Context, haltID uuid.UUID, resumedAt time.Time) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE trading_halts SET resumed_at = $1 WHERE id = $2", resumedAt, haltID)
+	if err != nil {
+		return fmt.Errorf("error while resuming trading halt: %w", err)
+	}
+	return nil
+}
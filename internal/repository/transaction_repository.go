@@ -2,6 +2,7 @@ package repository
 
 import (
 	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
 	"bitcoinOrder/pkg/utils"
 	"context"
 	"database/sql"
@@ -9,13 +10,16 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"time"
 )
 
 type ITransactionRepository interface {
-	FindSellOrders(ctx context.Context) ([]entity.Order, error)
-	FindBuyOrders(ctx context.Context) ([]entity.Order, error)
+	FindOpenOrders(ctx context.Context) ([]entity.Order, error)
+	FindOrdersChangedSince(ctx context.Context, since time.Time) ([]entity.Order, error)
+	FindLastMatchPrices(ctx context.Context) (map[string]decimal.Decimal, error)
 	SaveMatches(ctx context.Context, orderMatches []entity.OrderMatch) error
-	UpdateBalance(ctx context.Context, users []*entity.Users) error
+	UpdateMatchFees(ctx context.Context, match entity.OrderMatch) error
+	SaveSelfTradeEvents(ctx context.Context, events []entity.SelfTradeEvent) error
 	FindOrderById(ctx context.Context, orderId uuid.UUID) (entity.Order, error)
 	FindUserById(ctx context.Context, userId uuid.UUID) (*entity.Users, error)
 	SoftDeleteOrder(ctx context.Context, orderId uuid.UUID) error
@@ -36,83 +40,100 @@ func NewTransactionRepository(gorm *gorm.DB, db *sql.DB) ITransactionRepository
 	}
 }
 
-func (o *TransactionRepository) FindBuyOrders(ctx context.Context) ([]entity.Order, error) {
+func (o *TransactionRepository) FindOpenOrders(ctx context.Context) ([]entity.Order, error) {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	sqlStatement := `
-        SELECT 
-        o.id, o.user_id, o.type, o.order_quantity, o.order_price, o.order_status, o.created_at, o.completed_at,
-        u.id AS user_id, u.email, u.btc_balance, u.usdt_balance, u.created_at AS user_created_at,
-        u.updated_at AS user_updated_at, u.deleted_at AS user_deleted_at
-    FROM orders o
-    JOIN users u ON o.user_id = u.id
-    WHERE o.order_status = true AND o.type = 'buy' AND o.deleted_at IS NULL
-    ORDER BY o.order_price ASC, o.created_at ASC;
+        SELECT ` + bookOrderColumns + `
+        FROM orders o
+        WHERE o.order_status = true AND o.deleted_at IS NULL
+        ORDER BY COALESCE(o.priority_at, o.created_at) ASC;
     `
 
-	return o.scanOrders(tx, sqlStatement)
+	return o.scanBookOrders(ctx, tx, sqlStatement)
 }
 
-func (o *TransactionRepository) FindSellOrders(ctx context.Context) ([]entity.Order, error) {
+// FindOrdersChangedSince returns every order created, updated or soft deleted
+// after the given time, including the ones that are no longer open.
+func (o *TransactionRepository) FindOrdersChangedSince(ctx context.Context, since time.Time) ([]entity.Order, error) {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	sqlStatement := `
- SELECT 
-        o.id, o.user_id, o.type, o.order_quantity, o.order_price, o.order_status, o.created_at, o.completed_at,
-        u.id AS user_id, u.email, u.btc_balance, u.usdt_balance, u.created_at AS user_created_at,
-        u.updated_at AS user_updated_at, u.deleted_at AS user_deleted_at
-    FROM orders o
-    JOIN users u ON o.user_id = u.id
-    WHERE o.order_status = true AND o.type = 'sell' AND o.deleted_at IS NULL
-    ORDER BY o.order_price DESC, o.created_at ASC;
+        SELECT ` + bookOrderColumns + `
+        FROM orders o
+        WHERE COALESCE(o.updated_at, o.created_at) > $1 OR o.deleted_at > $1
+        ORDER BY COALESCE(o.priority_at, o.created_at) ASC;
     `
 
-	return o.scanOrders(tx, sqlStatement)
+	return o.scanBookOrders(ctx, tx, sqlStatement, since)
+}
+
+// FindLastMatchPrices returns the price of the most recent trade of every
+// symbol that has traded.
+func (o *TransactionRepository) FindLastMatchPrices(ctx context.Context) (map[string]decimal.Decimal, error) {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlStatement := `
+        SELECT DISTINCT ON (symbol) symbol, COALESCE(price, 0)
+        FROM order_matches
+        WHERE symbol IS NOT NULL
+        ORDER BY symbol, matched_at DESC;
+    `
+	rows, err := tx.QueryContext(ctx, sqlStatement)
+	if err != nil {
+		return nil, fmt.Errorf("an error occurred while finding the last match prices: %w", err)
+	}
+	defer rows.Close()
+
+	prices := make(map[string]decimal.Decimal)
+	for rows.Next() {
+		var symbol string
+		var price decimal.Decimal
+		if err = rows.Scan(&symbol, &price); err != nil {
+			return nil, fmt.Errorf("error while scanning row: %w", err)
+		}
+		prices[symbol] = price
+	}
+	return prices, rows.Err()
 }
 
-func (o *TransactionRepository) scanOrders(tx *sql.Tx, sqlStatement string) ([]entity.Order, error) {
-	rows, err := tx.QueryContext(context.Background(), sqlStatement)
+const bookOrderColumns = `o.id, o.user_id, o.asset, o.type, o.kind, o.order_quantity, o.quote_amount, o.order_price, o.order_status,
+        o.time_in_force, o.expires_at, o.post_only, o.reprice_on_cross, o.trigger_price, o.triggered_at,
+        o.trailing_amount, o.trailing_percent, o.display_quantity, o.visible_quantity, COALESCE(o.priority_at, o.created_at), o.oco_group_id, o.self_trade_prevention, o.created_at, COALESCE(o.updated_at, o.created_at), o.version, o.completed_at, o.deleted_at`
+
+func (o *TransactionRepository) scanBookOrders(ctx context.Context, tx *sql.Tx, sqlStatement string, args ...interface{}) ([]entity.Order, error) {
+	rows, err := tx.QueryContext(ctx, sqlStatement, args...)
 	if err != nil {
 		return nil, fmt.Errorf("an error occurred while retrieving orders: %w", err)
 	}
 	defer rows.Close()
+
 	var orders []entity.Order
 	for rows.Next() {
 		var order entity.Order
-		var userIDStr string
-		var userCreatedAt, userUpdatedAt, userDeletedAt sql.NullTime
-
 		err = rows.Scan(
-			&order.ID, &userIDStr, &order.Type, &order.OrderQuantity,
-			&order.OrderPrice, &order.OrderStatus, &order.CreatedAt, &order.CompletedAt,
-			&order.User.ID, &order.User.Email, &order.User.BtcBalance, &order.User.UsdtBalance,
-			&userCreatedAt, &userUpdatedAt, &userDeletedAt,
+			&order.ID, &order.UserID, &order.Asset, &order.Type, &order.Kind, &order.OrderQuantity, &order.QuoteAmount,
+			&order.OrderPrice, &order.OrderStatus, &order.TimeInForce, &order.ExpiresAt,
+			&order.PostOnly, &order.RepriceOnCross, &order.TriggerPrice, &order.TriggeredAt,
+			&order.TrailingAmount, &order.TrailingPercent, &order.DisplayQuantity, &order.VisibleQuantity, &order.PriorityAt, &order.OcoGroupID, &order.SelfTradePrevention, &order.CreatedAt, &order.UpdatedAt, &order.Version, &order.CompletedAt, &order.DeletedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error while scanning row: %w", err)
 		}
-		order.UserID, err = uuid.Parse(userIDStr)
-		if err != nil {
-			return nil, fmt.Errorf("wrong user id format: %w", err)
-		}
-		order.User.CreatedAt = userCreatedAt.Time
-		if userUpdatedAt.Valid {
-			t := userUpdatedAt.Time
-			order.User.UpdatedAt = &t
-		}
-		if userDeletedAt.Valid {
-			t := userDeletedAt.Time
-			order.User.DeletedAt = &t
-		}
-
 		orders = append(orders, order)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating orders: %w", err)
+	}
 
 	return orders, nil
 }
@@ -128,7 +149,7 @@ func (o *TransactionRepository) SaveMatches(ctx context.Context, orderMatches []
 	}
 
 	sqlStatement := `
-        INSERT INTO order_matches (id, order_id1, order_id2, order_quantity, matched_at) 
+        INSERT INTO order_matches (id, symbol, order_id1, order_id2, order_quantity, price, matched_at, taker_side)
         VALUES 
     `
 	var params []interface{}
@@ -137,9 +158,10 @@ func (o *TransactionRepository) SaveMatches(ctx context.Context, orderMatches []
 		if i > 0 {
 			sqlStatement += ","
 		}
-		sqlStatement += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)",
-			i*5+1, i*5+2, i*5+3, i*5+4, i*5+5)
-		params = append(params, match.ID, match.OrderID1, match.OrderID2, match.OrderQuantity, match.MatchedAt)
+		sqlStatement += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			i*8+1, i*8+2, i*8+3, i*8+4, i*8+5, i*8+6, i*8+7, i*8+8)
+		params = append(params, match.ID, match.Symbol, match.OrderID1, match.OrderID2, match.OrderQuantity, match.Price,
+			match.MatchedAt, match.TakerSide)
 	}
 
 	_, err = tx.ExecContext(ctx, sqlStatement, params...)
@@ -150,44 +172,23 @@ func (o *TransactionRepository) SaveMatches(ctx context.Context, orderMatches []
 	return nil
 }
 
-func (o *TransactionRepository) UpdateBalance(ctx context.Context, users []*entity.Users) error {
+func (o *TransactionRepository) SaveSelfTradeEvents(ctx context.Context, events []entity.SelfTradeEvent) error {
 	tx, err := utils.TxFromContext(ctx)
 	if err != nil {
 		return err
 	}
 
 	sqlStatement := `
-        UPDATE users
-        SET usdt_balance = CASE id 
-                              %s
-                          END,
-            btc_balance = CASE id 
-                              %s
-                          END
-        WHERE id IN (%s);
+        INSERT INTO self_trade_events (id, user_id, taker_order_id, maker_order_id, mode, quantity, reason, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
     `
-
-	usdtBalanceCases := ""
-	btcBalanceCases := ""
-	userIDs := ""
-	var params []interface{}
-
-	for i, user := range users {
-		usdtBalanceCases += fmt.Sprintf("WHEN '%v' THEN $%d::float ", user.ID, i*3+2)
-		btcBalanceCases += fmt.Sprintf("WHEN '%v' THEN $%d::float ", user.ID, i*3+3)
-		params = append(params, user.ID, *user.UsdtBalance, *user.BtcBalance)
-
-		if i > 0 {
-			userIDs += ", "
+	for _, event := range events {
+		_, err = tx.ExecContext(ctx, sqlStatement, event.ID, event.UserID, event.TakerOrderID, event.MakerOrderID,
+			event.Mode, event.Quantity, event.Reason, event.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("an error occurred while saving self-trade event: %w", err)
 		}
-		userIDs += fmt.Sprintf("$%d", i*3+1)
-	}
-	finalStatement := fmt.Sprintf(sqlStatement, usdtBalanceCases, btcBalanceCases, userIDs)
-	_, err = tx.ExecContext(ctx, finalStatement, params...)
-	if err != nil {
-		return fmt.Errorf("an error occurred while updating user balances: %w", err)
 	}
-
 	return nil
 }
 
@@ -199,9 +200,9 @@ func (o *TransactionRepository) FindOrderById(ctx context.Context, orderID uuid.
 
 	sqlStatement := `
         SELECT 
-            o.id, o.user_id, o.type, o.order_quantity, o.order_price, o.order_status, 
+            o.id, o.user_id, o.type, o.kind, o.order_quantity, o.quote_amount, o.order_price, o.order_status, 
             o.created_at, o.completed_at,
-            u.id AS user_id, u.email, u.btc_balance, u.usdt_balance, u.created_at AS user_created_at,
+            u.id AS user_id, u.email, u.created_at AS user_created_at,
             u.updated_at AS user_updated_at, u.deleted_at AS user_deleted_at
         FROM orders o
         JOIN users u ON o.user_id = u.id
@@ -216,12 +217,14 @@ func (o *TransactionRepository) FindOrderById(ctx context.Context, orderID uuid.
 		&order.ID,
 		&userIDStr,
 		&order.Type,
+		&order.Kind,
 		&order.OrderQuantity,
+		&order.QuoteAmount,
 		&order.OrderPrice,
 		&order.OrderStatus,
 		&order.CreatedAt,
 		&order.CompletedAt,
-		&order.User.ID, &order.User.Email, &order.User.BtcBalance, &order.User.UsdtBalance,
+		&order.User.ID, &order.User.Email,
 		&userCreatedAt, &userUpdatedAt, &userDeletedAt,
 	)
 	if err != nil {
@@ -258,7 +261,7 @@ func (o *TransactionRepository) FindUserById(ctx context.Context, userID uuid.UU
 	}
 
 	sqlStatement := `
-        SELECT id, usdt_balance, btc_balance
+        SELECT id, email
         FROM users
         WHERE id = $1;
     `
@@ -266,8 +269,7 @@ func (o *TransactionRepository) FindUserById(ctx context.Context, userID uuid.UU
 	var user entity.Users
 	err = tx.QueryRowContext(ctx, sqlStatement, userID).Scan(
 		&user.ID,
-		&user.UsdtBalance,
-		&user.BtcBalance,
+		&user.Email,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -288,38 +290,78 @@ func (o *TransactionRepository) SoftDeleteOrder(ctx context.Context, orderID uui
 	sqlStatement := `
         UPDATE orders
         SET deleted_at = NOW()
-        WHERE id = $1;
+        WHERE id = $1 AND deleted_at IS NULL;
     `
 
-	_, err = tx.ExecContext(ctx, sqlStatement, orderID)
+	result, err := tx.ExecContext(ctx, sqlStatement, orderID)
 	if err != nil {
 		return fmt.Errorf("an error occurred while soft deleting the order: %w", err)
 	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("an error occurred while soft deleting the order: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrOrderCancelled, orderID)
+	}
 
 	return nil
 }
+
+// UpdateOrders writes back the orders the engine changed. An order cancelled
+// or amended by its owner since the engine read it is not touched;
+// ErrOrderChanged is returned instead so the whole batch can be rolled back
+// and matched again with the order as it is now.
 func (o *TransactionRepository) UpdateOrders(ctx context.Context, orders []*entity.Order) error {
-	// tx, err := utils.TxFromContext(ctx)
-	// if err != nil {
-	//  return err
-	// }
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
+	}
 
+	sqlStatement := `
+        UPDATE orders
+        SET order_quantity = $1, quote_amount = $2, order_price = $3, kind = $4, trigger_price = $5,
+            triggered_at = $6, visible_quantity = $7, priority_at = $8, order_status = $9, completed_at = $10,
+            version = version + 1, updated_at = NOW()
+        WHERE id = $11 AND version = $12 AND deleted_at IS NULL;
+    `
 	for _, order := range orders {
-		result := o.gorm.WithContext(ctx).Model(&entity.Order{}).Where("id = ?", order.ID).Updates(map[string]interface{}{
-			"order_quantity": order.OrderQuantity,
-			"order_status":   order.OrderStatus,
-			"completed_at":   order.CompletedAt,
-		})
-
-		if result.Error != nil {
-			return fmt.Errorf("failed to update order with ID %s: %w", order.ID, result.Error)
+		result, err := tx.ExecContext(ctx, sqlStatement, order.OrderQuantity, order.QuoteAmount, order.OrderPrice,
+			order.Kind, order.TriggerPrice, order.TriggeredAt, order.VisibleQuantity, order.PriorityAt,
+			order.OrderStatus, order.CompletedAt, order.ID, order.Version)
+		if err != nil {
+			return fmt.Errorf("failed to update order with ID %s: %w", order.ID, err)
 		}
 
-		if result.RowsAffected == 0 {
-			return fmt.Errorf("no orders updated with ID %s", order.ID)
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to update order with ID %s: %w", order.ID, err)
 		}
+		if rows == 0 {
+			return fmt.Errorf("%w: %s", ErrOrderChanged, order.ID)
+		}
+		order.Version++
+	}
+
+	return nil
+}
+
+// UpdateMatchFees stores the fees charged to both sides of a settled match.
+func (o *TransactionRepository) UpdateMatchFees(ctx context.Context, match entity.OrderMatch) error {
+	tx, err := utils.TxFromContext(ctx)
+	if err != nil {
+		return err
 	}
 
+	sqlStatement := `
+        UPDATE order_matches
+        SET buy_fee = $1, sell_fee = $2
+        WHERE id = $3;
+    `
+	_, err = tx.ExecContext(ctx, sqlStatement, match.BuyFee, match.SellFee, match.ID)
+	if err != nil {
+		return fmt.Errorf("an error occurred while storing match fees: %w", err)
+	}
 	return nil
 }
 
@@ -348,14 +390,14 @@ func (o *TransactionRepository) FetchMatch(ctx context.Context, orderID1 uuid.UU
 	}
 
 	sqlStatement := `
-        SELECT id, order_id1, order_id2, order_quantity, matched_at 
+        SELECT id, COALESCE(symbol, ''), order_id1, order_id2, order_quantity, price, matched_at 
         FROM order_matches 
         WHERE order_id1 = $1 AND order_id2 = $2 AND deleted_at IS NULL;
     `
 
 	var match entity.OrderMatch
 	err = tx.QueryRowContext(ctx, sqlStatement, orderID1, orderID2).Scan(
-		&match.ID, &match.OrderID1, &match.OrderID2, &match.OrderQuantity, &match.MatchedAt,
+		&match.ID, &match.Symbol, &match.OrderID1, &match.OrderID2, &match.OrderQuantity, &match.Price, &match.MatchedAt,
 	)
 
 	if err != nil {
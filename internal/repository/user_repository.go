@@ -14,12 +14,12 @@ import (
 )
 
 type IUserRepository interface {
-	CreateUser(user entity.Users) (entity.Users, error)
-	UpdateUser(ctx context.Context, user entity.Users) error
+	CreateUser(ctx context.Context, user entity.Users) (entity.Users, error)
 	GetBalance(id uuid.UUID) (entity.Users, error)
 	FindUser(ctx context.Context, id uuid.UUID) (entity.Users, error)
 	FindUserByEmail(email email.Email) (entity.Users, error)
 	FindAllUser() ([]entity.Users, error)
+	UpdateSelfTradePrevention(ctx context.Context, id uuid.UUID, mode string) error
 }
 
 type UserRepository struct {
@@ -36,25 +36,15 @@ func NewUserRepository(gorm *gorm.DB, db *sql.DB) IUserRepository {
 
 var ErrUserExists = errors.New("user already exists")
 
-func (r *UserRepository) CreateUser(user entity.Users) (entity.Users, error) {
+func (r *UserRepository) CreateUser(ctx context.Context, user entity.Users) (entity.Users, error) {
 	sqlStatement := `
-        INSERT INTO users (id, email, btc_balance, usdt_balance, created_at)
-        VALUES ($1, $2, $3, $4, $5)
+        INSERT INTO users (id, email, created_at)
+        VALUES ($1, $2, $3)
         RETURNING id, created_at;	
     `
 
-	var btcBalance, usdtBalance sql.NullFloat64
-	if user.BtcBalance != nil {
-		btcBalance.Float64 = *user.BtcBalance
-		btcBalance.Valid = true
-	}
-	if user.UsdtBalance != nil {
-		usdtBalance.Float64 = *user.UsdtBalance
-		usdtBalance.Valid = true
-	}
-
-	err := r.db.QueryRowContext(context.Background(), sqlStatement, user.ID, user.Email,
-		btcBalance, usdtBalance, time.Now()).Scan(&user.ID, &user.CreatedAt)
+	err := queryer(ctx, r.db).QueryRowContext(ctx, sqlStatement, user.ID, user.Email, time.Now()).
+		Scan(&user.ID, &user.CreatedAt)
 	if err != nil {
 		return entity.Users{}, err
 	}
@@ -82,49 +72,22 @@ func (r *UserRepository) FindUser(ctx context.Context, id uuid.UUID) (entity.Use
 
 	var user entity.Users
 	sqlStatement := `
-        SELECT id, email, btc_balance, usdt_balance, created_at, updated_at, deleted_at
+        SELECT id, email, self_trade_prevention, created_at, updated_at, deleted_at
         FROM "users" WHERE id = $1;
     `
 	err = tx.QueryRowContext(ctx, sqlStatement, id).
-		Scan(&user.ID, &user.Email, &user.BtcBalance, &user.UsdtBalance,
-			&user.CreatedAt, &user.UpdatedAt, &user.DeletedAt)
+		Scan(&user.ID, &user.Email, &user.SelfTradePrevention, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt)
 	if err != nil {
 		return entity.Users{}, fmt.Errorf("user not found: %w", err)
 	}
 	return user, nil
 }
 
-func (r *UserRepository) UpdateUser(ctx context.Context, user entity.Users) error {
-	tx, err := utils.TxFromContext(ctx)
-	if err != nil {
-		return err
-	}
-
-	var usdtBalance, btcBalance sql.NullFloat64
-	if user.UsdtBalance != nil {
-		usdtBalance.Float64 = *user.UsdtBalance
-		usdtBalance.Valid = true
-	}
-	if user.BtcBalance != nil {
-		btcBalance.Float64 = *user.BtcBalance
-		btcBalance.Valid = true
-	}
-
+func (r *UserRepository) FindAllUser() ([]entity.Users, error) {
 	sqlStatement := `
-        UPDATE users
-        SET usdt_balance = $1, btc_balance = $2, updated_at = $3
-        WHERE id = $4;
+        SELECT id, created_at, updated_at, deleted_at, email, self_trade_prevention
+        FROM users;
     `
-	updateTime := time.Now()
-	_, err = tx.ExecContext(ctx, sqlStatement, usdtBalance, btcBalance, updateTime, user.ID)
-	if err != nil {
-		return fmt.Errorf("error updating user: %w", err)
-	}
-	return nil
-}
-
-func (r *UserRepository) FindAllUser() ([]entity.Users, error) {
-	sqlStatement := `SELECT * FROM users;`
 	rows, err := r.db.QueryContext(context.Background(), sqlStatement)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching users: %w", err)
@@ -134,7 +97,7 @@ func (r *UserRepository) FindAllUser() ([]entity.Users, error) {
 	var users []entity.Users
 	for rows.Next() {
 		var user entity.Users
-		err = rows.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Email, &user.BtcBalance, &user.UsdtBalance)
+		err = rows.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt, &user.Email, &user.SelfTradePrevention)
 		if err != nil {
 			return nil, fmt.Errorf("error while scanning row: %w", err)
 		}
@@ -142,3 +105,19 @@ func (r *UserRepository) FindAllUser() ([]entity.Users, error) {
 	}
 	return users, nil
 }
+
+func (r *UserRepository) UpdateSelfTradePrevention(ctx context.Context, id uuid.UUID, mode string) error {
+	sqlStatement := `
+        UPDATE users
+        SET self_trade_prevention = $1, updated_at = $2
+        WHERE id = $3;
+    `
+	result, err := r.db.ExecContext(ctx, sqlStatement, mode, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error updating self-trade prevention: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("user not found: %s", id)
+	}
+	return nil
+}
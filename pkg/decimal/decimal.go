@@ -0,0 +1,375 @@
+// Package decimal is the fixed-point number every price, quantity and
+// balance is kept in. A Decimal counts units of 10^-Scale exactly, so sums
+// and comparisons never drift the way float64 does; only products and
+// quotients round, half away from zero, to Scale places.
+package decimal
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places a Decimal holds. Assets with fewer
+// places round to their own scale with Round or RoundDown; no asset can have
+// more, since a Decimal with more places would no longer hold amounts as
+// large as the exchange keeps in an int64.
+const Scale = 8
+
+const unit = 100_000_000 // 10^Scale
+
+var (
+	ErrInvalidDecimal = errors.New("invalid decimal")
+	ErrOverflow       = errors.New("decimal overflow")
+)
+
+// Decimal is a signed fixed-point number with Scale decimal places. The zero
+// value is 0.
+type Decimal struct {
+	units int64
+}
+
+var Zero = Decimal{}
+
+// NewFromInt returns the whole number i. It panics with ErrOverflow when i
+// is too large for a Decimal.
+func NewFromInt(i int64) Decimal {
+	if i > math.MaxInt64/unit || i < math.MinInt64/unit {
+		panic(ErrOverflow)
+	}
+	return Decimal{units: i * unit}
+}
+
+// NewFromFloat rounds f to Scale places. It is meant for constants and
+// ratios; amounts should be parsed from their decimal string.
+func NewFromFloat(f float64) Decimal {
+	return Decimal{units: int64(math.Round(f * unit))}
+}
+
+// NewFromString parses a decimal such as "-12.5" or "0.00010000". More than
+// Scale places is an error rather than a silent rounding.
+func NewFromString(s string) (Decimal, error) {
+	return parse(s, false)
+}
+
+// parse reads a decimal string. Extra places past Scale are an error unless
+// round is set, as for sums and products computed by the database.
+func parse(s string, round bool) (Decimal, error) {
+	text := strings.TrimSpace(s)
+	negative := strings.HasPrefix(text, "-")
+	if negative || strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" && fraction == "" || len(fraction) > Scale && !round {
+		return Zero, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	carry := int64(0)
+	if len(fraction) > Scale {
+		if fraction[Scale] >= '5' {
+			carry = 1
+		}
+		fraction = fraction[:Scale]
+	}
+	fraction += strings.Repeat("0", Scale-len(fraction))
+	w, err := strconv.ParseUint(whole, 10, 63)
+	if err != nil || w > math.MaxInt64/unit {
+		return Zero, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	f, err := strconv.ParseUint(fraction, 10, 63)
+	if err != nil {
+		return Zero, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	units := int64(w)*unit + int64(f) + carry
+	if negative {
+		units = -units
+	}
+	return Decimal{units: units}, nil
+}
+
+// RequireFromString is NewFromString for literals known to be valid.
+func RequireFromString(s string) Decimal {
+	d, err := NewFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Add returns d+e. Like the Must methods it panics with ErrOverflow when the
+// sum does not fit a Decimal, which amounts that passed validation never
+// reach.
+func (d Decimal) Add(e Decimal) Decimal {
+	sum := d.units + e.units
+	if (e.units > 0 && sum < d.units) || (e.units < 0 && sum > d.units) {
+		panic(ErrOverflow)
+	}
+	return Decimal{units: sum}
+}
+
+// Sub returns d-e and panics with ErrOverflow like Add.
+func (d Decimal) Sub(e Decimal) Decimal {
+	difference := d.units - e.units
+	if (e.units > 0 && difference > d.units) || (e.units < 0 && difference < d.units) {
+		panic(ErrOverflow)
+	}
+	return Decimal{units: difference}
+}
+
+// Neg returns -d and panics with ErrOverflow for the one Decimal whose
+// negation does not fit.
+func (d Decimal) Neg() Decimal {
+	if d.units == math.MinInt64 {
+		panic(ErrOverflow)
+	}
+	return Decimal{units: -d.units}
+}
+
+func (d Decimal) Abs() Decimal {
+	if d.units < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Mul returns d*e rounded to Scale places, or ErrOverflow when the product
+// does not fit a Decimal.
+func (d Decimal) Mul(e Decimal) (Decimal, error) {
+	product := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(e.units))
+	return fromBig(divRound(product, big.NewInt(unit)))
+}
+
+// Div returns d/e rounded to Scale places, or ErrOverflow when the quotient
+// does not fit a Decimal. Dividing by zero panics.
+func (d Decimal) Div(e Decimal) (Decimal, error) {
+	if e.units == 0 {
+		panic("decimal: division by zero")
+	}
+	numerator := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(unit))
+	return fromBig(divRound(numerator, big.NewInt(e.units)))
+}
+
+// DivDown returns d/e truncated towards zero, for a quantity that must not
+// cost more than the amount it is bought with. It returns ErrOverflow when
+// the quotient does not fit a Decimal.
+func (d Decimal) DivDown(e Decimal) (Decimal, error) {
+	if e.units == 0 {
+		panic("decimal: division by zero")
+	}
+	numerator := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(unit))
+	return fromBig(new(big.Int).Quo(numerator, big.NewInt(e.units)))
+}
+
+// MustMul is Mul for operands known to be in range, such as amounts that
+// passed validation. It panics on overflow.
+func (d Decimal) MustMul(e Decimal) Decimal {
+	return must(d.Mul(e))
+}
+
+// MustDiv is Div that panics on overflow.
+func (d Decimal) MustDiv(e Decimal) Decimal {
+	return must(d.Div(e))
+}
+
+// MustDivDown is DivDown that panics on overflow.
+func (d Decimal) MustDivDown(e Decimal) Decimal {
+	return must(d.DivDown(e))
+}
+
+func must(d Decimal, err error) Decimal {
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func fromBig(units *big.Int) (Decimal, error) {
+	if !units.IsInt64() {
+		return Zero, ErrOverflow
+	}
+	return Decimal{units: units.Int64()}, nil
+}
+
+// divRound divides and rounds half away from zero.
+func divRound(numerator, denominator *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if remainder.Sign() != 0 {
+		twice := new(big.Int).Abs(remainder)
+		twice.Lsh(twice, 1)
+		if twice.Cmp(new(big.Int).Abs(denominator)) >= 0 {
+			if numerator.Sign()*denominator.Sign() < 0 {
+				quotient.Sub(quotient, big.NewInt(1))
+			} else {
+				quotient.Add(quotient, big.NewInt(1))
+			}
+		}
+	}
+	return quotient
+}
+
+// Round rounds d half away from zero to places decimal places.
+func (d Decimal) Round(places int32) Decimal {
+	step := stepOf(places)
+	if step == 1 {
+		return d
+	}
+	return Decimal{units: divRound(big.NewInt(d.units), big.NewInt(step)).Int64() * step}
+}
+
+// RoundDown truncates d towards zero to places decimal places.
+func (d Decimal) RoundDown(places int32) Decimal {
+	step := stepOf(places)
+	return Decimal{units: d.units / step * step}
+}
+
+// RoundUp rounds d away from zero to places decimal places.
+func (d Decimal) RoundUp(places int32) Decimal {
+	step := stepOf(places)
+	truncated := d.units / step * step
+	if truncated != d.units {
+		if d.units < 0 {
+			truncated -= step
+		} else {
+			truncated += step
+		}
+	}
+	return Decimal{units: truncated}
+}
+
+func stepOf(places int32) int64 {
+	step := int64(1)
+	for i := places; i < Scale; i++ {
+		step *= 10
+	}
+	return step
+}
+
+// RoundDownToStep truncates d towards zero to a whole number of steps. A
+// zero step leaves d as it is.
+func (d Decimal) RoundDownToStep(step Decimal) Decimal {
+	if step.units == 0 {
+		return d
+	}
+	return Decimal{units: d.units / step.units * step.units}
+}
+
+// IsMultipleOf reports whether d is a whole number of steps.
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	return step.units != 0 && d.units%step.units == 0
+}
+
+func (d Decimal) Cmp(e Decimal) int {
+	switch {
+	case d.units < e.units:
+		return -1
+	case d.units > e.units:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) Equal(e Decimal) bool              { return d.units == e.units }
+func (d Decimal) LessThan(e Decimal) bool           { return d.units < e.units }
+func (d Decimal) LessThanOrEqual(e Decimal) bool    { return d.units <= e.units }
+func (d Decimal) GreaterThan(e Decimal) bool        { return d.units > e.units }
+func (d Decimal) GreaterThanOrEqual(e Decimal) bool { return d.units >= e.units }
+func (d Decimal) IsZero() bool                      { return d.units == 0 }
+func (d Decimal) IsPositive() bool                  { return d.units > 0 }
+func (d Decimal) IsNegative() bool                  { return d.units < 0 }
+
+func Min(d, e Decimal) Decimal {
+	if e.units < d.units {
+		return e
+	}
+	return d
+}
+
+func Max(d, e Decimal) Decimal {
+	if e.units > d.units {
+		return e
+	}
+	return d
+}
+
+// Float64 converts d for ratios and logs; it is not exact.
+func (d Decimal) Float64() float64 {
+	return float64(d.units) / unit
+}
+
+// String formats d with its trailing zeros trimmed, such as "0.0001".
+func (d Decimal) String() string {
+	units := d.units
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+	whole := units / unit
+	fraction := units % unit
+	if whole < 0 {
+		whole = -whole
+	}
+	if fraction < 0 {
+		fraction = -fraction
+	}
+	if fraction == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+	digits := strings.TrimRight(fmt.Sprintf("%08d", fraction), "0")
+	return sign + strconv.FormatInt(whole, 10) + "." + digits
+}
+
+// MarshalJSON writes d as a string so clients do not parse it into a float.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// UnmarshalJSON reads a string, or a plain JSON number for older clients.
+// Either is parsed exactly: exponents and places past Scale are refused
+// rather than rounded.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	parsed, err := NewFromString(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores d in a numeric column.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan reads d from a numeric column.
+func (d *Decimal) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*d = Zero
+	case []byte:
+		*d, err = parse(string(v), true)
+	case string:
+		*d, err = parse(v, true)
+	case int64:
+		*d = NewFromInt(v)
+	case float64:
+		*d = NewFromFloat(v)
+	default:
+		err = fmt.Errorf("%w: cannot scan %T", ErrInvalidDecimal, src)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+// Package ledger builds the double-entry journals every balance movement is
+// recorded with. A user's available balance is the sum of their available
+// entries and their locked funds the sum of their locked entries, so both can
+// be rebuilt from the journal and checked against the stored balances.
+package ledger
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// The accounts each user has per asset. External stands for the world
+// outside the exchange, which deposits are credited from.
+const (
+	Available = "available"
+	Locked    = "locked"
+	External  = "external"
+)
+
+// The business events that move balances.
+const (
+	Opening = "opening"
+	Deposit = "deposit"
+	Lock    = "lock"
+	Unlock  = "unlock"
+	Trade   = "trade"
+	Fee     = "fee"
+)
+
+var ErrUnbalanced = errors.New("journal does not balance")
+
+// Account is one account of one user.
+type Account struct {
+	UserID uuid.UUID
+	Name   string
+}
+
+func AvailableOf(userID uuid.UUID) Account { return Account{UserID: userID, Name: Available} }
+func LockedOf(userID uuid.UUID) Account    { return Account{UserID: userID, Name: Locked} }
+func ExternalOf(userID uuid.UUID) Account  { return Account{UserID: userID, Name: External} }
+
+// Journal collects the entries of one business event.
+type Journal struct {
+	ID        uuid.UUID
+	EventType string
+	EventID   uuid.UUID
+	Entries   []entity.LedgerEntry
+	at        time.Time
+}
+
+func NewJournal(eventType string, eventID uuid.UUID) *Journal {
+	return &Journal{ID: uuid.New(), EventType: eventType, EventID: eventID, at: time.Now()}
+}
+
+// Transfer debits amount of the asset from one account and credits it to
+// another. A zero amount records nothing.
+func (j *Journal) Transfer(asset string, amount decimal.Decimal, from, to Account) *Journal {
+	if amount.IsZero() {
+		return j
+	}
+	j.Entries = append(j.Entries, j.entry(asset, amount.Neg(), from), j.entry(asset, amount, to))
+	return j
+}
+
+func (j *Journal) entry(asset string, amount decimal.Decimal, account Account) entity.LedgerEntry {
+	return entity.LedgerEntry{
+		ID:        uuid.New(),
+		JournalID: j.ID,
+		UserID:    account.UserID,
+		Asset:     asset,
+		Account:   account.Name,
+		Amount:    amount,
+		EventType: j.EventType,
+		EventID:   j.EventID,
+		CreatedAt: j.at,
+	}
+}
+
+// Validate checks that the entries of every asset sum to zero.
+func (j *Journal) Validate() error {
+	sums := make(map[string]decimal.Decimal)
+	for _, entry := range j.Entries {
+		sums[entry.Asset] = sums[entry.Asset].Add(entry.Amount)
+	}
+	for asset, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s %s entries sum to %v", ErrUnbalanced, j.EventType, asset, sum)
+		}
+	}
+	return nil
+}
+
+// Mismatch is a balance that differs from what its journal entries add up
+// to.
+type Mismatch struct {
+	UserID  uuid.UUID
+	Asset   string
+	Account string
+	Balance decimal.Decimal
+	Journal decimal.Decimal
+}
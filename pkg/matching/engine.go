@@ -0,0 +1,201 @@
+// Package matching is the order matching engine. It keeps one book per
+// symbol and turns commands into trades and order changes without touching
+// a database, the wall clock or a random source: the time and the IDs of new
+// records come from the Clock and IDGenerator it is built with, so the same
+// commands on the same books always give the same result.
+package matching
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/orderbook"
+	"bitcoinOrder/pkg/utils"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+// Clock returns the time the engine stamps on trades and order changes.
+type Clock func() time.Time
+
+// IDGenerator returns the ID of a new trade or self-trade event.
+type IDGenerator func() uuid.UUID
+
+// Guard is consulted before every continuous trade and can stop a symbol
+// from trading, as a circuit breaker does. A nil Guard allows every trade.
+type Guard interface {
+	// Allow reports whether a trade at price may happen now. It may record
+	// the trade, or halt the symbol when it refuses.
+	Allow(symbol string, price decimal.Decimal, at time.Time) bool
+	// Check answers like Allow without recording anything. It is asked
+	// while deciding whether a fill-or-kill order can fill.
+	Check(symbol string, price decimal.Decimal, at time.Time) bool
+}
+
+// Lot is what the engine needs of a symbol's lot rules to size the fills of
+// a market buy, which arrives with a quote amount rather than a quantity.
+// Precision is the decimal places of the symbol's base asset.
+type Lot struct {
+	StepSize    decimal.Decimal
+	MinQuantity decimal.Decimal
+	Precision   int32
+}
+
+// Release is an order the engine cancelled or reduced outside of a trade,
+// such as an OCO leg or a self-trade, together with the part of its lock it
+// no longer needs.
+type Release struct {
+	Order  *entity.Order
+	Amount decimal.Decimal
+}
+
+// Result is everything one command changed. Orders are the orders that
+// traded, in the order they did, and may repeat.
+type Result struct {
+	Matches    []entity.OrderMatch
+	Orders     []*entity.Order
+	Releases   []Release
+	SelfTrades []entity.SelfTradeEvent
+}
+
+type Engine struct {
+	now       Clock
+	newID     IDGenerator
+	books     map[string]*orderbook.OrderBook
+	lots      map[string]Lot
+	ocoGroups map[uuid.UUID][]*entity.Order
+	result    Result
+}
+
+func New(clock Clock, newID IDGenerator) *Engine {
+	return &Engine{
+		now:       clock,
+		newID:     newID,
+		books:     make(map[string]*orderbook.OrderBook),
+		lots:      make(map[string]Lot),
+		ocoGroups: make(map[uuid.UUID][]*entity.Order),
+	}
+}
+
+// Book returns the book of a symbol, creating it on first use.
+func (e *Engine) Book(symbol string) *orderbook.OrderBook {
+	book, ok := e.books[symbol]
+	if !ok {
+		book = orderbook.New()
+		e.books[symbol] = book
+	}
+	return book
+}
+
+// SetLot sets the lot rules market buys on a symbol are filled by. Without
+// them a market buy fills whatever its quote amount buys to eight places.
+func (e *Engine) SetLot(symbol string, lot Lot) {
+	e.lots[symbol] = lot
+}
+
+// affordable is the quantity a quote-sized order can still buy at price,
+// rounded down to the symbol's lot, or zero when that is below the lot's
+// minimum quantity.
+func (e *Engine) affordable(order *entity.Order, price decimal.Decimal) decimal.Decimal {
+	quantity := order.QuoteAmount.MustDivDown(price)
+	lot, ok := e.lots[order.Asset]
+	if !ok {
+		return quantity
+	}
+	quantity = quantity.RoundDown(lot.Precision).RoundDownToStep(lot.StepSize)
+	if quantity.LessThan(lot.MinQuantity) {
+		return decimal.Zero
+	}
+	return quantity
+}
+
+// Symbols returns the symbols that have a book, sorted.
+func (e *Engine) Symbols() []string {
+	symbols := make([]string, 0, len(e.books))
+	for symbol := range e.books {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Orders returns every resting order, in no particular order.
+func (e *Engine) Orders() []*entity.Order {
+	var orders []*entity.Order
+	for _, book := range e.books {
+		orders = append(orders, book.Orders()...)
+	}
+	return orders
+}
+
+// Cancel takes an order off its book and closes it. Amount is the part of
+// its lock the caller releases.
+func (e *Engine) Cancel(order *entity.Order, amount decimal.Decimal) Release {
+	e.Book(order.Asset).Remove(order.ID)
+	order.OrderStatus = false
+	now := e.now()
+	order.CompletedAt = &now
+	return Release{Order: order, Amount: amount}
+}
+
+func (e *Engine) cancel(order *entity.Order, amount decimal.Decimal) {
+	e.result.Releases = append(e.result.Releases, e.Cancel(order, amount))
+}
+
+// begin starts collecting the result of a command and end hands it over.
+func (e *Engine) begin() {
+	e.result = Result{}
+}
+
+func (e *Engine) end() Result {
+	result := e.result
+	e.result = Result{}
+	return result
+}
+
+// reduce takes a fill off a resting order and completes it once nothing is
+// left. An iceberg order whose visible slice is used up shows a new slice
+// from its reserve and loses its place in the queue.
+func (e *Engine) reduce(order *entity.Order, quantity decimal.Decimal) {
+	order.OrderQuantity = order.OrderQuantity.Sub(quantity)
+	if order.OrderQuantity.IsZero() {
+		order.OrderStatus = false
+		now := e.now()
+		order.CompletedAt = &now
+		e.Book(order.Asset).Remove(order.ID)
+		return
+	}
+	if order.DisplayQuantity.IsPositive() {
+		order.VisibleQuantity = order.VisibleQuantity.Sub(quantity)
+		if !order.VisibleQuantity.IsPositive() {
+			order.VisibleQuantity = decimal.Min(order.DisplayQuantity, order.OrderQuantity)
+			order.PriorityAt = e.now()
+			e.Book(order.Asset).Requeue(order.ID)
+		}
+	}
+}
+
+// Opposite is the side an order of the given side trades against.
+func Opposite(side string) string {
+	if side == utils.SellOrder {
+		return utils.BuyOrder
+	}
+	return utils.SellOrder
+}
+
+// WithinLimit reports whether the order may trade at price.
+func WithinLimit(order *entity.Order, price decimal.Decimal) bool {
+	if order.Type == utils.BuyOrder {
+		return price.LessThanOrEqual(order.OrderPrice)
+	}
+	return price.GreaterThanOrEqual(order.OrderPrice)
+}
+
+// executionPrice is the price of whichever order rested on the book first,
+// so the incoming (taker) order always trades at the maker's price.
+func executionPrice(buyOrder, sellOrder *entity.Order) decimal.Decimal {
+	if sellOrder.PriorityAt.Before(buyOrder.PriorityAt) {
+		return sellOrder.OrderPrice
+	}
+	return buyOrder.OrderPrice
+}
@@ -0,0 +1,205 @@
+package matching
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/orderbook"
+	"bitcoinOrder/pkg/utils"
+)
+
+// Match crosses the book of a symbol until its best bid no longer reaches its
+// best ask or the guard stops it, removing every order it completes.
+func (e *Engine) Match(symbol string, guard Guard) Result {
+	e.begin()
+	book := e.Book(symbol)
+	for {
+		buyOrder := book.Best(utils.BuyOrder)
+		sellOrder := book.Best(utils.SellOrder)
+		if buyOrder == nil || sellOrder == nil || buyOrder.OrderPrice.LessThan(sellOrder.OrderPrice) {
+			break
+		}
+
+		taker, maker := buyOrder, sellOrder
+		if sellOrder.PriorityAt.After(buyOrder.PriorityAt) {
+			taker, maker = sellOrder, buyOrder
+		}
+		if prevented, _ := e.preventSelfTrade(taker, maker); prevented {
+			continue
+		}
+		price, now := executionPrice(buyOrder, sellOrder), e.now()
+		if guard != nil && !guard.Allow(symbol, price, now) {
+			break
+		}
+
+		matchQuantity := decimal.Min(orderbook.Visible(buyOrder), orderbook.Visible(sellOrder))
+		e.result.Matches = append(e.result.Matches, entity.OrderMatch{
+			ID:            e.newID(),
+			Symbol:        symbol,
+			OrderID1:      buyOrder.ID,
+			OrderID2:      sellOrder.ID,
+			OrderQuantity: matchQuantity,
+			Price:         price,
+			MatchedAt:     now,
+			TakerSide:     taker.Type,
+		})
+
+		e.cancelSibling(buyOrder)
+		e.cancelSibling(sellOrder)
+		e.reduce(buyOrder, matchQuantity)
+		e.reduce(sellOrder, matchQuantity)
+		e.result.Orders = append(e.result.Orders, buyOrder, sellOrder)
+	}
+	return e.end()
+}
+
+// Execute runs one matching pass for an order that must trade on arrival,
+// never trading beyond its limit price, and closes it. A fill-or-kill order
+// that cannot fill completely is closed without trading. The order itself
+// is the last of the result's orders.
+func (e *Engine) Execute(order *entity.Order, guard Guard) Result {
+	e.begin()
+	if order.TimeInForce != utils.FillOrKill || e.canFill(order, guard) {
+		e.sweep(order, guard)
+	}
+
+	order.OrderStatus = false
+	now := e.now()
+	order.CompletedAt = &now
+	e.result.Orders = append(e.result.Orders, order)
+	return e.end()
+}
+
+// canFill reports whether the opposite side holds enough within the order's
+// limit price, and short of a price the guard refuses, to fill it
+// completely.
+func (e *Engine) canFill(order *entity.Order, guard Guard) bool {
+	remaining := order.OrderQuantity
+	if utils.IsQuoteSized(order) {
+		remaining = order.QuoteAmount
+	}
+	now := e.now()
+	for _, level := range e.Book(order.Asset).Depth(Opposite(order.Type), 0) {
+		if !WithinLimit(order, level.Price) {
+			break
+		}
+		if guard != nil && !guard.Check(order.Asset, level.Price, now) {
+			break
+		}
+		if utils.IsQuoteSized(order) {
+			remaining = remaining.Sub(level.Price.MustMul(level.Quantity))
+		} else {
+			remaining = remaining.Sub(level.Quantity)
+		}
+		if !remaining.IsPositive() {
+			return true
+		}
+	}
+	return false
+}
+
+// sweep fills an order against the best opposite orders at their own prices.
+// A market buy is sized by its remaining quote amount and stops once that no
+// longer buys a whole lot, leaving the rest to be released.
+func (e *Engine) sweep(order *entity.Order, guard Guard) {
+	book := e.Book(order.Asset)
+	for {
+		maker := book.Best(Opposite(order.Type))
+		if maker == nil || !WithinLimit(order, maker.OrderPrice) {
+			break
+		}
+
+		remaining := order.OrderQuantity
+		if utils.IsQuoteSized(order) {
+			remaining = order.QuoteAmount
+		}
+		if !remaining.IsPositive() {
+			break
+		}
+		if utils.IsQuoteSized(order) && e.affordable(order, maker.OrderPrice).IsZero() {
+			// the prices only get worse from here
+			break
+		}
+		if prevented, done := e.preventSelfTrade(order, maker); prevented {
+			if done {
+				break
+			}
+			continue
+		}
+		now := e.now()
+		if guard != nil && !guard.Allow(order.Asset, maker.OrderPrice, now) {
+			break
+		}
+		e.cancelSibling(order)
+		e.cancelSibling(maker)
+
+		var matchQuantity decimal.Decimal
+		if utils.IsQuoteSized(order) {
+			matchQuantity = decimal.Min(orderbook.Visible(maker), e.affordable(order, maker.OrderPrice))
+			order.QuoteAmount = order.QuoteAmount.Sub(matchQuantity.MustMul(maker.OrderPrice))
+		} else {
+			matchQuantity = decimal.Min(orderbook.Visible(maker), order.OrderQuantity)
+			order.OrderQuantity = order.OrderQuantity.Sub(matchQuantity)
+		}
+
+		buyOrder, sellOrder := order, maker
+		if order.Type == utils.SellOrder {
+			buyOrder, sellOrder = maker, order
+		}
+		e.result.Matches = append(e.result.Matches, entity.OrderMatch{
+			ID:            e.newID(),
+			Symbol:        order.Asset,
+			OrderID1:      buyOrder.ID,
+			OrderID2:      sellOrder.ID,
+			OrderQuantity: matchQuantity,
+			Price:         maker.OrderPrice,
+			MatchedAt:     now,
+			TakerSide:     order.Type,
+		})
+
+		e.reduce(maker, matchQuantity)
+		e.result.Orders = append(e.result.Orders, maker)
+	}
+}
+
+// Uncross fills the crossing orders of a symbol's book at an auction's
+// clearing price in price-time priority until the auction volume is
+// reached. Auction trades have no taker.
+func (e *Engine) Uncross(symbol string, price, volume decimal.Decimal) Result {
+	e.begin()
+	book := e.Book(symbol)
+	var executed decimal.Decimal
+	for executed.LessThan(volume) {
+		buyOrder := book.Best(utils.BuyOrder)
+		sellOrder := book.Best(utils.SellOrder)
+		if buyOrder == nil || sellOrder == nil || buyOrder.OrderPrice.LessThan(price) || sellOrder.OrderPrice.GreaterThan(price) {
+			break
+		}
+
+		taker, maker := buyOrder, sellOrder
+		if sellOrder.PriorityAt.After(buyOrder.PriorityAt) {
+			taker, maker = sellOrder, buyOrder
+		}
+		if prevented, _ := e.preventSelfTrade(taker, maker); prevented {
+			continue
+		}
+
+		matchQuantity := decimal.Min(decimal.Min(orderbook.Visible(buyOrder), orderbook.Visible(sellOrder)), volume.Sub(executed))
+		e.result.Matches = append(e.result.Matches, entity.OrderMatch{
+			ID:            e.newID(),
+			Symbol:        symbol,
+			OrderID1:      buyOrder.ID,
+			OrderID2:      sellOrder.ID,
+			OrderQuantity: matchQuantity,
+			Price:         price,
+			MatchedAt:     e.now(),
+		})
+
+		e.cancelSibling(buyOrder)
+		e.cancelSibling(sellOrder)
+		e.reduce(buyOrder, matchQuantity)
+		e.reduce(sellOrder, matchQuantity)
+		e.result.Orders = append(e.result.Orders, buyOrder, sellOrder)
+		executed = executed.Add(matchQuantity)
+	}
+	return e.end()
+}
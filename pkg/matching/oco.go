@@ -0,0 +1,80 @@
+package matching
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+)
+
+// Track links an OCO leg to its pair, replacing the copy of the leg the
+// engine held before. Orders outside a pair are ignored.
+func (e *Engine) Track(order *entity.Order) {
+	if order.OcoGroupID == nil {
+		return
+	}
+	legs := e.ocoGroups[*order.OcoGroupID]
+	for i, leg := range legs {
+		if leg.ID == order.ID {
+			legs[i] = order
+			return
+		}
+	}
+	e.ocoGroups[*order.OcoGroupID] = append(legs, order)
+}
+
+// Untrack unlinks a closed OCO leg from its pair.
+func (e *Engine) Untrack(order *entity.Order) {
+	if order.OcoGroupID == nil {
+		return
+	}
+	legs := e.ocoGroups[*order.OcoGroupID]
+	for i, leg := range legs {
+		if leg.ID == order.ID {
+			legs = append(legs[:i], legs[i+1:]...)
+			break
+		}
+	}
+	if len(legs) == 0 {
+		delete(e.ocoGroups, *order.OcoGroupID)
+		return
+	}
+	e.ocoGroups[*order.OcoGroupID] = legs
+}
+
+// sibling returns the other open leg of the order's OCO pair, if any.
+func (e *Engine) sibling(order *entity.Order) *entity.Order {
+	if order.OcoGroupID == nil {
+		return nil
+	}
+	for _, leg := range e.ocoGroups[*order.OcoGroupID] {
+		if leg.ID != order.ID {
+			return leg
+		}
+	}
+	return nil
+}
+
+// cancelSibling takes the other leg of an OCO pair off the market before the
+// order receives a fill. Both legs share one lock sized for the larger leg,
+// so only what the cancelled leg needed beyond the filled one is released.
+func (e *Engine) cancelSibling(order *entity.Order) {
+	sibling := e.sibling(order)
+	if sibling == nil {
+		return
+	}
+	delete(e.ocoGroups, *order.OcoGroupID)
+
+	e.cancel(sibling, decimal.Max(decimal.Zero, utils.LockRequirement(sibling).Sub(utils.LockRequirement(order))))
+}
+
+// UnsharedLock is the part of the order's lock that can be released when it
+// closes unfilled. While its OCO sibling is still open that leg keeps what it
+// needs of the shared lock, and the pair stops being linked.
+func (e *Engine) UnsharedLock(order *entity.Order) decimal.Decimal {
+	amount := utils.LockRequirement(order)
+	if sibling := e.sibling(order); sibling != nil {
+		amount = decimal.Max(decimal.Zero, amount.Sub(utils.LockRequirement(sibling)))
+		delete(e.ocoGroups, *order.OcoGroupID)
+	}
+	return amount
+}
@@ -0,0 +1,96 @@
+package matching
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/orderbook"
+	"bitcoinOrder/pkg/utils"
+)
+
+var selfTradeReasons = map[string]string{
+	utils.CancelNewest:  "taker cancelled to prevent a trade with an order of the same user",
+	utils.CancelOldest:  "maker cancelled to prevent a trade with an order of the same user",
+	utils.CancelBoth:    "taker and maker cancelled to prevent a trade with each other",
+	utils.DecrementBoth: "taker and maker decremented by the quantity they would have traded",
+}
+
+// preventSelfTrade applies the taker's self-trade prevention mode when it
+// would trade against a maker of the same user. It reports whether the trade
+// was prevented and whether the taker can no longer trade.
+//
+// A taker that rests on the book is cancelled or decremented here. An
+// immediate taker is only reduced, as the caller closes it and releases its
+// lock once it stops sweeping.
+func (e *Engine) preventSelfTrade(taker, maker *entity.Order) (prevented, takerDone bool) {
+	mode := taker.SelfTradePrevention
+	if mode == "" || taker.UserID != maker.UserID {
+		return false, false
+	}
+
+	quantity := e.selfTradeQuantity(taker, maker)
+	_, takerResting := e.Book(taker.Asset).Get(taker.ID)
+	switch mode {
+	case utils.CancelNewest:
+		e.cancelTaker(taker, takerResting)
+		takerDone = true
+	case utils.CancelOldest:
+		e.cancel(maker, e.UnsharedLock(maker))
+	case utils.CancelBoth:
+		e.cancelTaker(taker, takerResting)
+		e.cancel(maker, e.UnsharedLock(maker))
+		takerDone = true
+	case utils.DecrementBoth:
+		e.cancelSibling(taker)
+		e.cancelSibling(maker)
+		e.decrement(maker, quantity, maker.OrderPrice, true)
+		e.decrement(taker, quantity, maker.OrderPrice, takerResting)
+		takerDone = !taker.OrderQuantity.IsPositive()
+		if utils.IsQuoteSized(taker) {
+			takerDone = !taker.QuoteAmount.IsPositive()
+		}
+	default:
+		return false, false
+	}
+
+	e.result.SelfTrades = append(e.result.SelfTrades, entity.SelfTradeEvent{
+		ID:           e.newID(),
+		UserID:       taker.UserID,
+		TakerOrderID: taker.ID,
+		MakerOrderID: maker.ID,
+		Mode:         mode,
+		Quantity:     quantity,
+		Reason:       selfTradeReasons[mode],
+		CreatedAt:    e.now(),
+	})
+	return true, takerDone
+}
+
+// selfTradeQuantity is the quantity the two orders would have traded.
+func (e *Engine) selfTradeQuantity(taker, maker *entity.Order) decimal.Decimal {
+	if utils.IsQuoteSized(taker) {
+		return decimal.Min(orderbook.Visible(maker), e.affordable(taker, maker.OrderPrice))
+	}
+	return decimal.Min(orderbook.Visible(maker), orderbook.Visible(taker))
+}
+
+func (e *Engine) cancelTaker(taker *entity.Order, resting bool) {
+	if resting {
+		e.cancel(taker, e.UnsharedLock(taker))
+	}
+}
+
+// decrement takes quantity off the order without trading it. A resting order
+// releases the lock the removed quantity held.
+func (e *Engine) decrement(order *entity.Order, quantity, price decimal.Decimal, resting bool) {
+	if !resting {
+		if utils.IsQuoteSized(order) {
+			order.QuoteAmount = decimal.Max(decimal.Zero, order.QuoteAmount.Sub(quantity.MustMul(price)))
+		} else {
+			order.OrderQuantity = order.OrderQuantity.Sub(quantity)
+		}
+		return
+	}
+	before := utils.LockRequirement(order)
+	e.reduce(order, quantity)
+	e.result.Releases = append(e.result.Releases, Release{Order: order, Amount: before.Sub(utils.LockRequirement(order))})
+}
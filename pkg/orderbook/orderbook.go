@@ -0,0 +1,292 @@
+package orderbook
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"container/list"
+	"github.com/google/uuid"
+	"sort"
+)
+
+// OrderBook keeps the resting orders of one market in price-time priority.
+// Each side is a sorted slice of price levels (best price first) and every
+// level is a FIFO queue, so the head of the first level is always the next
+// order to trade.
+type OrderBook struct {
+	bids   []*priceLevel
+	asks   []*priceLevel
+	orders map[uuid.UUID]*entry
+}
+
+type priceLevel struct {
+	price  decimal.Decimal
+	orders *list.List
+}
+
+type entry struct {
+	order   *entity.Order
+	level   *priceLevel
+	element *list.Element
+}
+
+// Level is an aggregated view of one price level.
+type Level struct {
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
+	Orders   int
+}
+
+func New() *OrderBook {
+	return &OrderBook{orders: make(map[uuid.UUID]*entry)}
+}
+
+// Add rests the order at the back of the queue for its price.
+// An order that is already in the book is left untouched.
+func (b *OrderBook) Add(order *entity.Order) {
+	if _, ok := b.orders[order.ID]; ok {
+		return
+	}
+	level := b.level(order.Type, order.OrderPrice, true)
+	element := level.orders.PushBack(order)
+	b.orders[order.ID] = &entry{order: order, level: level, element: element}
+}
+
+// Remove takes the order out of the book and drops its price level once empty.
+func (b *OrderBook) Remove(orderID uuid.UUID) (*entity.Order, bool) {
+	e, ok := b.orders[orderID]
+	if !ok {
+		return nil, false
+	}
+	e.level.orders.Remove(e.element)
+	delete(b.orders, orderID)
+	if e.level.orders.Len() == 0 {
+		b.removeLevel(e.order.Type, e.level)
+	}
+	return e.order, true
+}
+
+// Requeue moves the order to the back of the queue at its price, as when an
+// iceberg order refreshes its visible slice.
+func (b *OrderBook) Requeue(orderID uuid.UUID) {
+	e, ok := b.orders[orderID]
+	if !ok {
+		return
+	}
+	e.level.orders.MoveToBack(e.element)
+}
+
+// Amend applies a changed copy of a resting order and returns the order as
+// it now rests. A smaller quantity keeps the order's place in the queue. A
+// later priority time, which an amend that raised the quantity gets, moves
+// it to the back of the queue, and a new price to the back of the queue at
+// that price. It reports false when the order is not in the book.
+func (b *OrderBook) Amend(order *entity.Order) (*entity.Order, bool) {
+	e, ok := b.orders[order.ID]
+	if !ok {
+		return nil, false
+	}
+	resting := e.order
+	if resting.Type != order.Type || !resting.OrderPrice.Equal(order.OrderPrice) {
+		b.Remove(order.ID)
+		b.Add(order)
+		return order, true
+	}
+	resting.OrderQuantity = order.OrderQuantity
+	resting.VisibleQuantity = order.VisibleQuantity
+	resting.Version = order.Version
+	if order.PriorityAt.After(resting.PriorityAt) {
+		resting.PriorityAt = order.PriorityAt
+		e.level.orders.MoveToBack(e.element)
+	}
+	return resting, true
+}
+
+// Orders returns every resting order, in no particular order.
+func (b *OrderBook) Orders() []*entity.Order {
+	orders := make([]*entity.Order, 0, len(b.orders))
+	for _, e := range b.orders {
+		orders = append(orders, e.order)
+	}
+	return orders
+}
+
+func (b *OrderBook) Get(orderID uuid.UUID) (*entity.Order, bool) {
+	e, ok := b.orders[orderID]
+	if !ok {
+		return nil, false
+	}
+	return e.order, true
+}
+
+// Best returns the order with the highest priority on the given side.
+func (b *OrderBook) Best(side string) *entity.Order {
+	levels := b.side(side)
+	if len(*levels) == 0 {
+		return nil
+	}
+	return (*levels)[0].orders.Front().Value.(*entity.Order)
+}
+
+func (b *OrderBook) BestBid() (decimal.Decimal, bool) {
+	if len(b.bids) == 0 {
+		return decimal.Zero, false
+	}
+	return b.bids[0].price, true
+}
+
+func (b *OrderBook) BestAsk() (decimal.Decimal, bool) {
+	if len(b.asks) == 0 {
+		return decimal.Zero, false
+	}
+	return b.asks[0].price, true
+}
+
+func (b *OrderBook) Len() int {
+	return len(b.orders)
+}
+
+// Depth aggregates up to n price levels of a side, best price first, as the
+// market sees them: an iceberg order counts with its visible slice only.
+// A non-positive n returns every level.
+func (b *OrderBook) Depth(side string, n int) []Level {
+	return b.aggregate(side, n, Visible)
+}
+
+// aggregate sums up to n price levels of a side, counting each order with
+// the given quantity.
+func (b *OrderBook) aggregate(side string, n int, quantity func(*entity.Order) decimal.Decimal) []Level {
+	levels := *b.side(side)
+	if n <= 0 || n > len(levels) {
+		n = len(levels)
+	}
+	depth := make([]Level, 0, n)
+	for _, level := range levels[:n] {
+		aggregated := Level{Price: level.price, Orders: level.orders.Len()}
+		for el := level.orders.Front(); el != nil; el = el.Next() {
+			aggregated.Quantity = aggregated.Quantity.Add(quantity(el.Value.(*entity.Order)))
+		}
+		depth = append(depth, aggregated)
+	}
+	return depth
+}
+
+// remainder is the whole quantity an order has left, its iceberg reserve
+// included.
+func remainder(order *entity.Order) decimal.Decimal {
+	return order.OrderQuantity
+}
+
+// Visible is the quantity of the order shown to the market. An iceberg order
+// only shows its current slice, every other order its whole remainder.
+func Visible(order *entity.Order) decimal.Decimal {
+	if order.DisplayQuantity.IsPositive() {
+		return order.VisibleQuantity
+	}
+	return order.OrderQuantity
+}
+
+func (b *OrderBook) side(side string) *[]*priceLevel {
+	if side == utils.BuyOrder {
+		return &b.bids
+	}
+	return &b.asks
+}
+
+// better reports whether price a has priority over price b on the given side.
+func better(side string, a, b decimal.Decimal) bool {
+	if side == utils.BuyOrder {
+		return a.GreaterThan(b)
+	}
+	return a.LessThan(b)
+}
+
+func (b *OrderBook) level(side string, price decimal.Decimal, create bool) *priceLevel {
+	levels := b.side(side)
+	i := sort.Search(len(*levels), func(i int) bool {
+		return !better(side, (*levels)[i].price, price)
+	})
+	if i < len(*levels) && (*levels)[i].price.Equal(price) {
+		return (*levels)[i]
+	}
+	if !create {
+		return nil
+	}
+	level := &priceLevel{price: price, orders: list.New()}
+	*levels = append(*levels, nil)
+	copy((*levels)[i+1:], (*levels)[i:])
+	(*levels)[i] = level
+	return level
+}
+
+func (b *OrderBook) removeLevel(side string, level *priceLevel) {
+	levels := b.side(side)
+	for i, l := range *levels {
+		if l == level {
+			*levels = append((*levels)[:i], (*levels)[i+1:]...)
+			return
+		}
+	}
+}
+
+// Equilibrium finds the single price at which the most quantity would trade
+// if the book were uncrossed at once, as in a call auction. Ties are broken
+// by the smallest imbalance between the two sides, then by the distance to
+// the reference price, then by the lower price. Iceberg orders take part
+// with their whole remainder, hidden reserve included. The volume is zero
+// when the book does not cross.
+func (b *OrderBook) Equilibrium(reference decimal.Decimal) (price, volume decimal.Decimal) {
+	var bestImbalance decimal.Decimal
+	bids, asks := b.aggregate(utils.BuyOrder, 0, remainder), b.aggregate(utils.SellOrder, 0, remainder)
+	for _, candidate := range b.candidatePrices() {
+		var demand, supply decimal.Decimal
+		for _, level := range bids {
+			if level.Price.GreaterThanOrEqual(candidate) {
+				demand = demand.Add(level.Quantity)
+			}
+		}
+		for _, level := range asks {
+			if level.Price.LessThanOrEqual(candidate) {
+				supply = supply.Add(level.Quantity)
+			}
+		}
+		executable := decimal.Min(demand, supply)
+		imbalance := demand.Sub(supply).Abs()
+		if executable.IsZero() {
+			continue
+		}
+		if volume.IsZero() || executable.GreaterThan(volume) ||
+			(executable.Equal(volume) && imbalance.LessThan(bestImbalance)) ||
+			(executable.Equal(volume) && imbalance.Equal(bestImbalance) && closer(candidate, price, reference)) {
+			price, volume, bestImbalance = candidate, executable, imbalance
+		}
+	}
+	return price, volume
+}
+
+func (b *OrderBook) candidatePrices() []decimal.Decimal {
+	prices := make([]decimal.Decimal, 0, len(b.bids)+len(b.asks))
+	for _, level := range b.bids {
+		prices = append(prices, level.price)
+	}
+	for _, level := range b.asks {
+		prices = append(prices, level.price)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].LessThan(prices[j])
+	})
+	return prices
+}
+
+// closer reports whether price a is closer to the reference than price b.
+// Without a reference the lower price wins, as it does on an exact tie.
+func closer(a, b, reference decimal.Decimal) bool {
+	if !reference.IsPositive() {
+		return a.LessThan(b)
+	}
+	da, db := a.Sub(reference).Abs(), b.Sub(reference).Abs()
+	if !da.Equal(db) {
+		return da.LessThan(db)
+	}
+	return a.LessThan(b)
+}
@@ -0,0 +1,10 @@
+package utils
+
+import "bitcoinOrder/pkg/decimal"
+
+// FitsPrecision reports whether the amount has no more decimal places than
+// precision. Amounts are kept to decimal.Scale places internally; deposits
+// and fees are held to the precision of their asset.
+func FitsPrecision(amount decimal.Decimal, precision int32) bool {
+	return amount.RoundDown(precision).Equal(amount)
+}
@@ -8,7 +8,9 @@ import (
 
 func GetBalance(db *gorm.DB, userID uuid.UUID) (entity.Users, error) {
 	var user entity.Users
-	if err := db.First(&user, "id = ?", userID).Error; err != nil {
+	if err := db.Preload("Balances", func(db *gorm.DB) *gorm.DB {
+		return db.Order("asset")
+	}).First(&user, "id = ?", userID).Error; err != nil {
 		return entity.Users{}, err
 	}
 	return user, nil
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+	"time"
+)
+
+// FeeAccountID is the exchange account every trading fee is credited to.
+var FeeAccountID = uuid.MustParse("00000000-0000-0000-0000-00000000fee0")
+
+const (
+	// FeeVolumeWindow is how far back a user's traded volume counts towards
+	// their fee tier.
+	FeeVolumeWindow = 30 * 24 * time.Hour
+	// FeeVolumeAsset is the quote asset traded volume is measured in; trades
+	// of symbols quoted in another asset do not count.
+	FeeVolumeAsset = "USDT"
+)
+
+// FeeRate picks the maker or taker rate of the highest tier the volume
+// reaches. The tiers must be sorted by MinVolume; no tier means no fee.
+func FeeRate(tiers []entity.FeeTier, volume decimal.Decimal, taker bool) decimal.Decimal {
+	var rate decimal.Decimal
+	for _, tier := range tiers {
+		if volume.LessThan(tier.MinVolume) {
+			break
+		}
+		rate = tier.MakerRate
+		if taker {
+			rate = tier.TakerRate
+		}
+	}
+	return rate
+}
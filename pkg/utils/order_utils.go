@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"github.com/google/uuid"
+)
+
+var hundred = decimal.NewFromInt(100)
+
+// ExecutesAsMarket reports whether orders of the kind execute as market
+// orders, at once or after being triggered.
+func ExecutesAsMarket(kind string) bool {
+	return kind == MarketOrder || kind == StopMarketOrder || kind == TrailingStop
+}
+
+// IsQuoteSized reports whether the order is a market buy, triggered or not,
+// which spends a quote amount instead of buying a fixed quantity.
+func IsQuoteSized(order *entity.Order) bool {
+	return order.Type == BuyOrder && ExecutesAsMarket(order.Kind)
+}
+
+// TrailingTrigger is the trigger price a trailing stop keeps from the market
+// price: above it for a buy and below it for a sell, by a fixed amount or a
+// percentage of the price.
+func TrailingTrigger(order *entity.Order, price decimal.Decimal) decimal.Decimal {
+	offset := order.TrailingAmount
+	if order.TrailingPercent.IsPositive() {
+		offset = price.MustMul(order.TrailingPercent).MustDiv(hundred)
+	}
+	if order.Type == BuyOrder {
+		return price.Add(offset)
+	}
+	return price.Sub(offset)
+}
+
+// PriceBand is the lowest and highest limit price allowed within band, a
+// fraction, of the reference price.
+func PriceBand(reference, band decimal.Decimal) (low, high decimal.Decimal) {
+	width := reference.MustMul(band)
+	return reference.Sub(width), reference.Add(width)
+}
+
+// LockRequirement is the amount the order's remainder keeps locked: the quote
+// asset for a buy and the base asset for a sell. Fees are kept back from the
+// asset a fill pays out, never from the one it spends, so the lock needs no
+// room for them.
+func LockRequirement(order *entity.Order) decimal.Decimal {
+	if order.Type == SellOrder {
+		return order.OrderQuantity
+	}
+	if IsQuoteSized(order) {
+		return order.QuoteAmount
+	}
+	return order.OrderPrice.MustMul(order.OrderQuantity)
+}
+
+// LockAmount is LockRequirement rounded up to precision, the decimal places
+// of the locked asset, so a lock always covers the order's remainder and
+// holds no more places than the balance it is taken from.
+func LockAmount(order *entity.Order, precision int32) decimal.Decimal {
+	return LockRequirement(order).RoundUp(precision)
+}
+
+// LockedAsset is the asset the order's funds are locked in: the quote asset
+// of its symbol for a buy and the base asset for a sell.
+func LockedAsset(order *entity.Order, symbol entity.Symbol) string {
+	if order.Type == BuyOrder {
+		return symbol.QuoteAsset
+	}
+	return symbol.BaseAsset
+}
+
+// LockID is the ID the order's lock is kept under: the group ID for a leg of
+// an OCO pair, whose legs share one lock, and the order's own ID otherwise.
+func LockID(order *entity.Order) uuid.UUID {
+	if order.OcoGroupID != nil {
+		return *order.OcoGroupID
+	}
+	return order.ID
+}
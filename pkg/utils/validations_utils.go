@@ -1,6 +1,9 @@
 package utils
 
-import "fmt"
+import (
+	"bitcoinOrder/pkg/decimal"
+	"fmt"
+)
 
 type OrderType string
 
@@ -9,6 +12,53 @@ const (
 	SellOrder = "sell"
 )
 
+const (
+	LimitOrder      = "limit"
+	MarketOrder     = "market"
+	StopMarketOrder = "stop_market"
+	StopLimitOrder  = "stop_limit"
+	TrailingStop    = "trailing_stop"
+)
+
+const (
+	GoodTillCancel    = "GTC"
+	ImmediateOrCancel = "IOC"
+	FillOrKill        = "FOK"
+	GoodTillDate      = "GTD"
+)
+
+// Self-trade prevention modes. They decide what happens when an order would
+// trade against another order of the same user.
+const (
+	CancelNewest  = "CN"
+	CancelOldest  = "CO"
+	CancelBoth    = "CB"
+	DecrementBoth = "DC"
+)
+
+// Trading statuses of a symbol. Open trades normally, post-only accepts only
+// orders that rest, cancel-only accepts only cancels and halted neither takes
+// orders nor matches them. Cancels are accepted in every status.
+const (
+	SymbolOpen       = "open"
+	SymbolPostOnly   = "post_only"
+	SymbolCancelOnly = "cancel_only"
+	SymbolHalted     = "halted"
+)
+
+// PriceTick is the price step a post-only order is moved by when it is
+// repriced away from the opposite best price and its symbol sets no tick
+// size.
+var PriceTick = decimal.RequireFromString("0.01")
+
+// DefaultMaxSlippage caps how far a market order may trade away from the
+// best opposite price when the order does not set its own limit.
+var DefaultMaxSlippage = decimal.RequireFromString("0.05")
+
+// DefaultSymbol is the symbol of orders that do not name one, the only market
+// the exchange had before the symbol registry.
+const DefaultSymbol = "BTCUSDT"
+
 func ValidateOrderType(orderType OrderType) error {
 	switch orderType {
 	case BuyOrder, SellOrder:
@@ -17,3 +67,41 @@ func ValidateOrderType(orderType OrderType) error {
 		return fmt.Errorf("invalid order type: %s", orderType)
 	}
 }
+
+func ValidateOrderKind(kind string) error {
+	switch kind {
+	case LimitOrder, MarketOrder, StopMarketOrder, StopLimitOrder, TrailingStop:
+		return nil
+	default:
+		return fmt.Errorf("invalid order kind: %s", kind)
+	}
+}
+
+func ValidateTimeInForce(timeInForce string) error {
+	switch timeInForce {
+	case GoodTillCancel, ImmediateOrCancel, FillOrKill, GoodTillDate:
+		return nil
+	default:
+		return fmt.Errorf("invalid time in force: %s", timeInForce)
+	}
+}
+
+func ValidateSymbolStatus(status string) error {
+	switch status {
+	case SymbolOpen, SymbolPostOnly, SymbolCancelOnly, SymbolHalted:
+		return nil
+	default:
+		return fmt.Errorf("invalid symbol status: %s", status)
+	}
+}
+
+// ValidateSelfTradePrevention accepts the empty mode, which lets self-trades
+// happen.
+func ValidateSelfTradePrevention(mode string) error {
+	switch mode {
+	case "", CancelNewest, CancelOldest, CancelBoth, DecrementBoth:
+		return nil
+	default:
+		return fmt.Errorf("invalid self-trade prevention mode: %s", mode)
+	}
+}
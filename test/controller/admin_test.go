@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"bitcoinOrder/internal/app/ordercreator/controller"
+	"bitcoinOrder/internal/app/ordercreator/service"
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// admin records the admin requests that reach the service. Methods the
+// tests do not reach are left to the nil interface.
+type admin struct {
+	service.IOrderCreatorService
+	auctions []dto.AuctionDto
+	statuses []dto.SymbolStatusDto
+	assets   []dto.AssetDto
+}
+
+func (s *admin) StartAuction(_ context.Context, symbol string, auction dto.AuctionDto) (entity.Auction, error) {
+	s.auctions = append(s.auctions, auction)
+	return entity.Auction{Symbol: symbol, Reason: auction.Reason}, nil
+}
+
+func (s *admin) UpdateSymbolStatus(_ context.Context, symbol string, status dto.SymbolStatusDto) (entity.SymbolStatusChange, error) {
+	s.statuses = append(s.statuses, status)
+	return entity.SymbolStatusChange{Symbol: symbol, ToStatus: status.Status, ChangedBy: status.ChangedBy}, nil
+}
+
+func (s *admin) CreateAsset(_ context.Context, asset dto.AssetDto) (entity.Asset, error) {
+	s.assets = append(s.assets, asset)
+	return entity.Asset{Code: asset.Code}, nil
+}
+
+func (s *admin) UpdateAsset(_ context.Context, code string, asset dto.AssetDto) (entity.Asset, error) {
+	s.assets = append(s.assets, asset)
+	return entity.Asset{Code: code}, nil
+}
+
+// calls is how many admin requests reached the service.
+func (s *admin) calls() int {
+	return len(s.auctions) + len(s.statuses) + len(s.assets)
+}
+
+// serve sends one request to the routes of a handler that knows a single
+// admin, alice, by the token "secret".
+func serve(svc service.IOrderCreatorService, method, path, body, authorization string) *httptest.ResponseRecorder {
+	e := echo.New()
+	controller.NewOrderCreatorHandler(svc, map[string]string{"alice": "secret"}).RegisterRoutes(e)
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if authorization != "" {
+		req.Header.Set(echo.HeaderAuthorization, authorization)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRoutesNeedAnAdmin(t *testing.T) {
+	routes := []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPost, "/api/v1/symbols/BTCUSDT/auction", `{"DurationSeconds": 60, "Reason": "open"}`, http.StatusCreated},
+		{http.MethodPut, "/api/v1/symbols/BTCUSDT/status", `{"Status": "halted", "Reason": "maintenance"}`, http.StatusOK},
+		{http.MethodPost, "/api/v1/assets", `{"Code": "SOL", "Precision": 8}`, http.StatusCreated},
+		{http.MethodPut, "/api/v1/assets/SOL", `{"Precision": 6}`, http.StatusOK},
+	}
+	cases := []struct {
+		name          string
+		authorization string
+		code          int
+	}{
+		{"No token", "", http.StatusUnauthorized},
+		{"Not a bearer token", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized},
+		{"Unknown token", "Bearer guess", http.StatusForbidden},
+	}
+	for _, route := range routes {
+		for _, c := range cases {
+			t.Run(route.path+" "+c.name, func(t *testing.T) {
+				svc := &admin{}
+				rec := serve(svc, route.method, route.path, route.body, c.authorization)
+				assert.Equal(t, c.code, rec.Code)
+				assert.Zero(t, svc.calls())
+			})
+		}
+		t.Run(route.path+" Admin token", func(t *testing.T) {
+			svc := &admin{}
+			rec := serve(svc, route.method, route.path, route.body, "Bearer secret")
+			assert.Equal(t, route.code, rec.Code)
+			assert.Equal(t, 1, svc.calls())
+		})
+	}
+}
+
+func TestStatusChangeRecordsTheAdmin(t *testing.T) {
+	svc := &admin{}
+	body := `{"Status": "halted", "ChangedBy": "mallory", "Reason": "maintenance"}`
+	rec := serve(svc, http.MethodPut, "/api/v1/symbols/BTCUSDT/status", body, "Bearer secret")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.Len(t, svc.statuses, 1) {
+		// the actor is the authenticated admin, not the one in the body
+		assert.Equal(t, "alice", svc.statuses[0].ChangedBy)
+		assert.Equal(t, "maintenance", svc.statuses[0].Reason)
+	}
+}
@@ -0,0 +1,95 @@
+package decimal
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExactSums(t *testing.T) {
+	sum := decimal.Zero
+	for i := 0; i < 10; i++ {
+		sum = sum.Add(decimal.RequireFromString("0.1"))
+	}
+	assert.True(t, sum.Equal(decimal.NewFromInt(1)))
+	assert.True(t, decimal.RequireFromString("0.3").IsMultipleOf(decimal.RequireFromString("0.1")))
+}
+
+func TestParse(t *testing.T) {
+	value, err := decimal.NewFromString("-12.50000000")
+	assert.NoError(t, err)
+	assert.Equal(t, "-12.5", value.String())
+
+	_, err = decimal.NewFromString("0.000000001")
+	assert.ErrorIs(t, err, decimal.ErrInvalidDecimal)
+	_, err = decimal.NewFromString("1e-5")
+	assert.ErrorIs(t, err, decimal.ErrInvalidDecimal)
+
+	value, err = decimal.NewFromString("+0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, "0.5", value.String())
+	for _, signs := range []string{"--1", "+-1", "-+1", "++1"} {
+		_, err = decimal.NewFromString(signs)
+		assert.ErrorIs(t, err, decimal.ErrInvalidDecimal, signs)
+	}
+}
+
+func TestRounding(t *testing.T) {
+	third := decimal.NewFromInt(1).MustDiv(decimal.NewFromInt(3))
+	assert.Equal(t, "0.33333333", third.String())
+	assert.Equal(t, "0.66666667", decimal.NewFromInt(2).MustDiv(decimal.NewFromInt(3)).String())
+	assert.Equal(t, "0.33333333", decimal.NewFromInt(1).MustDivDown(decimal.NewFromInt(3)).String())
+
+	fee := decimal.RequireFromString("1.2345675")
+	assert.Equal(t, "1.234568", fee.Round(6).String())
+	assert.Equal(t, "1.234567", fee.RoundDown(6).String())
+	assert.Equal(t, "-1.234568", fee.Neg().RoundUp(6).String())
+	assert.Equal(t, "1.2", fee.RoundDownToStep(decimal.RequireFromString("0.05")).String())
+	assert.Equal(t, fee, fee.RoundDownToStep(decimal.Zero))
+}
+
+func TestOverflow(t *testing.T) {
+	large := decimal.NewFromInt(1_000_000_000)
+	_, err := large.Mul(large)
+	assert.ErrorIs(t, err, decimal.ErrOverflow)
+	_, err = large.Div(decimal.RequireFromString("0.00000001"))
+	assert.ErrorIs(t, err, decimal.ErrOverflow)
+	_, err = large.DivDown(decimal.RequireFromString("0.00000001"))
+	assert.ErrorIs(t, err, decimal.ErrOverflow)
+	assert.Panics(t, func() { large.MustMul(large) })
+
+	product, err := large.Mul(decimal.NewFromInt(10))
+	assert.NoError(t, err)
+	assert.Equal(t, "10000000000", product.String())
+
+	largest := decimal.RequireFromString("92233720368.54775807")
+	smallest := largest.Neg().Sub(decimal.RequireFromString("0.00000001"))
+	assert.PanicsWithValue(t, decimal.ErrOverflow, func() { largest.Add(decimal.RequireFromString("0.00000001")) })
+	assert.PanicsWithValue(t, decimal.ErrOverflow, func() { smallest.Sub(decimal.RequireFromString("0.00000001")) })
+	assert.PanicsWithValue(t, decimal.ErrOverflow, func() { largest.Sub(largest.Neg()) })
+	assert.PanicsWithValue(t, decimal.ErrOverflow, func() { smallest.Neg() })
+	assert.PanicsWithValue(t, decimal.ErrOverflow, func() { decimal.NewFromInt(92233720369) })
+	assert.Equal(t, "-92233720368", decimal.NewFromInt(-92233720368).String())
+}
+
+func TestJSON(t *testing.T) {
+	var body struct {
+		Price    decimal.Decimal
+		Quantity decimal.Decimal
+	}
+	err := json.Unmarshal([]byte(`{"Price": "30000.01", "Quantity": 0.5}`), &body)
+	assert.NoError(t, err)
+	assert.Equal(t, "30000.01", body.Price.String())
+	assert.Equal(t, "0.5", body.Quantity.String())
+
+	// a float the client rounded is refused, not rounded again
+	for _, quantity := range []string{`1e-5`, `"1e-5"`, `0.123456789`, `"0.123456789"`} {
+		err = json.Unmarshal([]byte(`{"Quantity": `+quantity+`}`), &body)
+		assert.ErrorIs(t, err, decimal.ErrInvalidDecimal, quantity)
+	}
+
+	out, err := json.Marshal(body)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Price": "30000.01", "Quantity": "0.5"}`, string(out))
+}
@@ -0,0 +1,38 @@
+package ledger
+
+import (
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/ledger"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTradeJournalBalances(t *testing.T) {
+	buyer, seller := uuid.New(), uuid.New()
+	matchID := uuid.New()
+	journal := ledger.NewJournal(ledger.Trade, matchID).
+		Transfer("USDT", decimal.RequireFromString("30000.5"), ledger.AvailableOf(buyer), ledger.AvailableOf(seller)).
+		Transfer("BTC", decimal.RequireFromString("1"), ledger.AvailableOf(seller), ledger.AvailableOf(buyer)).
+		Transfer("BTC", decimal.Zero, ledger.AvailableOf(buyer), ledger.AvailableOf(seller))
+
+	assert.NoError(t, journal.Validate())
+	if assert.Len(t, journal.Entries, 4) {
+		assert.Equal(t, "-30000.5", journal.Entries[0].Amount.String())
+		assert.Equal(t, buyer, journal.Entries[0].UserID)
+		for _, entry := range journal.Entries {
+			assert.Equal(t, journal.ID, entry.JournalID)
+			assert.Equal(t, matchID, entry.EventID)
+			assert.Equal(t, ledger.Trade, entry.EventType)
+		}
+	}
+}
+
+func TestUnbalancedJournal(t *testing.T) {
+	userID := uuid.New()
+	journal := ledger.NewJournal(ledger.Lock, uuid.New()).
+		Transfer("BTC", decimal.NewFromInt(1), ledger.AvailableOf(userID), ledger.LockedOf(userID))
+	journal.Entries[1].Amount = decimal.NewFromInt(2)
+
+	assert.ErrorIs(t, journal.Validate(), ledger.ErrUnbalanced)
+}
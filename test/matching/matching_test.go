@@ -0,0 +1,310 @@
+package matching
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/matching"
+	"bitcoinOrder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const symbol = "BTCUSDT"
+
+var d = decimal.NewFromFloat
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newEngine returns an engine whose clock ticks one second per reading and
+// whose IDs count up, so two engines fed the same orders agree exactly.
+func newEngine() *matching.Engine {
+	now, next := start, 0
+	return matching.New(
+		func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		},
+		func() uuid.UUID {
+			next++
+			var id uuid.UUID
+			id[15] = byte(next)
+			return id
+		})
+}
+
+func newOrder(id byte, side string, price, quantity float64, at int) *entity.Order {
+	var orderID, userID uuid.UUID
+	orderID[0], userID[1] = id, id
+	placed := start.Add(time.Duration(at) * time.Minute)
+	return &entity.Order{
+		ID:            orderID,
+		UserID:        userID,
+		Asset:         symbol,
+		Kind:          utils.LimitOrder,
+		TimeInForce:   utils.GoodTillCancel,
+		Type:          side,
+		OrderPrice:    d(price),
+		OrderQuantity: d(quantity),
+		OrderStatus:   true,
+		CreatedAt:     placed,
+		PriorityAt:    placed,
+	}
+}
+
+func restingBook() []*entity.Order {
+	return []*entity.Order{
+		newOrder(1, utils.SellOrder, 101, 1, 0),
+		newOrder(2, utils.SellOrder, 100, 1, 1),
+		newOrder(3, utils.SellOrder, 100, 2, 2),
+		newOrder(4, utils.BuyOrder, 102, 2.5, 3),
+	}
+}
+
+func TestMatchIsDeterministic(t *testing.T) {
+	run := func() matching.Result {
+		engine := newEngine()
+		for _, order := range restingBook() {
+			engine.Book(symbol).Add(order)
+		}
+		return engine.Match(symbol, nil)
+	}
+
+	result := run()
+	assert.Equal(t, run(), result)
+
+	t.Run("Price-time priority at the maker's price", func(t *testing.T) {
+		if assert.Len(t, result.Matches, 2) {
+			assert.Equal(t, d(100), result.Matches[0].Price)
+			assert.Equal(t, d(1), result.Matches[0].OrderQuantity)
+			assert.Equal(t, byte(2), result.Matches[0].OrderID2[0])
+			assert.Equal(t, d(1.5), result.Matches[1].OrderQuantity)
+			assert.Equal(t, byte(3), result.Matches[1].OrderID2[0])
+			assert.Equal(t, utils.BuyOrder, result.Matches[1].TakerSide)
+		}
+	})
+
+	t.Run("Clock and IDs come from the engine", func(t *testing.T) {
+		assert.Equal(t, byte(1), result.Matches[0].ID[15])
+		assert.Equal(t, start.Add(time.Second), result.Matches[0].MatchedAt)
+	})
+}
+
+func TestExecute(t *testing.T) {
+	t.Run("IOC fills what it can and closes", func(t *testing.T) {
+		engine := newEngine()
+		for _, order := range restingBook()[:3] {
+			engine.Book(symbol).Add(order)
+		}
+		taker := newOrder(9, utils.BuyOrder, 100, 5, 9)
+		taker.TimeInForce = utils.ImmediateOrCancel
+
+		result := engine.Execute(taker, nil)
+		assert.Len(t, result.Matches, 2)
+		assert.Equal(t, d(2), taker.OrderQuantity)
+		assert.False(t, taker.OrderStatus)
+		assert.Same(t, taker, result.Orders[len(result.Orders)-1])
+		assert.Equal(t, 1, engine.Book(symbol).Len())
+	})
+
+	t.Run("FOK that cannot fill does not trade", func(t *testing.T) {
+		engine := newEngine()
+		for _, order := range restingBook()[:3] {
+			engine.Book(symbol).Add(order)
+		}
+		taker := newOrder(9, utils.BuyOrder, 100, 5, 9)
+		taker.TimeInForce = utils.FillOrKill
+
+		result := engine.Execute(taker, nil)
+		assert.Empty(t, result.Matches)
+		assert.False(t, taker.OrderStatus)
+		assert.Equal(t, 3, engine.Book(symbol).Len())
+	})
+}
+
+func TestSymbolsDoNotShareBooks(t *testing.T) {
+	engine := newEngine()
+	bid := newOrder(1, utils.BuyOrder, 105, 1, 0)
+	ask := newOrder(2, utils.SellOrder, 100, 1, 1)
+	ask.Asset = "ETHUSDT"
+	engine.Book(bid.Asset).Add(bid)
+	engine.Book(ask.Asset).Add(ask)
+
+	assert.Equal(t, []string{"BTCUSDT", "ETHUSDT"}, engine.Symbols())
+	for _, name := range engine.Symbols() {
+		assert.Empty(t, engine.Match(name, nil).Matches, "a bid never crosses an ask of another symbol")
+		assert.Equal(t, 1, engine.Book(name).Len())
+	}
+
+	t.Run("A taker only sweeps the book of its own symbol", func(t *testing.T) {
+		taker := newOrder(3, utils.SellOrder, 90, 2, 2)
+		taker.Asset, taker.TimeInForce = "ETHUSDT", utils.ImmediateOrCancel
+
+		result := engine.Execute(taker, nil)
+		assert.Empty(t, result.Matches, "the only bid is on BTCUSDT")
+		assert.Equal(t, 1, engine.Book(symbol).Len())
+		assert.Equal(t, 1, engine.Book("ETHUSDT").Len())
+	})
+}
+
+func TestMarketBuy(t *testing.T) {
+	lot := matching.Lot{StepSize: d(0.01), MinQuantity: d(0.05), Precision: 8}
+	newMarketBuy := func(quote, cap float64) *entity.Order {
+		order := newOrder(9, utils.BuyOrder, cap, 0, 9)
+		order.Kind, order.QuoteAmount = utils.MarketOrder, d(quote)
+		return order
+	}
+	newBook := func() *matching.Engine {
+		engine := newEngine()
+		engine.SetLot(symbol, lot)
+		for _, order := range restingBook()[:3] {
+			engine.Book(symbol).Add(order)
+		}
+		return engine
+	}
+
+	t.Run("Sweeps several levels in whole steps", func(t *testing.T) {
+		engine := newBook()
+		taker := newMarketBuy(350, 110)
+
+		result := engine.Execute(taker, nil)
+		if assert.Len(t, result.Matches, 3) {
+			assert.Equal(t, d(1), result.Matches[0].OrderQuantity)
+			assert.Equal(t, d(2), result.Matches[1].OrderQuantity)
+			// 50 buys 0.495 at 101, rounded down to the step
+			assert.Equal(t, d(101), result.Matches[2].Price)
+			assert.Equal(t, d(0.49), result.Matches[2].OrderQuantity)
+		}
+		assert.Equal(t, d(0.51), taker.QuoteAmount)
+		assert.False(t, taker.OrderStatus)
+	})
+
+	t.Run("The slippage cap stops the sweep", func(t *testing.T) {
+		engine := newBook()
+		taker := newMarketBuy(1000, 100)
+
+		result := engine.Execute(taker, nil)
+		assert.Len(t, result.Matches, 2)
+		assert.Equal(t, d(700), taker.QuoteAmount)
+		assert.Equal(t, 1, engine.Book(symbol).Len())
+	})
+
+	t.Run("A remainder below the minimum quantity is released", func(t *testing.T) {
+		engine := newBook()
+		taker := newMarketBuy(305, 110)
+
+		result := engine.Execute(taker, nil)
+		// 5 buys 0.04 at 101, less than the minimum of 0.05
+		assert.Len(t, result.Matches, 2)
+		assert.Equal(t, 1, engine.Book(symbol).Len())
+		assert.False(t, taker.OrderStatus)
+		assert.Equal(t, d(5), engine.UnsharedLock(taker))
+	})
+}
+
+// ceiling refuses every trade above its price.
+type ceiling struct{ price decimal.Decimal }
+
+func (c ceiling) Allow(_ string, price decimal.Decimal, _ time.Time) bool {
+	return price.LessThanOrEqual(c.price)
+}
+
+func (c ceiling) Check(symbol string, price decimal.Decimal, at time.Time) bool {
+	return c.Allow(symbol, price, at)
+}
+
+func TestGuardStopsMatching(t *testing.T) {
+	engine := newEngine()
+	for _, order := range restingBook()[:3] {
+		engine.Book(symbol).Add(order)
+	}
+	taker := newOrder(9, utils.BuyOrder, 101, 4, 9)
+	taker.TimeInForce = utils.ImmediateOrCancel
+
+	result := engine.Execute(taker, ceiling{d(100)})
+	assert.Len(t, result.Matches, 2)
+	assert.Equal(t, d(1), taker.OrderQuantity)
+	assert.Equal(t, 1, engine.Book(symbol).Len())
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	cases := []struct {
+		mode          string
+		released      bool // whether the maker gives up part of its lock
+		makerQuantity float64
+		makerOpen     bool
+		takerQuantity float64
+	}{
+		{utils.CancelNewest, false, 2, true, 1},
+		{utils.CancelOldest, true, 2, false, 1},
+		{utils.CancelBoth, true, 2, false, 1},
+		{utils.DecrementBoth, true, 1, true, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			engine := newEngine()
+			maker := newOrder(1, utils.SellOrder, 100, 2, 0)
+			engine.Book(symbol).Add(maker)
+			taker := newOrder(9, utils.BuyOrder, 100, 1, 9)
+			taker.UserID = maker.UserID
+			taker.SelfTradePrevention = c.mode
+			taker.TimeInForce = utils.ImmediateOrCancel
+
+			result := engine.Execute(taker, nil)
+			assert.Empty(t, result.Matches)
+			if assert.Len(t, result.SelfTrades, 1) {
+				assert.Equal(t, c.mode, result.SelfTrades[0].Mode)
+				assert.Equal(t, d(1), result.SelfTrades[0].Quantity)
+			}
+			if c.released && assert.Len(t, result.Releases, 1) {
+				assert.Same(t, maker, result.Releases[0].Order)
+			} else if !c.released {
+				assert.Empty(t, result.Releases)
+			}
+			assert.Equal(t, c.makerOpen, maker.OrderStatus)
+			assert.Equal(t, d(c.makerQuantity), maker.OrderQuantity)
+			assert.Equal(t, d(c.takerQuantity), taker.OrderQuantity)
+			assert.False(t, taker.OrderStatus)
+			_, resting := engine.Book(symbol).Get(maker.ID)
+			assert.Equal(t, c.makerOpen, resting)
+		})
+	}
+}
+
+func TestOcoSiblingIsCancelled(t *testing.T) {
+	engine := newEngine()
+	group := uuid.New()
+	limitLeg := newOrder(1, utils.SellOrder, 101, 1, 0)
+	stopLeg := newOrder(2, utils.SellOrder, 90, 2, 0)
+	stopLeg.Kind, stopLeg.TriggerPrice = utils.StopLimitOrder, d(91)
+	for _, leg := range []*entity.Order{limitLeg, stopLeg} {
+		leg.UserID, leg.OcoGroupID = limitLeg.UserID, &group
+		engine.Track(leg)
+	}
+	engine.Book(symbol).Add(limitLeg)
+	taker := newOrder(9, utils.BuyOrder, 101, 1, 9)
+	taker.TimeInForce = utils.ImmediateOrCancel
+
+	result := engine.Execute(taker, nil)
+	assert.Len(t, result.Matches, 1)
+	if assert.Len(t, result.Releases, 1) {
+		assert.Same(t, stopLeg, result.Releases[0].Order)
+		// the legs share one lock, and the filled leg needed 1 of the 2 it holds
+		assert.Equal(t, d(1), result.Releases[0].Amount)
+	}
+	assert.False(t, stopLeg.OrderStatus)
+	assert.False(t, limitLeg.OrderStatus)
+	assert.True(t, engine.UnsharedLock(limitLeg).IsZero())
+}
+
+func BenchmarkMatch(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		engine := newEngine()
+		for level := 0; level < 100; level++ {
+			engine.Book(symbol).Add(newOrder(byte(level), utils.SellOrder, 100+float64(level), 1, level))
+		}
+		engine.Book(symbol).Add(newOrder(255, utils.BuyOrder, 200, 100, 200))
+		engine.Match(symbol, nil)
+	}
+}
@@ -0,0 +1,167 @@
+package orderbook
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/orderbook"
+	"bitcoinOrder/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var d = decimal.NewFromFloat
+
+func newOrder(side string, price, quantity float64) *entity.Order {
+	return &entity.Order{
+		ID:            uuid.New(),
+		Type:          side,
+		OrderPrice:    d(price),
+		OrderQuantity: d(quantity),
+		OrderStatus:   true,
+	}
+}
+
+func TestPriceTimePriority(t *testing.T) {
+	book := orderbook.New()
+	first := newOrder(utils.BuyOrder, 100, 1)
+	second := newOrder(utils.BuyOrder, 100, 2)
+	better := newOrder(utils.BuyOrder, 101, 1)
+	book.Add(first)
+	book.Add(second)
+	book.Add(better)
+
+	t.Run("Best price first", func(t *testing.T) {
+		assert.Equal(t, better.ID, book.Best(utils.BuyOrder).ID)
+		price, ok := book.BestBid()
+		assert.True(t, ok)
+		assert.Equal(t, d(101), price)
+	})
+
+	t.Run("FIFO within a level", func(t *testing.T) {
+		book.Remove(better.ID)
+		assert.Equal(t, first.ID, book.Best(utils.BuyOrder).ID)
+		book.Remove(first.ID)
+		assert.Equal(t, second.ID, book.Best(utils.BuyOrder).ID)
+	})
+
+	t.Run("Empty level is dropped", func(t *testing.T) {
+		book.Remove(second.ID)
+		assert.Nil(t, book.Best(utils.BuyOrder))
+		assert.Equal(t, 0, book.Len())
+		assert.Empty(t, book.Depth(utils.BuyOrder, 0))
+	})
+}
+
+func TestDepth(t *testing.T) {
+	book := orderbook.New()
+	book.Add(newOrder(utils.SellOrder, 102, 1))
+	book.Add(newOrder(utils.SellOrder, 101, 1))
+	book.Add(newOrder(utils.SellOrder, 101, 2))
+
+	depth := book.Depth(utils.SellOrder, 1)
+	assert.Equal(t, []orderbook.Level{{Price: d(101), Quantity: d(3), Orders: 2}}, depth)
+	assert.Len(t, book.Depth(utils.SellOrder, 0), 2)
+}
+
+func TestIcebergShowsVisibleSlice(t *testing.T) {
+	book := orderbook.New()
+	iceberg := newOrder(utils.SellOrder, 100, 10)
+	iceberg.DisplayQuantity = d(2)
+	iceberg.VisibleQuantity = d(2)
+	plain := newOrder(utils.SellOrder, 100, 1)
+	book.Add(iceberg)
+	book.Add(plain)
+
+	assert.Equal(t, []orderbook.Level{{Price: d(100), Quantity: d(3), Orders: 2}}, book.Depth(utils.SellOrder, 0))
+
+	book.Requeue(iceberg.ID)
+	assert.Equal(t, plain.ID, book.Best(utils.SellOrder).ID)
+}
+
+func TestEquilibrium(t *testing.T) {
+	book := orderbook.New()
+	book.Add(newOrder(utils.BuyOrder, 101, 2))
+	book.Add(newOrder(utils.BuyOrder, 100, 1))
+	book.Add(newOrder(utils.SellOrder, 99, 1))
+	book.Add(newOrder(utils.SellOrder, 100, 2))
+	book.Add(newOrder(utils.SellOrder, 102, 1))
+
+	t.Run("Price with the most volume", func(t *testing.T) {
+		price, volume := book.Equilibrium(decimal.Zero)
+		assert.Equal(t, d(100), price)
+		assert.Equal(t, d(3), volume)
+	})
+
+	t.Run("Reference price breaks ties", func(t *testing.T) {
+		tied := orderbook.New()
+		tied.Add(newOrder(utils.BuyOrder, 101, 1))
+		tied.Add(newOrder(utils.SellOrder, 99, 1))
+		price, volume := tied.Equilibrium(d(100.5))
+		assert.Equal(t, d(101), price)
+		assert.Equal(t, d(1), volume)
+	})
+
+	t.Run("Iceberg reserve takes part", func(t *testing.T) {
+		iceberg := orderbook.New()
+		hidden := newOrder(utils.SellOrder, 100, 5)
+		hidden.DisplayQuantity, hidden.VisibleQuantity = d(1), d(1)
+		iceberg.Add(hidden)
+		iceberg.Add(newOrder(utils.BuyOrder, 100, 4))
+		_, volume := iceberg.Equilibrium(decimal.Zero)
+		assert.Equal(t, d(4), volume)
+		assert.Equal(t, d(1), iceberg.Depth(utils.SellOrder, 0)[0].Quantity)
+	})
+
+	t.Run("No volume when the book does not cross", func(t *testing.T) {
+		book.Remove(book.Best(utils.SellOrder).ID)
+		book.Remove(book.Best(utils.SellOrder).ID)
+		_, volume := book.Equilibrium(decimal.Zero)
+		assert.Zero(t, volume)
+	})
+}
+
+func TestAmendPriority(t *testing.T) {
+	book := orderbook.New()
+	first := newOrder(utils.BuyOrder, 100, 2)
+	second := newOrder(utils.BuyOrder, 100, 2)
+	book.Add(first)
+	book.Add(second)
+
+	t.Run("A smaller quantity keeps the place in the queue", func(t *testing.T) {
+		smaller := *first
+		smaller.OrderQuantity, smaller.Version = d(1), first.Version+1
+		resting, ok := book.Amend(&smaller)
+		assert.True(t, ok)
+		assert.Same(t, first, resting)
+		assert.Equal(t, d(1), first.OrderQuantity)
+		assert.Equal(t, smaller.Version, first.Version, "the next write must expect the amended version")
+		assert.Equal(t, first.ID, book.Best(utils.BuyOrder).ID)
+	})
+
+	t.Run("A larger quantity goes to the back of the queue", func(t *testing.T) {
+		larger := *first
+		larger.OrderQuantity = d(3)
+		larger.PriorityAt = first.PriorityAt.Add(time.Second)
+		book.Amend(&larger)
+		assert.Equal(t, second.ID, book.Best(utils.BuyOrder).ID)
+	})
+
+	t.Run("A new price goes to the back of the queue at that price", func(t *testing.T) {
+		third := newOrder(utils.BuyOrder, 101, 1)
+		book.Add(third)
+		repriced := *second
+		repriced.OrderPrice = d(101)
+		resting, ok := book.Amend(&repriced)
+		assert.True(t, ok)
+		assert.Same(t, &repriced, resting)
+		assert.Equal(t, third.ID, book.Best(utils.BuyOrder).ID)
+		assert.Equal(t, []orderbook.Level{{Price: d(101), Quantity: d(3), Orders: 2}}, book.Depth(utils.BuyOrder, 1))
+	})
+
+	t.Run("An order not in the book is not amended", func(t *testing.T) {
+		_, ok := book.Amend(newOrder(utils.BuyOrder, 100, 1))
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,870 @@
+package orderchecker
+
+import (
+	"bitcoinOrder/internal/app/orderchecker/service"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/ledger"
+	"bitcoinOrder/pkg/utils"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const symbol = "BTCUSDT"
+
+var d = decimal.RequireFromString
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// noTx is a database driver whose transactions do nothing, so the service
+// can begin and commit them while every query goes to the fakes below.
+type noTx struct{}
+
+func (noTx) Open(string) (driver.Conn, error)                             { return noTx{}, nil }
+func (noTx) Prepare(string) (driver.Stmt, error)                          { return nil, errors.New("no database") }
+func (noTx) Close() error                                                 { return nil }
+func (noTx) Begin() (driver.Tx, error)                                    { return noTx{}, nil }
+func (noTx) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) { return noTx{}, nil }
+func (noTx) Commit() error                                                { return nil }
+func (noTx) Rollback() error                                              { return nil }
+
+func init() {
+	sql.Register("notx", noTx{})
+}
+
+// transactions serves the open orders and records the orders the service
+// updates. Methods the tests do not reach are left to the nil interface.
+type transactions struct {
+	repository.ITransactionRepository
+	open       []entity.Order
+	lastPrices map[string]decimal.Decimal
+	updated    []*entity.Order
+	matches    []entity.OrderMatch
+	charged    []entity.OrderMatch
+	prevented  []entity.SelfTradeEvent
+	// versions is the version of each order in the table, where an amend
+	// the checker has not synced yet is ahead of the order it holds
+	versions map[uuid.UUID]int64
+}
+
+func (r *transactions) FindOpenOrders(context.Context) ([]entity.Order, error) {
+	return r.open, nil
+}
+
+func (r *transactions) FindLastMatchPrices(context.Context) (map[string]decimal.Decimal, error) {
+	return r.lastPrices, nil
+}
+
+func (r *transactions) UpdateOrders(_ context.Context, orders []*entity.Order) error {
+	for _, order := range orders {
+		if order.Version != r.versions[order.ID] {
+			return fmt.Errorf("%w: %s", repository.ErrOrderChanged, order.ID)
+		}
+		r.versions[order.ID]++
+		order.Version++
+	}
+	r.updated = append(r.updated, orders...)
+	return nil
+}
+
+func (r *transactions) FindOrderById(_ context.Context, orderID uuid.UUID) (entity.Order, error) {
+	for _, order := range r.open {
+		if order.ID == orderID {
+			order.User.ID = order.UserID
+			return order, nil
+		}
+	}
+	return entity.Order{}, errors.New("order not found")
+}
+
+func (r *transactions) UpdateMatchFees(_ context.Context, match entity.OrderMatch) error {
+	r.charged = append(r.charged, match)
+	return nil
+}
+
+func (r *transactions) SaveMatches(_ context.Context, orderMatches []entity.OrderMatch) error {
+	r.matches = append(r.matches, orderMatches...)
+	return nil
+}
+
+func (r *transactions) SaveSelfTradeEvents(_ context.Context, events []entity.SelfTradeEvent) error {
+	r.prevented = append(r.prevented, events...)
+	return nil
+}
+
+type symbols struct {
+	repository.ISymbolRepository
+	symbols []entity.Symbol
+}
+
+func (r *symbols) FindAllSymbols(context.Context) ([]entity.Symbol, error) {
+	return r.symbols, nil
+}
+
+type halts struct {
+	created []entity.TradingHalt
+	resumed []uuid.UUID
+}
+
+func (r *halts) CreateHalt(_ context.Context, halt entity.TradingHalt) error {
+	r.created = append(r.created, halt)
+	return nil
+}
+
+func (r *halts) FindActiveHalts(context.Context) ([]entity.TradingHalt, error) {
+	return nil, nil
+}
+
+func (r *halts) ResumeHalt(_ context.Context, haltID uuid.UUID, _ time.Time) error {
+	r.resumed = append(r.resumed, haltID)
+	return nil
+}
+
+type auctions struct {
+	repository.IAuctionRepository
+	created []entity.Auction
+	updated []entity.Auction
+}
+
+func (r *auctions) CreateAuction(_ context.Context, auction entity.Auction) error {
+	r.created = append(r.created, auction)
+	return nil
+}
+
+func (r *auctions) FindOpenAuctions(context.Context) ([]entity.Auction, error) {
+	return nil, nil
+}
+
+func (r *auctions) UpdateAuction(_ context.Context, auction *entity.Auction) error {
+	r.updated = append(r.updated, *auction)
+	return nil
+}
+
+type fees struct {
+	repository.IFeeRepository
+	tiers   []entity.FeeTier
+	volumes map[uuid.UUID]decimal.Decimal
+}
+
+func (r *fees) FindFeeTiers(context.Context) ([]entity.FeeTier, error) {
+	return r.tiers, nil
+}
+
+func (r *fees) FindTradedVolume(_ context.Context, userID uuid.UUID, _ string, _ time.Time) (decimal.Decimal, error) {
+	return r.volumes[userID], nil
+}
+
+type assets struct {
+	repository.IAssetRepository
+	assets []entity.Asset
+}
+
+func (r *assets) FindAllAssets(context.Context) ([]entity.Asset, error) {
+	return r.assets, nil
+}
+
+func (r *assets) FindAsset(_ context.Context, code string) (entity.Asset, error) {
+	for _, asset := range r.assets {
+		if asset.Code == code {
+			return asset, nil
+		}
+	}
+	return entity.Asset{}, repository.ErrAssetNotFound
+}
+
+// heartbeats keeps when each user's dead-man's switch runs out.
+type heartbeats struct {
+	repository.IHeartbeatRepository
+	expiresAt map[uuid.UUID]time.Time
+}
+
+func (r *heartbeats) FindExpiredHeartbeats(_ context.Context, now time.Time) ([]entity.Heartbeat, error) {
+	var expired []entity.Heartbeat
+	for userID, expiresAt := range r.expiresAt {
+		if !expiresAt.After(now) {
+			expired = append(expired, entity.Heartbeat{UserID: userID, ExpiresAt: expiresAt})
+		}
+	}
+	return expired, nil
+}
+
+// balances keeps each user's available balance per asset.
+type balances struct {
+	repository.IBalanceRepository
+	available map[uuid.UUID]map[string]decimal.Decimal
+}
+
+func (r *balances) Credit(_ context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	if r.available[userID] == nil {
+		r.available[userID] = make(map[string]decimal.Decimal)
+	}
+	r.available[userID][asset] = r.available[userID][asset].Add(amount)
+	return nil
+}
+
+func (r *balances) Debit(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	return r.Credit(ctx, userID, asset, amount.Neg())
+}
+
+func (r *balances) Unlock(ctx context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	return r.Credit(ctx, userID, asset, amount)
+}
+
+// locks keeps the lock of each order by the order it was taken for.
+type locks struct {
+	repository.ILockRepository
+	held map[uuid.UUID]entity.Lock
+}
+
+func (r *locks) FindLock(_ context.Context, orderID uuid.UUID) (entity.Lock, error) {
+	if lock, ok := r.held[orderID]; ok {
+		return lock, nil
+	}
+	return entity.Lock{}, repository.ErrLockNotFound
+}
+
+func (r *locks) UpdateLockAmount(_ context.Context, lockID uuid.UUID, amount decimal.Decimal) error {
+	for orderID, lock := range r.held {
+		if lock.ID == lockID {
+			lock.Amount = lock.Amount.Sub(amount)
+			r.held[orderID] = lock
+		}
+	}
+	return nil
+}
+
+func (r *locks) DeleteLock(_ context.Context, lockID uuid.UUID) error {
+	for orderID, lock := range r.held {
+		if lock.ID == lockID {
+			delete(r.held, orderID)
+		}
+	}
+	return nil
+}
+
+// lock takes amount of an asset for an order, as the order creator does when
+// it accepts the order.
+func (r *locks) lock(orderID, userID uuid.UUID, asset string, amount decimal.Decimal) {
+	r.held[orderID] = entity.Lock{ID: uuid.New(), OrderID: &orderID, UserID: userID, Asset: asset, Amount: amount}
+}
+
+// journals refuses a journal whose entries do not balance.
+type journals struct {
+	repository.ILedgerRepository
+	posted []*ledger.Journal
+}
+
+func (r *journals) PostJournal(_ context.Context, journal *ledger.Journal) error {
+	if err := journal.Validate(); err != nil {
+		return err
+	}
+	r.posted = append(r.posted, journal)
+	return nil
+}
+
+// exchange is what a checker runs against: the fake repositories and the
+// time its clock reads, which only a test moves.
+type exchange struct {
+	*transactions
+	halts      *halts
+	auctions   *auctions
+	heartbeats *heartbeats
+	fees       *fees
+	assets     *assets
+	balances   *balances
+	locks      *locks
+	journals   *journals
+	now        time.Time
+}
+
+func market() entity.Symbol {
+	return entity.Symbol{Name: symbol, BaseAsset: "BTC", QuoteAsset: "USDT", TickSize: d("0.01"), Status: utils.SymbolOpen}
+}
+
+// newChecker loads a checker for one market whose book holds the given open
+// orders, which stay in the fake so a test can look at them afterwards. An
+// empty lastPrice leaves the market without a trade.
+func newChecker(t *testing.T, rules entity.Symbol, lastPrice string, orders ...entity.Order) (*service.OrderCheckerService, *exchange) {
+	db, err := sql.Open("notx", "")
+	require.NoError(t, err)
+	ex := &exchange{
+		transactions: &transactions{open: orders, lastPrices: map[string]decimal.Decimal{}, versions: map[uuid.UUID]int64{}},
+		halts:        &halts{},
+		auctions:     &auctions{},
+		heartbeats:   &heartbeats{expiresAt: map[uuid.UUID]time.Time{}},
+		fees:         &fees{volumes: map[uuid.UUID]decimal.Decimal{}},
+		assets:       &assets{},
+		balances:     &balances{available: map[uuid.UUID]map[string]decimal.Decimal{}},
+		locks:        &locks{held: map[uuid.UUID]entity.Lock{}},
+		journals:     &journals{},
+		now:          start,
+	}
+	if lastPrice != "" {
+		ex.lastPrices[symbol] = d(lastPrice)
+	}
+	checker := service.NewOrderCheckerService(ex.transactions, ex.locks, ex.balances, ex.assets,
+		&symbols{symbols: []entity.Symbol{rules}}, ex.auctions, ex.heartbeats, ex.fees, ex.halts, ex.journals, db,
+		func() time.Time { return ex.now })
+	require.NoError(t, checker.LoadOrderBook())
+	return checker, ex
+}
+
+func newOrder(id byte, side, kind string, price string) entity.Order {
+	var orderID, userID uuid.UUID
+	orderID[0], userID[1] = id, id
+	return entity.Order{
+		ID:            orderID,
+		UserID:        userID,
+		Asset:         symbol,
+		Kind:          kind,
+		TimeInForce:   utils.GoodTillCancel,
+		Type:          side,
+		OrderPrice:    d(price),
+		OrderQuantity: d("1"),
+		OrderStatus:   true,
+		CreatedAt:     start,
+		PriorityAt:    start,
+	}
+}
+
+func TestGoodTillDateStopsExpire(t *testing.T) {
+	expiresAt := start.Add(time.Hour)
+	stop := newOrder(1, utils.SellOrder, utils.StopLimitOrder, "95")
+	stop.TriggerPrice = d("96")
+	stop.TimeInForce, stop.ExpiresAt = utils.GoodTillDate, &expiresAt
+
+	group := uuid.New()
+	limitLeg := newOrder(2, utils.SellOrder, utils.LimitOrder, "110")
+	stopLeg := newOrder(3, utils.SellOrder, utils.StopLimitOrder, "90")
+	stopLeg.TriggerPrice = d("91")
+	for _, leg := range []*entity.Order{&limitLeg, &stopLeg} {
+		leg.UserID, leg.OcoGroupID = limitLeg.UserID, &group
+		leg.TimeInForce, leg.ExpiresAt = utils.GoodTillDate, &expiresAt
+	}
+	checker, ex := newChecker(t, market(), "", stop, limitLeg, stopLeg)
+	ctx := context.Background()
+
+	expired, err := checker.ExpireOrders(ctx, expiresAt.Add(-time.Second))
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+
+	expired, err = checker.ExpireOrders(ctx, expiresAt)
+	assert.NoError(t, err)
+	ids := make([]uuid.UUID, 0, len(expired))
+	for _, order := range expired {
+		ids = append(ids, order.ID)
+		assert.False(t, order.OrderStatus)
+	}
+	assert.ElementsMatch(t, []uuid.UUID{stop.ID, limitLeg.ID, stopLeg.ID}, ids)
+	assert.Len(t, ex.updated, 3)
+
+	t.Run("An expired stop no longer triggers", func(t *testing.T) {
+		triggered, err := checker.TriggerStopOrders(ctx, []entity.OrderMatch{{Symbol: symbol, Price: d("90")}})
+		assert.NoError(t, err)
+		assert.False(t, triggered)
+	})
+}
+
+func TestImmediateOrCancel(t *testing.T) {
+	ask := newOrder(1, utils.SellOrder, utils.LimitOrder, "100")
+	far := newOrder(2, utils.SellOrder, utils.LimitOrder, "102")
+	buy := newOrder(3, utils.BuyOrder, utils.LimitOrder, "101")
+	buy.TimeInForce, buy.OrderQuantity = utils.ImmediateOrCancel, d("3")
+	buy.CreatedAt, buy.PriorityAt = start.Add(time.Minute), start.Add(time.Minute)
+	checker, ex := newChecker(t, market(), "", ask, far, buy)
+	ex.locks.lock(buy.ID, buy.UserID, "USDT", d("303"))
+	ctx := context.Background()
+
+	matches, cancelled, err := checker.ExecuteImmediateOrders(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, d("1"), matches[0].OrderQuantity, "nothing trades beyond the limit price")
+	}
+	if assert.Len(t, cancelled, 1) {
+		assert.False(t, cancelled[0].OrderStatus, "the remainder is cancelled rather than resting")
+	}
+	assert.True(t, ex.open[1].OrderStatus)
+
+	assert.NoError(t, checker.ReleaseUnfilled(ctx, cancelled))
+	assert.Equal(t, d("202"), ex.balances.available[buy.UserID]["USDT"])
+	assert.Equal(t, d("101"), ex.locks.held[buy.ID].Amount, "what the fill spends is settled with the match")
+}
+
+func TestFillOrKill(t *testing.T) {
+	ask := newOrder(1, utils.SellOrder, utils.LimitOrder, "100")
+	far := newOrder(2, utils.SellOrder, utils.LimitOrder, "102")
+	buy := newOrder(3, utils.BuyOrder, utils.LimitOrder, "101")
+	buy.TimeInForce, buy.OrderQuantity = utils.FillOrKill, d("2")
+	buy.CreatedAt, buy.PriorityAt = start.Add(time.Minute), start.Add(time.Minute)
+	checker, ex := newChecker(t, market(), "", ask, far, buy)
+	ex.locks.lock(buy.ID, buy.UserID, "USDT", d("202"))
+	ctx := context.Background()
+
+	matches, cancelled, err := checker.ExecuteImmediateOrders(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, matches, "an order that cannot fill completely does not trade at all")
+	if assert.Len(t, cancelled, 1) {
+		assert.False(t, cancelled[0].OrderStatus)
+	}
+	assert.Equal(t, d("1"), ex.open[0].OrderQuantity)
+	assert.True(t, ex.open[0].OrderStatus)
+
+	assert.NoError(t, checker.ReleaseUnfilled(ctx, cancelled))
+	assert.Equal(t, d("202"), ex.balances.available[buy.UserID]["USDT"])
+	assert.Empty(t, ex.locks.held)
+}
+
+func TestGoodTillDateLimitOrdersExpire(t *testing.T) {
+	expiresAt := start.Add(time.Hour)
+	bid := newOrder(1, utils.BuyOrder, utils.LimitOrder, "100")
+	bid.TimeInForce, bid.ExpiresAt = utils.GoodTillDate, &expiresAt
+	checker, ex := newChecker(t, market(), "", bid)
+	ex.locks.lock(bid.ID, bid.UserID, "USDT", d("100"))
+	ctx := context.Background()
+
+	expired, err := checker.ExpireOrders(ctx, expiresAt.Add(-time.Second))
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+
+	expired, err = checker.ExpireOrders(ctx, expiresAt)
+	assert.NoError(t, err)
+	if assert.Len(t, expired, 1) {
+		assert.False(t, expired[0].OrderStatus)
+		assert.Equal(t, expiresAt, *expired[0].CompletedAt)
+	}
+
+	assert.NoError(t, checker.ReleaseUnfilled(ctx, expired))
+	assert.Equal(t, d("100"), ex.balances.available[bid.UserID]["USDT"])
+	assert.Empty(t, ex.locks.held, "the lock of an expired order is released")
+}
+
+func TestDeadMansSwitch(t *testing.T) {
+	bid := newOrder(1, utils.BuyOrder, utils.LimitOrder, "100")
+	ask := newOrder(2, utils.SellOrder, utils.LimitOrder, "110")
+	ask.UserID = bid.UserID
+	other := newOrder(3, utils.SellOrder, utils.LimitOrder, "120")
+	checker, ex := newChecker(t, market(), "", bid, ask, other)
+	ex.locks.lock(bid.ID, bid.UserID, "USDT", d("100"))
+	ex.locks.lock(ask.ID, ask.UserID, "BTC", d("1"))
+	ex.locks.lock(other.ID, other.UserID, "BTC", d("1"))
+	ex.heartbeats.expiresAt[bid.UserID] = start.Add(30 * time.Second)
+	ctx := context.Background()
+
+	assert.NoError(t, checker.CancelDisconnected(ctx, start.Add(29*time.Second)))
+	assert.NoError(t, checker.SettleCancellations(ctx))
+	assert.Empty(t, ex.updated, "the switch has not run out yet")
+
+	assert.NoError(t, checker.CancelDisconnected(ctx, start.Add(30*time.Second)))
+	assert.NoError(t, checker.SettleCancellations(ctx))
+	assert.False(t, ex.open[0].OrderStatus)
+	assert.False(t, ex.open[1].OrderStatus)
+	assert.True(t, ex.open[2].OrderStatus, "other users' orders stay open")
+	assert.Equal(t, d("100"), ex.balances.available[bid.UserID]["USDT"])
+	assert.Equal(t, d("1"), ex.balances.available[bid.UserID]["BTC"])
+	assert.Len(t, ex.locks.held, 1)
+}
+
+func TestPriceBand(t *testing.T) {
+	rules := market()
+	rules.PriceBand = d("0.05")
+	ctx := context.Background()
+
+	t.Run("A stop limit triggered outside the band is cancelled", func(t *testing.T) {
+		inBand := newOrder(1, utils.SellOrder, utils.StopLimitOrder, "95")
+		inBand.TriggerPrice = d("96")
+		outOfBand := newOrder(2, utils.SellOrder, utils.StopLimitOrder, "80")
+		outOfBand.TriggerPrice = d("96")
+		checker, ex := newChecker(t, rules, "100", inBand, outOfBand)
+
+		triggered, err := checker.TriggerStopOrders(ctx, []entity.OrderMatch{{Symbol: symbol, Price: d("96")}})
+		assert.NoError(t, err)
+		assert.True(t, triggered)
+		assert.True(t, ex.open[0].OrderStatus)
+		assert.Equal(t, utils.LimitOrder, ex.open[0].Kind)
+		assert.False(t, ex.open[1].OrderStatus)
+	})
+
+	t.Run("A post-only order is not repriced outside the band", func(t *testing.T) {
+		bid := newOrder(1, utils.BuyOrder, utils.LimitOrder, "100")
+		inBand := newOrder(2, utils.SellOrder, utils.LimitOrder, "99")
+		inBand.PostOnly, inBand.RepriceOnCross = true, true
+		checker, ex := newChecker(t, rules, "103", bid, inBand)
+
+		rejected, err := checker.PlacePostOnlyOrders(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, rejected)
+		assert.Equal(t, d("100.01"), ex.open[1].OrderPrice)
+
+		checker, ex = newChecker(t, rules, "110", bid, inBand)
+		rejected, err = checker.PlacePostOnlyOrders(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, rejected, 1) {
+			assert.Equal(t, inBand.ID, rejected[0].ID)
+		}
+		assert.False(t, ex.open[1].OrderStatus)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	rules := market()
+	rules.BreakerMove, rules.BreakerWindowSeconds = d("0.05"), 300
+	rules.BreakerCooldownSeconds, rules.ReopenAuctionSeconds = 300, 60
+	near := newOrder(1, utils.SellOrder, utils.LimitOrder, "100")
+	far := newOrder(2, utils.SellOrder, utils.LimitOrder, "110")
+	bid := newOrder(3, utils.BuyOrder, utils.LimitOrder, "110")
+	bid.OrderQuantity = d("2")
+	bid.CreatedAt, bid.PriorityAt = start.Add(time.Minute), start.Add(time.Minute)
+	checker, ex := newChecker(t, rules, "100", near, far, bid)
+	ctx := context.Background()
+
+	t.Run("A trade outside the window's move halts the symbol", func(t *testing.T) {
+		matches, err := checker.MatchOrder(ctx)
+		assert.NoError(t, err)
+		if assert.Len(t, matches, 1) {
+			assert.Equal(t, d("100"), matches[0].Price)
+		}
+		assert.NoError(t, checker.SaveTradingHalts(ctx))
+		if assert.Len(t, ex.halts.created, 1) {
+			halt := ex.halts.created[0]
+			assert.Equal(t, d("100"), halt.ReferencePrice)
+			assert.Equal(t, d("110"), halt.TriggerPrice)
+			assert.Equal(t, start, halt.HaltedAt)
+			assert.Equal(t, start.Add(300*time.Second), halt.ResumesAt)
+		}
+
+		ex.now = start.Add(time.Minute)
+		matches, err = checker.MatchOrder(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, matches)
+	})
+
+	t.Run("The halt resumes through a reopening auction", func(t *testing.T) {
+		assert.NoError(t, checker.ResumeHalts(ctx, start.Add(299*time.Second)))
+		assert.Empty(t, ex.halts.resumed)
+
+		reopen := start.Add(300 * time.Second)
+		assert.NoError(t, checker.ResumeHalts(ctx, reopen))
+		assert.Len(t, ex.halts.resumed, 1)
+		if assert.Len(t, ex.auctions.created, 1) {
+			assert.Equal(t, reopen.Add(60*time.Second), ex.auctions.created[0].EndsAt)
+		}
+
+		ex.now = reopen
+		matches, err := checker.MatchOrder(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, matches, "the symbol only collects orders during the auction")
+
+		matches, err = checker.RunAuctions(ctx, reopen.Add(59*time.Second))
+		assert.NoError(t, err)
+		assert.Empty(t, matches)
+
+		matches, err = checker.RunAuctions(ctx, reopen.Add(60*time.Second))
+		assert.NoError(t, err)
+		if assert.Len(t, matches, 1) {
+			assert.Equal(t, d("110"), matches[0].Price)
+			assert.Equal(t, d("1"), matches[0].OrderQuantity)
+		}
+	})
+}
+
+func TestBreakerComparesWithinTheWindow(t *testing.T) {
+	rules := market()
+	rules.BreakerMove, rules.BreakerWindowSeconds, rules.BreakerCooldownSeconds = d("0.05"), 300, 300
+	first := newOrder(1, utils.SellOrder, utils.LimitOrder, "104")
+	second := newOrder(2, utils.SellOrder, utils.LimitOrder, "108")
+	bid := newOrder(3, utils.BuyOrder, utils.LimitOrder, "108")
+	bid.OrderQuantity = d("2")
+	bid.CreatedAt, bid.PriorityAt = start.Add(time.Minute), start.Add(time.Minute)
+	checker, ex := newChecker(t, rules, "100", first, second, bid)
+
+	// 108 is 8% from the last trade before the window but within 5% of 104
+	matches, err := checker.MatchOrder(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+	assert.NoError(t, checker.SaveTradingHalts(context.Background()))
+	assert.Empty(t, ex.halts.created)
+}
+
+func TestFeesAreRoundedToTheAssetPaidIn(t *testing.T) {
+	bid := newOrder(1, utils.BuyOrder, utils.LimitOrder, "100")
+	ask := newOrder(2, utils.SellOrder, utils.LimitOrder, "101")
+	checker, ex := newChecker(t, market(), "", bid, ask)
+	ex.assets.assets = []entity.Asset{{Code: "BTC", Precision: 8}, {Code: "USDT", Precision: 6}}
+	ex.fees.tiers = []entity.FeeTier{
+		{Name: "VIP0", MinVolume: d("0"), MakerRate: d("0.001"), TakerRate: d("0.002")},
+		{Name: "VIP1", MinVolume: d("1000000"), MakerRate: d("0.0005"), TakerRate: d("0.001")},
+	}
+	// the seller's volume reaches the second tier exactly
+	ex.fees.volumes[ask.UserID] = d("1000000")
+
+	match := entity.OrderMatch{ID: uuid.New(), Symbol: symbol, OrderID1: bid.ID, OrderID2: ask.ID,
+		Price: d("100.000003"), OrderQuantity: d("0.12345678"), TakerSide: utils.BuyOrder}
+	assert.NoError(t, checker.UpdateUserBalances(context.Background(), []entity.OrderMatch{match}))
+
+	if assert.Len(t, ex.charged, 1) {
+		// taker at 0.2% of 0.12345678 BTC, maker at 0.05% of 12.34567837 USDT
+		assert.Equal(t, d("0.00024691"), ex.charged[0].BuyFee)
+		assert.Equal(t, d("0.006173"), ex.charged[0].SellFee)
+	}
+	// the cost is rounded down to the six places of USDT
+	assert.Equal(t, d("-12.345678"), ex.balances.available[bid.UserID]["USDT"])
+	assert.Equal(t, d("0.12320987"), ex.balances.available[bid.UserID]["BTC"])
+	assert.Equal(t, d("12.339505"), ex.balances.available[ask.UserID]["USDT"])
+	assert.Equal(t, d("0.006173"), ex.balances.available[utils.FeeAccountID]["USDT"])
+	assert.Len(t, ex.journals.posted, 2)
+}
+
+func TestFillsSettleAtTheMakerPrice(t *testing.T) {
+	ask := newOrder(1, utils.SellOrder, utils.LimitOrder, "100")
+	bid := newOrder(2, utils.BuyOrder, utils.LimitOrder, "105")
+	bid.CreatedAt, bid.PriorityAt = start.Add(time.Minute), start.Add(time.Minute)
+	checker, ex := newChecker(t, market(), "", ask, bid)
+	ex.locks.lock(ask.ID, ask.UserID, "BTC", d("1"))
+	ex.locks.lock(bid.ID, bid.UserID, "USDT", d("105"))
+	ctx := context.Background()
+
+	matches, err := checker.MatchOrder(ctx)
+	assert.NoError(t, err)
+	if !assert.Len(t, matches, 1) {
+		return
+	}
+	assert.Equal(t, d("100"), matches[0].Price, "the resting ask sets the price")
+	assert.NoError(t, checker.UpdateUserBalances(ctx, matches))
+
+	// the buyer gets back the 5 USDT locked above the execution price
+	assert.Equal(t, d("5"), ex.balances.available[bid.UserID]["USDT"])
+	assert.Equal(t, d("1"), ex.balances.available[bid.UserID]["BTC"])
+	assert.Equal(t, d("100"), ex.balances.available[ask.UserID]["USDT"])
+	assert.True(t, ex.balances.available[ask.UserID]["BTC"].IsZero())
+	assert.Empty(t, ex.locks.held, "filled orders hold no locks")
+}
+
+func TestMarketBuyReleasesWhatItCannotSpend(t *testing.T) {
+	rules := market()
+	rules.StepSize, rules.MinQuantity = d("0.01"), d("0.05")
+	near := newOrder(1, utils.SellOrder, utils.LimitOrder, "100")
+	far := newOrder(2, utils.SellOrder, utils.LimitOrder, "101")
+	buy := newOrder(3, utils.BuyOrder, utils.MarketOrder, "110")
+	buy.OrderQuantity, buy.QuoteAmount = decimal.Zero, d("105")
+	buy.CreatedAt, buy.PriorityAt = start.Add(time.Minute), start.Add(time.Minute)
+	checker, ex := newChecker(t, rules, "", near, far, buy)
+	ex.assets.assets = []entity.Asset{{Code: "BTC", Precision: 8}, {Code: "USDT", Precision: 8}}
+	ex.locks.lock(buy.ID, buy.UserID, "USDT", d("105"))
+	ctx := context.Background()
+
+	matches, cancelled, err := checker.ExecuteImmediateOrders(ctx)
+	assert.NoError(t, err)
+	// 5 buys 0.0495 at 101, which rounds down below the minimum quantity
+	assert.Len(t, matches, 1)
+	assert.True(t, ex.open[1].OrderStatus)
+	if assert.Len(t, cancelled, 1) {
+		assert.False(t, cancelled[0].OrderStatus)
+	}
+
+	assert.NoError(t, checker.ReleaseUnfilled(ctx, cancelled))
+	assert.Equal(t, d("5"), ex.balances.available[buy.UserID]["USDT"])
+	assert.Equal(t, d("100"), ex.locks.held[buy.ID].Amount, "what the fill spends is settled with the match")
+}
+
+func TestPostOnly(t *testing.T) {
+	ask := newOrder(1, utils.SellOrder, utils.LimitOrder, "101")
+	resting := newOrder(2, utils.BuyOrder, utils.LimitOrder, "100")
+	crossing := newOrder(3, utils.BuyOrder, utils.LimitOrder, "101")
+	repriced := newOrder(4, utils.BuyOrder, utils.LimitOrder, "102")
+	repriced.RepriceOnCross = true
+	for _, order := range []*entity.Order{&resting, &crossing, &repriced} {
+		order.PostOnly = true
+	}
+	checker, ex := newChecker(t, market(), "", ask, resting, crossing, repriced)
+	ex.locks.lock(repriced.ID, repriced.UserID, "USDT", d("102"))
+	ctx := context.Background()
+
+	rejected, err := checker.PlacePostOnlyOrders(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, rejected, 1) {
+		assert.Equal(t, crossing.ID, rejected[0].ID)
+	}
+	assert.True(t, ex.open[1].OrderStatus)
+	assert.False(t, ex.open[2].OrderStatus)
+	assert.NotNil(t, ex.open[2].CompletedAt)
+	assert.True(t, ex.open[3].OrderStatus)
+	assert.Equal(t, d("100.99"), ex.open[3].OrderPrice, "one tick under the best ask")
+	assert.Len(t, ex.updated, 2)
+	// the buyer gets back what they locked above the new price
+	assert.Equal(t, d("1.01"), ex.balances.available[repriced.UserID]["USDT"])
+	assert.Equal(t, d("100.99"), ex.locks.held[repriced.ID].Amount)
+
+	t.Run("Post-only orders never take liquidity", func(t *testing.T) {
+		matches, err := checker.MatchOrder(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, matches)
+	})
+}
+
+func TestAmendBetweenSyncAndWrite(t *testing.T) {
+	ask := newOrder(1, utils.SellOrder, utils.LimitOrder, "100")
+	ask.OrderQuantity = d("2")
+	bid := newOrder(2, utils.BuyOrder, utils.LimitOrder, "100")
+	checker, ex := newChecker(t, market(), "", ask, bid)
+	ctx := context.Background()
+
+	// the owner amends the ask after the checker synced it
+	ex.versions[ask.ID]++
+	_, err := checker.MatchOrder(ctx)
+	assert.ErrorIs(t, err, repository.ErrOrderChanged)
+	assert.Empty(t, ex.updated)
+	assert.Empty(t, ex.matches)
+
+	t.Run("The reloaded book matches the amended order", func(t *testing.T) {
+		amended := ask
+		amended.OrderQuantity, amended.Version = d("3"), 1
+		checker, ex := newChecker(t, market(), "", amended, bid)
+		ex.versions[amended.ID] = 1
+
+		matches, err := checker.MatchOrder(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, matches, 1)
+		assert.Equal(t, d("2"), ex.open[0].OrderQuantity)
+		assert.Equal(t, int64(2), ex.versions[amended.ID])
+		assert.Equal(t, ex.versions[amended.ID], ex.open[0].Version)
+	})
+}
+
+func TestOcoFillCancelsTheOtherLeg(t *testing.T) {
+	group := uuid.New()
+	takeProfit := newOrder(1, utils.SellOrder, utils.LimitOrder, "110")
+	stopLoss := newOrder(2, utils.SellOrder, utils.StopLimitOrder, "90")
+	stopLoss.TriggerPrice, stopLoss.OrderQuantity = d("91"), d("2")
+	for _, leg := range []*entity.Order{&takeProfit, &stopLoss} {
+		leg.UserID, leg.OcoGroupID = takeProfit.UserID, &group
+	}
+	bid := newOrder(3, utils.BuyOrder, utils.LimitOrder, "110")
+	bid.CreatedAt = start.Add(time.Minute)
+	checker, ex := newChecker(t, market(), "", takeProfit, stopLoss, bid)
+	// one lock, taken for the group, covers the larger leg
+	ex.locks.lock(group, takeProfit.UserID, "BTC", d("2"))
+	ctx := context.Background()
+
+	matches, err := checker.MatchOrder(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.NoError(t, checker.SettleCancellations(ctx))
+	assert.False(t, ex.open[1].OrderStatus)
+	assert.Contains(t, ex.updated, &ex.open[1])
+	// the stop-loss needed one more BTC than the filled take-profit
+	assert.Equal(t, d("1"), ex.locks.held[group].Amount)
+	assert.Equal(t, d("1"), ex.balances.available[takeProfit.UserID]["BTC"])
+
+	t.Run("The cancelled leg no longer triggers", func(t *testing.T) {
+		triggered, err := checker.TriggerStopOrders(ctx, []entity.OrderMatch{{Symbol: symbol, Price: d("90")}})
+		assert.NoError(t, err)
+		assert.False(t, triggered)
+	})
+}
+
+func TestSelfTradePreventionOnTheBook(t *testing.T) {
+	cases := []struct {
+		mode             string
+		askOpen, bidOpen bool
+		askQuantity      string
+	}{
+		{utils.CancelNewest, true, false, "2"},
+		{utils.CancelOldest, false, true, "2"},
+		{utils.CancelBoth, false, false, "2"},
+		{utils.DecrementBoth, true, false, "1"},
+	}
+	for _, c := range cases {
+		t.Run(c.mode, func(t *testing.T) {
+			ask := newOrder(1, utils.SellOrder, utils.LimitOrder, "100")
+			ask.OrderQuantity = d("2")
+			bid := newOrder(2, utils.BuyOrder, utils.LimitOrder, "100")
+			bid.UserID, bid.SelfTradePrevention = ask.UserID, c.mode
+			bid.CreatedAt, bid.PriorityAt = start.Add(time.Minute), start.Add(time.Minute)
+			checker, ex := newChecker(t, market(), "", ask, bid)
+			ex.locks.lock(ask.ID, ask.UserID, "BTC", d("2"))
+			ex.locks.lock(bid.ID, bid.UserID, "USDT", d("100"))
+			ctx := context.Background()
+
+			matches, err := checker.MatchOrder(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, matches)
+			assert.NoError(t, checker.SettleCancellations(ctx))
+			assert.Equal(t, c.askOpen, ex.open[0].OrderStatus)
+			assert.Equal(t, d(c.askQuantity), ex.open[0].OrderQuantity)
+			assert.Equal(t, c.bidOpen, ex.open[1].OrderStatus)
+
+			assert.NoError(t, checker.SaveSelfTradeEvents(ctx))
+			if assert.Len(t, ex.prevented, 1) {
+				event := ex.prevented[0]
+				assert.Equal(t, c.mode, event.Mode)
+				assert.Equal(t, bid.ID, event.TakerOrderID)
+				assert.Equal(t, ask.ID, event.MakerOrderID)
+				assert.Equal(t, d("1"), event.Quantity)
+				assert.NotEmpty(t, event.Reason)
+				assert.Equal(t, start, event.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestTrailingStops(t *testing.T) {
+	trades := func(prices ...string) []entity.OrderMatch {
+		matches := make([]entity.OrderMatch, 0, len(prices))
+		for _, price := range prices {
+			matches = append(matches, entity.OrderMatch{Symbol: symbol, Price: d(price)})
+		}
+		return matches
+	}
+	ctx := context.Background()
+
+	t.Run("A sell trails rising trades by a fixed amount", func(t *testing.T) {
+		stop := newOrder(1, utils.SellOrder, utils.TrailingStop, "76")
+		stop.TrailingAmount, stop.TriggerPrice = d("5"), d("95")
+		checker, ex := newChecker(t, market(), "", stop)
+
+		triggered, err := checker.TriggerStopOrders(ctx, trades("100", "104", "102"))
+		assert.NoError(t, err)
+		assert.False(t, triggered)
+		assert.Equal(t, d("99"), ex.open[0].TriggerPrice)
+		// the slippage cap keeps its distance from the trigger
+		assert.Equal(t, d("79.2"), ex.open[0].OrderPrice)
+		assert.Len(t, ex.updated, 1)
+
+		triggered, err = checker.TriggerStopOrders(ctx, trades("98"))
+		assert.NoError(t, err)
+		assert.True(t, triggered)
+		assert.Equal(t, utils.MarketOrder, ex.open[0].Kind)
+		assert.Equal(t, start, *ex.open[0].TriggeredAt)
+		assert.Equal(t, d("99"), ex.open[0].TriggerPrice)
+	})
+
+	t.Run("A buy trails falling trades by a percentage", func(t *testing.T) {
+		stop := newOrder(1, utils.BuyOrder, utils.TrailingStop, "102")
+		stop.TrailingPercent, stop.TriggerPrice = d("2"), d("102")
+		checker, ex := newChecker(t, market(), "", stop)
+
+		triggered, err := checker.TriggerStopOrders(ctx, trades("98", "95", "96"))
+		assert.NoError(t, err)
+		assert.False(t, triggered)
+		assert.Equal(t, d("96.9"), ex.open[0].TriggerPrice)
+
+		triggered, err = checker.TriggerStopOrders(ctx, trades("96.5"))
+		assert.NoError(t, err)
+		assert.False(t, triggered)
+		assert.Equal(t, d("96.9"), ex.open[0].TriggerPrice, "the trigger never moves against the order")
+
+		triggered, err = checker.TriggerStopOrders(ctx, trades("96.9"))
+		assert.NoError(t, err)
+		assert.True(t, triggered)
+		assert.Equal(t, utils.MarketOrder, ex.open[0].Kind)
+	})
+}
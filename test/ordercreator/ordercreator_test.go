@@ -0,0 +1,716 @@
+package ordercreator
+
+import (
+	"bitcoinOrder/internal/app/ordercreator/service"
+	"bitcoinOrder/internal/common/dto"
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/ledger"
+	"bitcoinOrder/pkg/utils"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"sort"
+	"testing"
+	"time"
+)
+
+const symbol = "BTCUSDT"
+
+var d = decimal.RequireFromString
+
+// noTx is a database driver whose transactions do nothing, so the service
+// can begin and commit them while every query goes to the fakes below.
+type noTx struct{}
+
+func (noTx) Open(string) (driver.Conn, error)                             { return noTx{}, nil }
+func (noTx) Prepare(string) (driver.Stmt, error)                          { return nil, errors.New("no database") }
+func (noTx) Close() error                                                 { return nil }
+func (noTx) Begin() (driver.Tx, error)                                    { return noTx{}, nil }
+func (noTx) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) { return noTx{}, nil }
+func (noTx) Commit() error                                                { return nil }
+func (noTx) Rollback() error                                              { return nil }
+
+func init() {
+	sql.Register("notx", noTx{})
+}
+
+// orders keeps every order by its ID, cancelled ones included. Methods the
+// tests do not reach are left to the nil interface.
+type orders struct {
+	repository.IOrderRepository
+	orders map[uuid.UUID]entity.Order
+	// bestPrices is the best price resting on each side of the book
+	bestPrices map[string]decimal.Decimal
+}
+
+func (r *orders) CreateOrder(_ context.Context, newOrder entity.Order) (entity.Order, error) {
+	r.orders[newOrder.ID] = newOrder
+	return newOrder, nil
+}
+
+func (r *orders) SoftDeleteOrder(_ context.Context, orderID uuid.UUID) error {
+	order := r.orders[orderID]
+	order.DeletedAt.Time, order.DeletedAt.Valid = time.Now(), true
+	r.orders[orderID] = order
+	return nil
+}
+
+func (r *orders) FindBestPrice(_ context.Context, _ string, orderType string) (decimal.Decimal, bool, error) {
+	price, ok := r.bestPrices[orderType]
+	return price, ok, nil
+}
+
+func (r *orders) FindLastTradePrice(context.Context, string) (decimal.Decimal, bool, error) {
+	return decimal.Zero, false, nil
+}
+
+func (r *orders) FindOrderForUpdate(_ context.Context, orderID uuid.UUID) (entity.Order, error) {
+	if order, ok := r.orders[orderID]; ok {
+		return order, nil
+	}
+	return entity.Order{}, repository.ErrOrderNotFound
+}
+
+func (r *orders) FindOrdersByOcoGroup(_ context.Context, groupID uuid.UUID) ([]entity.Order, error) {
+	var group []entity.Order
+	for _, order := range r.sorted() {
+		if order.OcoGroupID != nil && *order.OcoGroupID == groupID {
+			group = append(group, order)
+		}
+	}
+	return group, nil
+}
+
+func (r *orders) FindOpenOrdersForUpdate(_ context.Context, userID uuid.UUID, symbol, orderType string) ([]entity.Order, error) {
+	var open []entity.Order
+	for _, order := range r.sorted() {
+		if order.UserID == userID && isOpen(order) &&
+			(symbol == "" || order.Asset == symbol) && (orderType == "" || order.Type == orderType) {
+			open = append(open, order)
+		}
+	}
+	return open, nil
+}
+
+// sorted returns the orders oldest first, as the table returns them.
+func (r *orders) sorted() []entity.Order {
+	var all []entity.Order
+	for _, order := range r.orders {
+		all = append(all, order)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].CreatedAt.Before(all[j].CreatedAt) })
+	return all
+}
+
+func isOpen(order entity.Order) bool {
+	return order.OrderStatus && !order.DeletedAt.Valid
+}
+
+type users struct {
+	repository.IUserRepository
+	users map[uuid.UUID]entity.Users
+}
+
+func (r *users) CreateUser(_ context.Context, user entity.Users) (entity.Users, error) {
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *users) FindUser(_ context.Context, id uuid.UUID) (entity.Users, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return entity.Users{}, fmt.Errorf("user %s not found", id)
+}
+
+// locks keeps locks by their own ID, pooled legacy locks included.
+type locks struct {
+	repository.ILockRepository
+	held map[uuid.UUID]entity.Lock
+}
+
+func (r *locks) CreateLock(_ context.Context, lock entity.Lock) error {
+	lock.ID = uuid.New()
+	r.held[lock.ID] = lock
+	return nil
+}
+
+func (r *locks) FindLock(_ context.Context, orderID uuid.UUID) (entity.Lock, error) {
+	for _, lock := range r.held {
+		if lock.OrderID != nil && *lock.OrderID == orderID {
+			return lock, nil
+		}
+	}
+	return entity.Lock{}, repository.ErrLockNotFound
+}
+
+func (r *locks) FindLegacyLocks(context.Context) ([]entity.Lock, error) {
+	var legacy []entity.Lock
+	for _, lock := range r.held {
+		if lock.OrderID == nil {
+			legacy = append(legacy, lock)
+		}
+	}
+	return legacy, nil
+}
+
+func (r *locks) DeleteLock(_ context.Context, lockID uuid.UUID) error {
+	delete(r.held, lockID)
+	return nil
+}
+
+func (r *locks) UpdateLockAmount(_ context.Context, lockID uuid.UUID, amount decimal.Decimal) error {
+	lock := r.held[lockID]
+	lock.Amount = lock.Amount.Sub(amount)
+	r.held[lockID] = lock
+	return nil
+}
+
+// amount is what the lock kept under lockID holds, or zero without one.
+func (r *locks) amount(lockID uuid.UUID) decimal.Decimal {
+	lock, err := r.FindLock(context.Background(), lockID)
+	if err != nil {
+		return decimal.Zero
+	}
+	return lock.Amount
+}
+
+// balances keeps each user's available and locked balance per asset and,
+// like the balances table, refuses to take either below zero.
+type balances struct {
+	repository.IBalanceRepository
+	available map[uuid.UUID]map[string]decimal.Decimal
+	locked    map[uuid.UUID]map[string]decimal.Decimal
+}
+
+func (r *balances) GetAvailable(_ context.Context, userID uuid.UUID, asset string) (decimal.Decimal, error) {
+	return r.available[userID][asset], nil
+}
+
+func (r *balances) Credit(_ context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	return r.move(userID, asset, amount, decimal.Zero)
+}
+
+func (r *balances) Debit(_ context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	return r.move(userID, asset, amount.Neg(), decimal.Zero)
+}
+
+func (r *balances) Lock(_ context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	return r.move(userID, asset, amount.Neg(), amount)
+}
+
+func (r *balances) Unlock(_ context.Context, userID uuid.UUID, asset string, amount decimal.Decimal) error {
+	return r.move(userID, asset, amount, amount.Neg())
+}
+
+func (r *balances) move(userID uuid.UUID, asset string, available, locked decimal.Decimal) error {
+	if r.available[userID] == nil {
+		r.available[userID] = make(map[string]decimal.Decimal)
+		r.locked[userID] = make(map[string]decimal.Decimal)
+	}
+	newAvailable, newLocked := r.available[userID][asset].Add(available), r.locked[userID][asset].Add(locked)
+	if newAvailable.IsNegative() || newLocked.IsNegative() {
+		return fmt.Errorf("%w: %s of user %s", repository.ErrNegativeBalance, asset, userID)
+	}
+	r.available[userID][asset], r.locked[userID][asset] = newAvailable, newLocked
+	return nil
+}
+
+type assets struct {
+	repository.IAssetRepository
+	assets []entity.Asset
+}
+
+func (r *assets) CreateAsset(_ context.Context, asset entity.Asset) (entity.Asset, error) {
+	r.assets = append(r.assets, asset)
+	return asset, nil
+}
+
+func (r *assets) FindAsset(_ context.Context, code string) (entity.Asset, error) {
+	for _, asset := range r.assets {
+		if asset.Code == code {
+			return asset, nil
+		}
+	}
+	return entity.Asset{}, fmt.Errorf("%w: %s", repository.ErrAssetNotFound, code)
+}
+
+type symbols struct {
+	repository.ISymbolRepository
+	symbols []entity.Symbol
+}
+
+func (r *symbols) FindSymbol(_ context.Context, name string) (entity.Symbol, error) {
+	for _, symbol := range r.symbols {
+		if symbol.Name == name {
+			return symbol, nil
+		}
+	}
+	return entity.Symbol{}, fmt.Errorf("%w: %s", repository.ErrSymbolNotFound, name)
+}
+
+// heartbeats keeps the armed dead-man's switch of each user.
+type heartbeats struct {
+	repository.IHeartbeatRepository
+	armed map[uuid.UUID]entity.Heartbeat
+}
+
+func (r *heartbeats) SaveHeartbeat(_ context.Context, heartbeat entity.Heartbeat) error {
+	r.armed[heartbeat.UserID] = heartbeat
+	return nil
+}
+
+func (r *heartbeats) DeleteHeartbeat(_ context.Context, userID uuid.UUID) error {
+	delete(r.armed, userID)
+	return nil
+}
+
+// journals refuses a journal whose entries do not balance.
+type journals struct {
+	repository.ILedgerRepository
+	posted []*ledger.Journal
+}
+
+func (r *journals) PostJournal(_ context.Context, journal *ledger.Journal) error {
+	if err := journal.Validate(); err != nil {
+		return err
+	}
+	r.posted = append(r.posted, journal)
+	return nil
+}
+
+// exchange is what an order creator runs against.
+type exchange struct {
+	*orders
+	users      *users
+	locks      *locks
+	balances   *balances
+	assets     *assets
+	symbols    *symbols
+	heartbeats *heartbeats
+	journals   *journals
+}
+
+func market() entity.Symbol {
+	return entity.Symbol{Name: symbol, BaseAsset: "BTC", QuoteAsset: "USDT", Status: utils.SymbolOpen,
+		TickSize: d("0.01"), StepSize: d("0.00001"), MinQuantity: d("0.00001"), MaxQuantity: d("9000"), MinNotional: d("5")}
+}
+
+func registry() []entity.Asset {
+	return []entity.Asset{
+		{Code: "BTC", Precision: 8, MinDeposit: d("0.0001"), DepositEnabled: true, WithdrawEnabled: true, TradeEnabled: true},
+		{Code: "USDT", Precision: 6, MinDeposit: d("1"), DepositEnabled: true, WithdrawEnabled: true, TradeEnabled: true},
+	}
+}
+
+// newCreator returns an order creator for the BTCUSDT market and its assets,
+// with no users, orders or balances yet.
+func newCreator(t *testing.T) (*service.OrderCreatorService, *exchange) {
+	db, err := sql.Open("notx", "")
+	require.NoError(t, err)
+	ex := &exchange{
+		orders:     &orders{orders: map[uuid.UUID]entity.Order{}, bestPrices: map[string]decimal.Decimal{}},
+		users:      &users{users: map[uuid.UUID]entity.Users{}},
+		locks:      &locks{held: map[uuid.UUID]entity.Lock{}},
+		balances:   &balances{available: map[uuid.UUID]map[string]decimal.Decimal{}, locked: map[uuid.UUID]map[string]decimal.Decimal{}},
+		assets:     &assets{assets: registry()},
+		symbols:    &symbols{symbols: []entity.Symbol{market()}},
+		heartbeats: &heartbeats{armed: map[uuid.UUID]entity.Heartbeat{}},
+		journals:   &journals{},
+	}
+	creator := service.NewOrderCreatorService(ex.orders, ex.users, ex.locks, ex.balances, ex.assets, ex.symbols,
+		nil, ex.heartbeats, ex.journals, nil, db)
+	return creator, ex
+}
+
+// user registers a user holding the given available balances, such as
+// "USDT", "1000".
+func (ex *exchange) user(holdings ...string) uuid.UUID {
+	user := entity.Users{ID: uuid.New()}
+	ex.users.users[user.ID] = user
+	for i := 0; i+1 < len(holdings); i += 2 {
+		_ = ex.balances.Credit(context.Background(), user.ID, holdings[i], d(holdings[i+1]))
+	}
+	return user.ID
+}
+
+// restingOrder stores an open limit order of the user, placed after every
+// order stored before it.
+func (ex *exchange) restingOrder(userID uuid.UUID, side, price, quantity string) entity.Order {
+	order := entity.Order{
+		ID:            uuid.New(),
+		UserID:        userID,
+		Asset:         symbol,
+		Kind:          utils.LimitOrder,
+		TimeInForce:   utils.GoodTillCancel,
+		Type:          side,
+		OrderPrice:    d(price),
+		OrderQuantity: d(quantity),
+		OrderStatus:   true,
+		CreatedAt:     time.Unix(int64(len(ex.orders.orders)), 0),
+	}
+	ex.orders.orders[order.ID] = order
+	return order
+}
+
+// legacyLock stores a lock pooling the funds of all the user's orders in an
+// asset, as locks were taken before they were per order.
+func (ex *exchange) legacyLock(userID uuid.UUID, asset, amount string) {
+	lock := entity.Lock{ID: uuid.New(), UserID: userID, Asset: asset, Amount: d(amount)}
+	ex.locks.held[lock.ID] = lock
+}
+
+func TestLegacyLocksAreSplitPerOrder(t *testing.T) {
+	creator, ex := newCreator(t)
+	userID := ex.user()
+	// the pooled amounts were locked out of the available balance
+	require.NoError(t, ex.balances.move(userID, "USDT", decimal.Zero, d("300")))
+	require.NoError(t, ex.balances.move(userID, "BTC", decimal.Zero, d("0.5")))
+	ex.legacyLock(userID, "usdt", "300")
+	ex.legacyLock(userID, "BTC", "0.5")
+
+	first := ex.restingOrder(userID, utils.BuyOrder, "100", "1")
+	second := ex.restingOrder(userID, utils.BuyOrder, "50.5", "2")
+	group := uuid.New()
+	for _, price := range []string{"120", "90"} {
+		leg := ex.restingOrder(userID, utils.SellOrder, price, "0.5")
+		leg.OcoGroupID = &group
+		ex.orders.orders[leg.ID] = leg
+	}
+
+	require.NoError(t, creator.MigrateLegacyLocks(context.Background()))
+
+	legacy, err := ex.locks.FindLegacyLocks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, legacy, "the pooled locks are released")
+	assert.Len(t, ex.locks.held, 3, "one lock per order and one for the OCO pair")
+	assert.Equal(t, "100", ex.locks.amount(first.ID).String())
+	assert.Equal(t, "101", ex.locks.amount(second.ID).String())
+	assert.Equal(t, "0.5", ex.locks.amount(group).String())
+
+	assert.Equal(t, "99", ex.balances.available[userID]["USDT"].String(), "what no order needs becomes available")
+	assert.Equal(t, "201", ex.balances.locked[userID]["USDT"].String())
+	assert.True(t, ex.balances.available[userID]["BTC"].IsZero())
+	assert.Equal(t, "0.5", ex.balances.locked[userID]["BTC"].String())
+
+	t.Run("a second run changes nothing", func(t *testing.T) {
+		posted := len(ex.journals.posted)
+		require.NoError(t, creator.MigrateLegacyLocks(context.Background()))
+		assert.Len(t, ex.locks.held, 3)
+		assert.Len(t, ex.journals.posted, posted)
+	})
+}
+
+func TestLegacyLocksSkipOrdersTheUserCannotCover(t *testing.T) {
+	creator, ex := newCreator(t)
+	userID := ex.user()
+	require.NoError(t, ex.balances.move(userID, "USDT", decimal.Zero, d("100")))
+	ex.legacyLock(userID, "USDT", "100")
+	// the pool covers either order but not both
+	first := ex.restingOrder(userID, utils.BuyOrder, "80", "1")
+	second := ex.restingOrder(userID, utils.BuyOrder, "60", "1")
+
+	var logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logged)
+	require.NoError(t, creator.MigrateLegacyLocks(context.Background()))
+
+	assert.Len(t, ex.locks.held, 1, "only one order is locked")
+	locked := ex.locks.amount(first.ID).Add(ex.locks.amount(second.ID))
+	assert.Equal(t, locked.String(), ex.balances.locked[userID]["USDT"].String())
+	assert.Equal(t, d("100").Sub(locked).String(), ex.balances.available[userID]["USDT"].String())
+	assert.Contains(t, logged.String(), "could not lock")
+	assert.Contains(t, logged.String(), userID.String())
+}
+
+func TestTradingRules(t *testing.T) {
+	creator, ex := newCreator(t)
+	rules := market()
+	rules.StepSize, rules.MinQuantity, rules.MaxQuantity, rules.MinNotional = d("0.0001"), d("0.001"), d("100"), d("10")
+	ex.symbols.symbols = []entity.Symbol{rules}
+	ex.bestPrices[utils.SellOrder], ex.bestPrices[utils.BuyOrder] = d("100"), d("99")
+	userID := ex.user("USDT", "100000", "BTC", "1000")
+
+	cases := []struct {
+		name  string
+		order dto.OrderDto
+		err   error
+	}{
+		{"within every rule", dto.OrderDto{Type: utils.BuyOrder, OrderPrice: d("100.01"), OrderQuantity: d("0.1")}, nil},
+		{"price off the tick", dto.OrderDto{Type: utils.BuyOrder, OrderPrice: d("100.005"), OrderQuantity: d("1")}, service.ErrPriceTick},
+		{"quantity off the step", dto.OrderDto{Type: utils.SellOrder, OrderPrice: d("100"), OrderQuantity: d("0.10005")}, service.ErrQuantityStep},
+		{"quantity below the minimum", dto.OrderDto{Type: utils.SellOrder, OrderPrice: d("50000"), OrderQuantity: d("0.0005")}, service.ErrMinQuantity},
+		{"quantity above the maximum", dto.OrderDto{Type: utils.SellOrder, OrderPrice: d("100"), OrderQuantity: d("100.0001")}, service.ErrMaxQuantity},
+		{"value below the minimum notional", dto.OrderDto{Type: utils.BuyOrder, OrderPrice: d("99.99"), OrderQuantity: d("0.1")}, service.ErrMinNotional},
+		{"trigger price off the tick", dto.OrderDto{Type: utils.SellOrder, Kind: utils.StopLimitOrder, OrderPrice: d("90"),
+			OrderQuantity: d("1"), TriggerPrice: d("90.001")}, service.ErrPriceTick},
+		{"display quantity off the step", dto.OrderDto{Type: utils.SellOrder, OrderPrice: d("100"), OrderQuantity: d("1"),
+			DisplayQuantity: d("0.00001")}, service.ErrQuantityStep},
+		{"market buy below the minimum notional", dto.OrderDto{Type: utils.BuyOrder, Kind: utils.MarketOrder,
+			QuoteAmount: d("9.99")}, service.ErrMinNotional},
+		{"market sell worth less than the minimum notional", dto.OrderDto{Type: utils.SellOrder, Kind: utils.MarketOrder,
+			OrderQuantity: d("0.1")}, service.ErrMinNotional},
+		{"market sell worth the minimum notional", dto.OrderDto{Type: utils.SellOrder, Kind: utils.MarketOrder,
+			OrderQuantity: d("0.1011")}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.order.Asset, c.order.UserID, c.order.OrderStatus = symbol, userID, true
+			held := len(ex.locks.held)
+
+			_, err := creator.CreateOrder(c.order)
+			if c.err == nil {
+				assert.NoError(t, err)
+				assert.Len(t, ex.locks.held, held+1)
+				return
+			}
+			assert.ErrorIs(t, err, c.err)
+			assert.ErrorIs(t, err, service.ErrTradingRule)
+			assert.Len(t, ex.locks.held, held, "a rejected order locks nothing")
+		})
+	}
+
+	t.Run("a rule set to zero is not enforced", func(t *testing.T) {
+		ex.symbols.symbols[0].StepSize, ex.symbols.symbols[0].MinNotional = decimal.Zero, decimal.Zero
+		_, err := creator.CreateOrder(dto.OrderDto{Asset: symbol, UserID: userID, OrderStatus: true, Type: utils.BuyOrder,
+			OrderPrice: d("1"), OrderQuantity: d("0.00123456")})
+		assert.NoError(t, err)
+	})
+}
+
+func TestCancelOrder(t *testing.T) {
+	creator, ex := newCreator(t)
+	userID := ex.user("USDT", "1000", "BTC", "2")
+	ctx := context.Background()
+
+	orderID, err := creator.CreateOrder(dto.OrderDto{Asset: symbol, UserID: userID, OrderStatus: true,
+		Type: utils.BuyOrder, OrderPrice: d("100"), OrderQuantity: d("3")})
+	require.NoError(t, err)
+	// a fill of one already spent its share of the lock
+	order := ex.orders.orders[orderID]
+	order.OrderQuantity = d("2")
+	ex.orders.orders[orderID] = order
+	lock, err := ex.locks.FindLock(ctx, orderID)
+	require.NoError(t, err)
+	require.NoError(t, ex.locks.UpdateLockAmount(ctx, lock.ID, d("100")))
+	require.NoError(t, ex.balances.move(userID, "USDT", decimal.Zero, d("-100")))
+
+	require.NoError(t, creator.CancelOrder(ctx, orderID))
+	assert.True(t, ex.orders.orders[orderID].DeletedAt.Valid)
+	assert.Empty(t, ex.locks.held, "what is left of the lock is released")
+	assert.Equal(t, "900", ex.balances.available[userID]["USDT"].String())
+	assert.True(t, ex.balances.locked[userID]["USDT"].IsZero())
+
+	t.Run("a cancelled order cannot be cancelled again", func(t *testing.T) {
+		assert.ErrorIs(t, creator.CancelOrder(ctx, orderID), service.ErrOrderNotCancellable)
+	})
+
+	t.Run("a filled order cannot be cancelled", func(t *testing.T) {
+		filled := ex.restingOrder(userID, utils.SellOrder, "100", "1")
+		filled.OrderStatus = false
+		ex.orders.orders[filled.ID] = filled
+		assert.ErrorIs(t, creator.CancelOrder(ctx, filled.ID), service.ErrOrderNotCancellable)
+	})
+
+	t.Run("an unknown order is not found", func(t *testing.T) {
+		assert.ErrorIs(t, creator.CancelOrder(ctx, uuid.New()), repository.ErrOrderNotFound)
+	})
+}
+
+func TestCancellingOneOcoLegCancelsThePair(t *testing.T) {
+	creator, ex := newCreator(t)
+	userID := ex.user("BTC", "2")
+	ctx := context.Background()
+
+	groupID, err := creator.CreateOcoOrder(dto.OcoOrderDto{Asset: symbol, UserID: userID, Type: utils.SellOrder,
+		TakeProfit: dto.OrderDto{OrderPrice: d("110"), OrderQuantity: d("1")},
+		StopLoss:   dto.OrderDto{Kind: utils.StopLimitOrder, OrderPrice: d("90"), TriggerPrice: d("91"), OrderQuantity: d("1")}})
+	require.NoError(t, err)
+	legs, err := ex.orders.FindOrdersByOcoGroup(ctx, groupID)
+	require.NoError(t, err)
+	require.Len(t, legs, 2)
+	assert.Equal(t, "1", ex.locks.amount(groupID).String(), "the legs share one lock")
+
+	require.NoError(t, creator.CancelOrder(ctx, legs[0].ID))
+	for _, leg := range legs {
+		assert.True(t, ex.orders.orders[leg.ID].DeletedAt.Valid)
+	}
+	assert.Empty(t, ex.locks.held)
+	assert.Equal(t, "2", ex.balances.available[userID]["BTC"].String())
+	assert.ErrorIs(t, creator.CancelOrder(ctx, legs[1].ID), service.ErrOrderNotCancellable)
+}
+
+func TestCancelAllOrders(t *testing.T) {
+	cases := []struct {
+		name      string
+		filter    dto.CancelAllDto
+		cancelled []int
+	}{
+		{"every open order", dto.CancelAllDto{}, []int{0, 1, 2}},
+		{"one symbol", dto.CancelAllDto{Symbol: "ETHUSDT"}, []int{2}},
+		{"one side", dto.CancelAllDto{Side: utils.SellOrder}, []int{1, 2}},
+		{"one side of one symbol", dto.CancelAllDto{Symbol: symbol, Side: utils.BuyOrder}, []int{0}},
+		{"nothing matches", dto.CancelAllDto{Symbol: "ETHBTC"}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			creator, ex := newCreator(t)
+			userID, otherID := ex.user(), ex.user()
+			placed := []entity.Order{
+				ex.restingOrder(userID, utils.BuyOrder, "100", "1"),
+				ex.restingOrder(userID, utils.SellOrder, "110", "1"),
+				ex.restingOrder(userID, utils.SellOrder, "3000", "1"),
+			}
+			placed[2].Asset = "ETHUSDT"
+			ex.orders.orders[placed[2].ID] = placed[2]
+			other := ex.restingOrder(otherID, utils.BuyOrder, "100", "1")
+
+			count, err := creator.CancelAllOrders(context.Background(), userID, c.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, len(c.cancelled), count)
+			var cancelled []int
+			for i, order := range placed {
+				if ex.orders.orders[order.ID].DeletedAt.Valid {
+					cancelled = append(cancelled, i)
+				}
+			}
+			assert.Equal(t, c.cancelled, cancelled)
+			assert.False(t, ex.orders.orders[other.ID].DeletedAt.Valid, "other users' orders are never touched")
+		})
+	}
+
+	t.Run("an unknown side is rejected", func(t *testing.T) {
+		creator, ex := newCreator(t)
+		_, err := creator.CancelAllOrders(context.Background(), ex.user(), dto.CancelAllDto{Side: "hold"})
+		assert.Error(t, err)
+	})
+}
+
+func TestHeartbeat(t *testing.T) {
+	creator, ex := newCreator(t)
+	userID := ex.user()
+	ctx := context.Background()
+
+	before := time.Now()
+	heartbeat, err := creator.Heartbeat(ctx, userID, dto.HeartbeatDto{TimeoutSeconds: 30})
+	require.NoError(t, err)
+	assert.Contains(t, ex.heartbeats.armed, userID)
+	assert.False(t, heartbeat.ExpiresAt.Before(before.Add(30*time.Second)))
+
+	_, err = creator.Heartbeat(ctx, userID, dto.HeartbeatDto{TimeoutSeconds: -1})
+	assert.ErrorIs(t, err, service.ErrInvalidHeartbeatTimeout)
+	assert.Contains(t, ex.heartbeats.armed, userID)
+
+	_, err = creator.Heartbeat(ctx, userID, dto.HeartbeatDto{TimeoutSeconds: 0})
+	require.NoError(t, err)
+	assert.NotContains(t, ex.heartbeats.armed, userID, "a zero timeout turns the switch off")
+}
+
+func TestCreateAsset(t *testing.T) {
+	valid := dto.AssetDto{Code: "SOL", Name: "Solana", Precision: 8, MinDeposit: d("0.01"), MinWithdrawal: d("0.1"),
+		DepositEnabled: true, WithdrawEnabled: true, TradeEnabled: true}
+	cases := []struct {
+		name   string
+		change func(asset *dto.AssetDto)
+	}{
+		{"lower case code", func(asset *dto.AssetDto) { asset.Code = "sol" }},
+		{"one letter code", func(asset *dto.AssetDto) { asset.Code = "S" }},
+		{"code longer than 10", func(asset *dto.AssetDto) { asset.Code = "SOLANATOKEN" }},
+		{"code with a dash", func(asset *dto.AssetDto) { asset.Code = "SO-L" }},
+		{"no name", func(asset *dto.AssetDto) { asset.Name = " " }},
+		{"negative precision", func(asset *dto.AssetDto) { asset.Precision = -1 }},
+		{"precision above 8", func(asset *dto.AssetDto) { asset.Precision = 9 }},
+		{"minimum deposit finer than the precision", func(asset *dto.AssetDto) {
+			asset.Precision, asset.MinDeposit = 2, d("0.001")
+		}},
+		{"negative minimum withdrawal", func(asset *dto.AssetDto) { asset.MinWithdrawal = d("-1") }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			creator, ex := newCreator(t)
+			asset := valid
+			c.change(&asset)
+
+			_, err := creator.CreateAsset(context.Background(), asset)
+			assert.ErrorIs(t, err, service.ErrInvalidAsset)
+			assert.Len(t, ex.assets.assets, len(registry()))
+		})
+	}
+
+	t.Run("a valid asset is registered", func(t *testing.T) {
+		creator, ex := newCreator(t)
+		asset, err := creator.CreateAsset(context.Background(), valid)
+		require.NoError(t, err)
+		assert.Equal(t, "SOL", asset.Code)
+		assert.Equal(t, int32(8), asset.Precision)
+		assert.Len(t, ex.assets.assets, len(registry())+1)
+	})
+}
+
+func TestDisabledAssets(t *testing.T) {
+	t.Run("trading disabled blocks orders", func(t *testing.T) {
+		creator, ex := newCreator(t)
+		userID := ex.user("USDT", "1000")
+		ex.assets.assets[1].TradeEnabled = false
+
+		_, err := creator.CreateOrder(dto.OrderDto{Asset: symbol, UserID: userID, OrderStatus: true,
+			Type: utils.BuyOrder, OrderPrice: d("100"), OrderQuantity: d("1")})
+		assert.ErrorIs(t, err, service.ErrAssetDisabled)
+		assert.Empty(t, ex.locks.held)
+	})
+
+	t.Run("deposits disabled block deposits", func(t *testing.T) {
+		creator, ex := newCreator(t)
+		userID := ex.user()
+		ex.assets.assets[0].DepositEnabled = false
+
+		err := creator.AddBalance(context.Background(), dto.BalanceDto{Id: userID, Asset: "BTC", Amount: d("1")})
+		assert.ErrorIs(t, err, service.ErrAssetDisabled)
+		assert.True(t, ex.balances.available[userID]["BTC"].IsZero())
+		assert.Empty(t, ex.journals.posted)
+	})
+
+	t.Run("deposits that do not fit the asset are refused", func(t *testing.T) {
+		creator, ex := newCreator(t)
+		userID := ex.user()
+		// below the minimum deposit, finer than six places, negative
+		for _, amount := range []string{"0.5", "1.0000001", "-1"} {
+			err := creator.AddBalance(context.Background(), dto.BalanceDto{Id: userID, Asset: "USDT", Amount: d(amount)})
+			assert.ErrorIs(t, err, service.ErrInvalidAmount, amount)
+		}
+		err := creator.AddBalance(context.Background(), dto.BalanceDto{Id: userID, Asset: "DOGE", Amount: d("1")})
+		assert.ErrorIs(t, err, repository.ErrAssetNotFound)
+		assert.Empty(t, ex.journals.posted)
+	})
+}
+
+func TestCreateUserWithOpeningBalances(t *testing.T) {
+	creator, ex := newCreator(t)
+
+	user, err := creator.CreateUser(dto.UserDto{Email: "trader@example.com", OpeningBalances: []dto.AssetAmountDto{
+		{Asset: "BTC", Amount: d("0.5")},
+		{Asset: "USDT", Amount: d("1000")},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "0.5", ex.balances.available[user.ID]["BTC"].String())
+	assert.Equal(t, "1000", ex.balances.available[user.ID]["USDT"].String())
+	assert.Len(t, ex.journals.posted, 1, "the opening balances are one deposit")
+
+	t.Run("an opening balance the registry refuses fails the user", func(t *testing.T) {
+		ex.assets.assets[0].DepositEnabled = false
+		_, err := creator.CreateUser(dto.UserDto{Email: "other@example.com", OpeningBalances: []dto.AssetAmountDto{
+			{Asset: "BTC", Amount: d("1")},
+		}})
+		assert.ErrorIs(t, err, service.ErrAssetDisabled)
+		assert.Len(t, ex.journals.posted, 1)
+	})
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// openTx starts a transaction on the database of docker-compose.yml, with
+// the search path set to a schema of its own so the tables a test creates
+// never meet the real ones. Rolling back drops the schema.
+func openTx(t *testing.T) (context.Context, *sql.Tx) {
+	db, err := sql.Open("postgres",
+		"host=localhost port=6432 user=postgres password=postgres dbname=order_app sslmode=disable TimeZone=UTC")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	if err = db.Ping(); err != nil {
+		t.Skipf("no database: %v", err)
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { tx.Rollback() })
+
+	_, err = tx.ExecContext(ctx, `
+        CREATE SCHEMA balance_migration_test;
+        SET LOCAL search_path TO balance_migration_test;
+        CREATE TABLE users (id uuid PRIMARY KEY, email text, btc_balance double precision, usdt_balance double precision);
+        CREATE TABLE balances (
+            user_id uuid, asset varchar(10), available numeric(30,8) NOT NULL DEFAULT 0,
+            locked numeric(30,8) NOT NULL DEFAULT 0, updated_at timestamptz, PRIMARY KEY (user_id, asset)
+        );
+        CREATE TABLE locks (id uuid PRIMARY KEY, order_id uuid, user_id uuid NOT NULL, asset varchar(10) NOT NULL, amount numeric(30,8) NOT NULL);
+    `)
+	require.NoError(t, err)
+	return context.WithValue(ctx, "tx", tx), tx
+}
+
+func balanceOf(t *testing.T, tx *sql.Tx, userID uuid.UUID, asset string) (available, locked decimal.Decimal) {
+	err := tx.QueryRow("SELECT available, locked FROM balances WHERE user_id = $1 AND asset = $2", userID, asset).
+		Scan(&available, &locked)
+	require.NoError(t, err)
+	return available, locked
+}
+
+func TestMigrateBalanceColumns(t *testing.T) {
+	ctx, tx := openTx(t)
+	repo := repository.NewBalanceRepository(nil)
+
+	alice, bob := uuid.New(), uuid.New()
+	_, err := tx.Exec(`INSERT INTO users VALUES ($1, 'alice@example.com', 0.5, 1000), ($2, 'bob@example.com', 0, NULL)`,
+		alice, bob)
+	require.NoError(t, err)
+	_, err = tx.Exec(`
+        INSERT INTO locks VALUES
+            (gen_random_uuid(), gen_random_uuid(), $1, 'usdt', 200),
+            (gen_random_uuid(), gen_random_uuid(), $1, 'USDT', 50),
+            (gen_random_uuid(), gen_random_uuid(), $2, 'btc', 0.1)
+    `, alice, bob)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.MigrateBalanceColumns(ctx))
+
+	available, locked := balanceOf(t, tx, alice, "BTC")
+	assert.Equal(t, "0.5", available.String())
+	assert.True(t, locked.IsZero())
+	available, locked = balanceOf(t, tx, alice, "USDT")
+	assert.Equal(t, "1000", available.String())
+	assert.Equal(t, "250", locked.String(), "locked is the sum of the locks, whatever case their asset is in")
+	available, locked = balanceOf(t, tx, bob, "BTC")
+	assert.True(t, available.IsZero(), "an empty column moves nothing")
+	assert.Equal(t, "0.1", locked.String())
+
+	var columns int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'users' AND column_name IN ('btc_balance', 'usdt_balance')`).
+		Scan(&columns)
+	require.NoError(t, err)
+	assert.Zero(t, columns, "the columns are dropped")
+
+	t.Run("a second run changes nothing", func(t *testing.T) {
+		_, err := tx.Exec("UPDATE balances SET available = 7 WHERE user_id = $1 AND asset = 'BTC'", alice)
+		require.NoError(t, err)
+		_, err = tx.Exec("DELETE FROM locks WHERE user_id = $1", bob)
+		require.NoError(t, err)
+
+		require.NoError(t, repo.MigrateBalanceColumns(ctx))
+
+		available, _ := balanceOf(t, tx, alice, "BTC")
+		assert.Equal(t, "7", available.String())
+		_, locked := balanceOf(t, tx, bob, "BTC")
+		assert.Equal(t, "0.1", locked.String(), "locked is not rebuilt once the columns are gone")
+	})
+}
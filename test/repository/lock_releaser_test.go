@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/internal/repository"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/ledger"
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var d = decimal.RequireFromString
+
+// locks keeps locks by their own ID. Methods the tests do not reach are left
+// to the nil interface.
+type locks struct {
+	repository.ILockRepository
+	held map[uuid.UUID]entity.Lock
+}
+
+func (r *locks) FindLock(_ context.Context, orderID uuid.UUID) (entity.Lock, error) {
+	for _, lock := range r.held {
+		if lock.OrderID != nil && *lock.OrderID == orderID {
+			return lock, nil
+		}
+	}
+	return entity.Lock{}, repository.ErrLockNotFound
+}
+
+func (r *locks) UpdateLockAmount(_ context.Context, lockID uuid.UUID, amount decimal.Decimal) error {
+	lock := r.held[lockID]
+	lock.Amount = lock.Amount.Sub(amount)
+	r.held[lockID] = lock
+	return nil
+}
+
+func (r *locks) DeleteLock(_ context.Context, lockID uuid.UUID) error {
+	delete(r.held, lockID)
+	return nil
+}
+
+// balances keeps what each user has unlocked per asset.
+type balances struct {
+	repository.IBalanceRepository
+	unlocked map[string]decimal.Decimal
+}
+
+func (r *balances) Unlock(_ context.Context, _ uuid.UUID, asset string, amount decimal.Decimal) error {
+	r.unlocked[asset] = r.unlocked[asset].Add(amount)
+	return nil
+}
+
+type assets struct {
+	repository.IAssetRepository
+	assets []entity.Asset
+}
+
+func (r *assets) FindAsset(_ context.Context, code string) (entity.Asset, error) {
+	for _, asset := range r.assets {
+		if asset.Code == code {
+			return asset, nil
+		}
+	}
+	return entity.Asset{}, repository.ErrAssetNotFound
+}
+
+// journals refuses a journal whose entries do not balance.
+type journals struct {
+	repository.ILedgerRepository
+	posted []*ledger.Journal
+}
+
+func (r *journals) PostJournal(_ context.Context, journal *ledger.Journal) error {
+	if err := journal.Validate(); err != nil {
+		return err
+	}
+	r.posted = append(r.posted, journal)
+	return nil
+}
+
+// newReleaser returns a releaser whose only lock holds 100 USDT, an asset of
+// 6 decimal places, for one order.
+func newReleaser() (*repository.LockReleaser, *locks, *balances, *journals, uuid.UUID) {
+	orderID := uuid.New()
+	lock := entity.Lock{ID: uuid.New(), OrderID: &orderID, UserID: uuid.New(), Asset: "USDT", Amount: d("100")}
+	held := &locks{held: map[uuid.UUID]entity.Lock{lock.ID: lock}}
+	unlocked := &balances{unlocked: map[string]decimal.Decimal{}}
+	posted := &journals{}
+	registry := &assets{assets: []entity.Asset{{Code: "USDT", Precision: 6}}}
+	return repository.NewLockReleaser(held, unlocked, registry, posted), held, unlocked, posted, orderID
+}
+
+func TestReleaseRoundsDownToThePrecisionOfTheAsset(t *testing.T) {
+	releaser, held, unlocked, posted, orderID := newReleaser()
+
+	require.NoError(t, releaser.Release(context.Background(), orderID, d("33.3333333"), orderID))
+
+	assert.Equal(t, "33.333333", unlocked.unlocked["USDT"].String())
+	lock, err := held.FindLock(context.Background(), orderID)
+	require.NoError(t, err)
+	assert.Equal(t, "66.666667", lock.Amount.String(), "what rounding leaves stays locked")
+	require.Len(t, posted.posted, 1)
+}
+
+func TestReleaseNeverTakesMoreThanTheLockHolds(t *testing.T) {
+	releaser, held, unlocked, _, orderID := newReleaser()
+
+	require.NoError(t, releaser.Release(context.Background(), orderID, d("150"), orderID))
+
+	assert.Equal(t, "100", unlocked.unlocked["USDT"].String())
+	assert.Empty(t, held.held, "a lock released in full is deleted")
+
+	require.NoError(t, releaser.Release(context.Background(), orderID, d("1"), orderID))
+	assert.Equal(t, "100", unlocked.unlocked["USDT"].String(), "a lock already released is left alone")
+}
+
+func TestReleaseRemainderDeletesTheLock(t *testing.T) {
+	releaser, held, unlocked, posted, orderID := newReleaser()
+	require.NoError(t, releaser.Release(context.Background(), orderID, d("40"), orderID))
+
+	require.NoError(t, releaser.ReleaseRemainder(context.Background(), orderID, orderID))
+
+	assert.Equal(t, "100", unlocked.unlocked["USDT"].String())
+	assert.Empty(t, held.held)
+	assert.Len(t, posted.posted, 2)
+}
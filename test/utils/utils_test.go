@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"bitcoinOrder/internal/domain/entity"
+	"bitcoinOrder/pkg/decimal"
+	"bitcoinOrder/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var d = decimal.RequireFromString
+
+func TestFeeRate(t *testing.T) {
+	tiers := []entity.FeeTier{
+		{Name: "VIP0", MinVolume: d("0"), MakerRate: d("0.001"), TakerRate: d("0.001")},
+		{Name: "VIP1", MinVolume: d("1000000"), MakerRate: d("0.0009"), TakerRate: d("0.001")},
+		{Name: "VIP2", MinVolume: d("5000000"), MakerRate: d("0.0008"), TakerRate: d("0.0009")},
+	}
+	cases := []struct {
+		name   string
+		volume string
+		taker  bool
+		rate   string
+	}{
+		{"No volume", "0", false, "0.001"},
+		{"Just below a tier", "999999.99999999", false, "0.001"},
+		{"Exactly at a tier", "1000000", false, "0.0009"},
+		{"Taker rate of a tier", "1000000", true, "0.001"},
+		{"Highest tier", "5000000", true, "0.0009"},
+		{"Beyond the highest tier", "90000000", false, "0.0008"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, d(c.rate), utils.FeeRate(tiers, d(c.volume), c.taker))
+		})
+	}
+
+	t.Run("No tiers, no fee", func(t *testing.T) {
+		assert.True(t, utils.FeeRate(nil, d("1000000"), true).IsZero())
+	})
+}